@@ -60,6 +60,9 @@ const TokenLoginForm = ({ provider, onBack }: TokenLoginFormProps) => {
 
       const resp = await proxyFetch(`login?provider=${provider.metadata.name}`, {
         method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+        },
         body: JSON.stringify({ token: token.trim() }),
       });
 
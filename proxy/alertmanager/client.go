@@ -0,0 +1,201 @@
+package alertmanager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxResponseSize bounds the AlertManager responses the proxy decodes
+const maxResponseSize = 16 << 20
+
+var (
+	// ErrNotFound is returned when a silence does not exist, or belongs to another organization.
+	ErrNotFound = errors.New("not found")
+	// ErrUnavailable is returned when AlertManager rejects the user's credentials; as in the alerts
+	// proxy, this is treated as alerting being unavailable rather than as an expired session.
+	ErrUnavailable = errors.New("alerts are not available")
+)
+
+// Alert is an alert as returned by the AlertManager API.
+type Alert struct {
+	Fingerprint string            `json:"fingerprint"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      time.Time         `json:"endsAt"`
+	UpdatedAt   time.Time         `json:"updatedAt"`
+	Status      AlertStatus       `json:"status"`
+}
+
+type AlertStatus struct {
+	State       string   `json:"state"`
+	SilencedBy  []string `json:"silencedBy"`
+	InhibitedBy []string `json:"inhibitedBy"`
+}
+
+// Silence is a silence as used by the AlertManager API.
+type Silence struct {
+	ID        string         `json:"id,omitempty"`
+	Matchers  []Matcher      `json:"matchers"`
+	StartsAt  time.Time      `json:"startsAt"`
+	EndsAt    time.Time      `json:"endsAt"`
+	CreatedBy string         `json:"createdBy"`
+	Comment   string         `json:"comment"`
+	UpdatedAt *time.Time     `json:"updatedAt,omitempty"`
+	Status    *SilenceStatus `json:"status,omitempty"`
+}
+
+type SilenceStatus struct {
+	State string `json:"state"`
+}
+
+// Client calls the AlertManager API on behalf of a user, scoped to one organization.
+type Client struct {
+	baseURL *url.URL
+	client  *http.Client
+}
+
+func NewClient(baseURL *url.URL, transport http.RoundTripper) *Client {
+	return &Client{
+		baseURL: baseURL,
+		client:  &http.Client{Transport: transport, Timeout: 30 * time.Second},
+	}
+}
+
+// ListAlerts returns the organization's alerts matching the filters. params may set the
+// AlertManager "active", "silenced" and "inhibited" flags.
+func (c *Client) ListAlerts(ctx context.Context, authHeader, orgID string, filters []string, params url.Values) ([]Alert, error) {
+	scoped, err := ScopeFilters(filters, orgID)
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{"filter": scoped}
+	for _, key := range []string{"active", "silenced", "inhibited"} {
+		if value := params.Get(key); value != "" {
+			query.Set(key, value)
+		}
+	}
+	var alerts []Alert
+	if err := c.do(ctx, http.MethodGet, "api/v2/alerts", query, authHeader, nil, &alerts); err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
+
+// ListSilences returns the organization's silences.
+func (c *Client) ListSilences(ctx context.Context, authHeader, orgID string) ([]Silence, error) {
+	var silences []Silence
+	if err := c.do(ctx, http.MethodGet, "api/v2/silences", orgQuery(orgID), authHeader, nil, &silences); err != nil {
+		return nil, err
+	}
+	owned := silences[:0]
+	for _, silence := range silences {
+		if BelongsToOrganization(silence.Matchers, orgID) {
+			owned = append(owned, silence)
+		}
+	}
+	return owned, nil
+}
+
+// GetSilence returns a silence of the organization. Silences of other organizations are reported as ErrNotFound.
+func (c *Client) GetSilence(ctx context.Context, authHeader, orgID, silenceID string) (*Silence, error) {
+	if _, err := uuid.Parse(silenceID); err != nil {
+		return nil, ErrNotFound
+	}
+	var silence Silence
+	if err := c.do(ctx, http.MethodGet, "api/v2/silence/"+silenceID, orgQuery(orgID), authHeader, nil, &silence); err != nil {
+		return nil, err
+	}
+	if !BelongsToOrganization(silence.Matchers, orgID) {
+		return nil, ErrNotFound
+	}
+	return &silence, nil
+}
+
+// CreateSilence creates a silence restricted to the organization and returns its ID.
+func (c *Client) CreateSilence(ctx context.Context, authHeader, orgID string, silence Silence) (string, error) {
+	matchers, err := ScopeMatchers(silence.Matchers, orgID)
+	if err != nil {
+		return "", err
+	}
+	silence.Matchers = matchers
+	silence.ID = ""
+
+	var resp struct {
+		SilenceID string `json:"silenceID"`
+	}
+	if err := c.do(ctx, http.MethodPost, "api/v2/silences", orgQuery(orgID), authHeader, silence, &resp); err != nil {
+		return "", err
+	}
+	return resp.SilenceID, nil
+}
+
+// ExpireSilence expires a silence of the organization.
+func (c *Client) ExpireSilence(ctx context.Context, authHeader, orgID, silenceID string) error {
+	if _, err := c.GetSilence(ctx, authHeader, orgID, silenceID); err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodDelete, "api/v2/silence/"+silenceID, orgQuery(orgID), authHeader, nil, nil)
+}
+
+// orgQuery returns the query the Flight Control AlertManager proxy uses to authorize the organization.
+func orgQuery(orgID string) url.Values {
+	return url.Values{"filter": {OrgFilter(orgID)}}
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, authHeader string, body, result any) error {
+	reqURL := c.baseURL.JoinPath(path)
+	reqURL.RawQuery = query.Encode()
+
+	var reqBody io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, reqURL.String(), reqBody)
+	if err != nil {
+		return err
+	}
+	if authHeader != "" {
+		req.Header.Set("Authorization", authHeader)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call AlertManager: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode == http.StatusUnauthorized:
+		return ErrUnavailable
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("AlertManager returned status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(result); err != nil {
+		return fmt.Errorf("failed to parse AlertManager response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package alertmanager
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// OrgLabel is the alert label holding the organization an alert belongs to.
+const OrgLabel = "org_id"
+
+// ErrForeignOrganization is returned when matchers target an organization other than the selected one.
+var ErrForeignOrganization = errors.New("matchers cannot target another organization")
+
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Matcher is an AlertManager label matcher, in the format used by the silences API.
+type Matcher struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	IsRegex bool   `json:"isRegex"`
+	// IsEqual is optional in the AlertManager API; nil means true
+	IsEqual *bool `json:"isEqual,omitempty"`
+}
+
+// Equal reports whether the matcher selects alerts whose label matches (=, =~) rather than differs (!=, !~).
+func (m Matcher) Equal() bool {
+	return m.IsEqual == nil || *m.IsEqual
+}
+
+// String formats the matcher in the filter syntax, e.g. org_id="1234".
+func (m Matcher) String() string {
+	op := "="
+	if !m.Equal() {
+		op = "!"
+	}
+	if m.IsRegex {
+		op += "~"
+	} else if !m.Equal() {
+		op += "="
+	}
+	return m.Name + op + strconv.Quote(m.Value)
+}
+
+// Validate checks that the matcher has a valid label name and, for regex matchers, a valid expression.
+func (m Matcher) Validate() error {
+	if !labelNamePattern.MatchString(m.Name) {
+		return fmt.Errorf("invalid label name %q", m.Name)
+	}
+	if m.IsRegex {
+		if _, err := regexp.Compile("^(?:" + m.Value + ")$"); err != nil {
+			return fmt.Errorf("invalid regular expression for label %s: %w", m.Name, err)
+		}
+	}
+	return nil
+}
+
+// OrgMatcher returns the matcher selecting the alerts of an organization.
+func OrgMatcher(orgID string) Matcher {
+	return Matcher{Name: OrgLabel, Value: orgID}
+}
+
+// isOrgMatcher reports whether the matcher is exactly the one selecting orgID.
+func isOrgMatcher(m Matcher, orgID string) bool {
+	return m.Name == OrgLabel && m.Equal() && !m.IsRegex && m.Value == orgID
+}
+
+// ParseFilter parses an AlertManager filter: one matcher, or a comma-separated list in braces,
+// e.g. severity="critical" or {alertname=~"Device.*", severity!="info"}.
+func ParseFilter(filter string) ([]Matcher, error) {
+	s := strings.TrimSpace(filter)
+	if strings.HasPrefix(s, "{") {
+		if !strings.HasSuffix(s, "}") {
+			return nil, fmt.Errorf("unbalanced braces in filter %q", filter)
+		}
+		s = strings.TrimSpace(s[1 : len(s)-1])
+	}
+	if s == "" {
+		return nil, fmt.Errorf("empty filter")
+	}
+
+	var matchers []Matcher
+	for {
+		m, rest, err := parseMatcher(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter %q: %w", filter, err)
+		}
+		matchers = append(matchers, m)
+		rest = strings.TrimSpace(rest)
+		if rest == "" {
+			return matchers, nil
+		}
+		if rest[0] != ',' {
+			return nil, fmt.Errorf("invalid filter %q: expected ',' before %q", filter, rest)
+		}
+		s = strings.TrimSpace(rest[1:])
+	}
+}
+
+func parseMatcher(s string) (Matcher, string, error) {
+	opIndex := strings.IndexAny(s, "=!")
+	if opIndex <= 0 {
+		return Matcher{}, "", fmt.Errorf("missing label name or operator")
+	}
+	m := Matcher{Name: strings.TrimSpace(s[:opIndex])}
+	s = s[opIndex:]
+
+	isEqual := true
+	switch {
+	case strings.HasPrefix(s, "=~"):
+		m.IsRegex = true
+		s = s[2:]
+	case strings.HasPrefix(s, "!~"):
+		m.IsRegex = true
+		isEqual = false
+		s = s[2:]
+	case strings.HasPrefix(s, "!="):
+		isEqual = false
+		s = s[2:]
+	case strings.HasPrefix(s, "="):
+		s = s[1:]
+	default:
+		return Matcher{}, "", fmt.Errorf("invalid operator for label %s", m.Name)
+	}
+	m.IsEqual = &isEqual
+
+	s = strings.TrimLeft(s, " \t")
+	if strings.HasPrefix(s, `"`) {
+		end := closingQuote(s)
+		if end < 0 {
+			return Matcher{}, "", fmt.Errorf("unterminated value for label %s", m.Name)
+		}
+		value, err := strconv.Unquote(s[:end+1])
+		if err != nil {
+			return Matcher{}, "", fmt.Errorf("invalid value for label %s: %w", m.Name, err)
+		}
+		m.Value = value
+		s = s[end+1:]
+	} else {
+		end := strings.IndexByte(s, ',')
+		if end < 0 {
+			end = len(s)
+		}
+		m.Value = strings.TrimSpace(s[:end])
+		s = s[end:]
+	}
+
+	if err := m.Validate(); err != nil {
+		return Matcher{}, "", err
+	}
+	return m, s, nil
+}
+
+// closingQuote returns the index of the quote closing the string starting at s[0], or -1.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// OrgFilter returns the filter selecting the alerts of an organization. The Flight Control AlertManager proxy
+// authorizes requests for the organization in the first filter of the form org_id=<uuid>, so the value is
+// left unquoted; organization IDs are UUIDs, which AlertManager accepts without quotes.
+func OrgFilter(orgID string) string {
+	return OrgLabel + "=" + orgID
+}
+
+// ScopeFilters validates the client's filters and adds the organization filter in front of them,
+// so AlertManager only returns alerts that match all of them within the organization.
+// Filters that select a different organization are rejected with ErrForeignOrganization.
+func ScopeFilters(filters []string, orgID string) ([]string, error) {
+	scoped := make([]string, 0, len(filters)+1)
+	scoped = append(scoped, OrgFilter(orgID))
+	for _, filter := range filters {
+		matchers, err := ParseFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matchers {
+			if m.Name == OrgLabel && !isOrgMatcher(m, orgID) {
+				return nil, ErrForeignOrganization
+			}
+		}
+		scoped = append(scoped, filter)
+	}
+	return scoped, nil
+}
+
+// ScopeMatchers validates silence matchers and makes sure they include the organization matcher.
+// Matchers that select a different organization are rejected with ErrForeignOrganization.
+func ScopeMatchers(matchers []Matcher, orgID string) ([]Matcher, error) {
+	scoped := make([]Matcher, 0, len(matchers)+1)
+	for _, m := range matchers {
+		if err := m.Validate(); err != nil {
+			return nil, err
+		}
+		if m.Name == OrgLabel {
+			if !isOrgMatcher(m, orgID) {
+				return nil, ErrForeignOrganization
+			}
+			continue
+		}
+		scoped = append(scoped, m)
+	}
+	return append(scoped, OrgMatcher(orgID)), nil
+}
+
+// BelongsToOrganization reports whether matchers are restricted to the organization.
+func BelongsToOrganization(matchers []Matcher, orgID string) bool {
+	for _, m := range matchers {
+		if isOrgMatcher(m, orgID) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package alertmanager
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+const orgID = "2f6b1a4e-8c1d-4f0a-9b7e-3c5d6e7f8a90"
+
+func TestParseFilter(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		filter  string
+		want    []string
+		wantErr bool
+	}{
+		{filter: `severity="critical"`, want: []string{`severity="critical"`}},
+		{filter: `severity=critical`, want: []string{`severity="critical"`}},
+		{filter: `{alertname=~"Device.*", severity!="info"}`, want: []string{`alertname=~"Device.*"`, `severity!="info"`}},
+		{filter: `summary!~"a, \"quoted\" value"`, want: []string{`summary!~"a, \"quoted\" value"`}},
+		{filter: ``, wantErr: true},
+		{filter: `{severity="critical"`, wantErr: true},
+		{filter: `="critical"`, wantErr: true},
+		{filter: `1severity="critical"`, wantErr: true},
+		{filter: `severity="critical`, wantErr: true},
+		{filter: `severity=~"(unclosed"`, wantErr: true},
+		{filter: `severity="critical" alertname="x"`, wantErr: true},
+	}
+	for _, tc := range tests {
+		matchers, err := ParseFilter(tc.filter)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("ParseFilter(%q) expected an error, got %v", tc.filter, matchers)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseFilter(%q) unexpected error: %v", tc.filter, err)
+			continue
+		}
+		got := make([]string, 0, len(matchers))
+		for _, m := range matchers {
+			got = append(got, m.String())
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("ParseFilter(%q) = %q, want %q", tc.filter, got, tc.want)
+		}
+	}
+}
+
+func TestScopeFilters(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		filters []string
+		want    []string
+		wantErr error
+	}{
+		{name: "no filters", want: []string{"org_id=" + orgID}},
+		{
+			name:    "client filters are kept",
+			filters: []string{`severity="critical"`, `{alertname="DeviceDisconnected"}`},
+			want:    []string{"org_id=" + orgID, `severity="critical"`, `{alertname="DeviceDisconnected"}`},
+		},
+		{
+			name:    "selected organization is allowed",
+			filters: []string{`org_id="` + orgID + `"`},
+			want:    []string{"org_id=" + orgID, `org_id="` + orgID + `"`},
+		},
+		{name: "other organization", filters: []string{`org_id="other"`}, wantErr: ErrForeignOrganization},
+		{name: "organization regex", filters: []string{`{severity="critical", org_id=~".*"}`}, wantErr: ErrForeignOrganization},
+		{name: "negated organization", filters: []string{`org_id!="` + orgID + `"`}, wantErr: ErrForeignOrganization},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ScopeFilters(tc.filters, orgID)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("expected %v, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil || !slices.Equal(got, tc.want) {
+				t.Fatalf("ScopeFilters() = %q, %v, want %q", got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestScopeMatchers(t *testing.T) {
+	t.Parallel()
+
+	notEqual := false
+	scoped, err := ScopeMatchers([]Matcher{{Name: "device", Value: "dev-1"}, OrgMatcher(orgID)}, orgID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(scoped) != 2 || scoped[0].Name != "device" || !isOrgMatcher(scoped[1], orgID) {
+		t.Fatalf("expected device and a single organization matcher, got %+v", scoped)
+	}
+
+	invalid := [][]Matcher{
+		{{Name: OrgLabel, Value: "other"}},
+		{{Name: OrgLabel, Value: orgID, IsEqual: &notEqual}},
+		{{Name: OrgLabel, Value: ".*", IsRegex: true}},
+	}
+	for _, matchers := range invalid {
+		if _, err := ScopeMatchers(matchers, orgID); !errors.Is(err, ErrForeignOrganization) {
+			t.Errorf("ScopeMatchers(%+v) expected ErrForeignOrganization, got %v", matchers, err)
+		}
+	}
+	if _, err := ScopeMatchers([]Matcher{{Name: "bad-name", Value: "x"}}, orgID); err == nil {
+		t.Error("expected invalid label name to be rejected")
+	}
+}
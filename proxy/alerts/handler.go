@@ -0,0 +1,291 @@
+package alerts
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/flightctl/flightctl-ui/alertmanager"
+	"github.com/flightctl/flightctl-ui/auth"
+	"github.com/flightctl/flightctl-ui/common"
+	"github.com/flightctl/flightctl-ui/log"
+	"github.com/flightctl/flightctl-ui/upstream"
+)
+
+const (
+	// resourceLabel is the alert label holding the name of the resource the alert is about
+	resourceLabel = "resource"
+	// maxSilenceDuration bounds how long a silence created through the proxy can last
+	maxSilenceDuration = 30 * 24 * time.Hour
+)
+
+// Resource kinds alerts are grouped by; Flight Control alert names start with the kind of their resource.
+const (
+	resourceKindDevice = "Device"
+	resourceKindFleet  = "Fleet"
+	resourceKindOther  = "Other"
+)
+
+// AlertGroup holds the alerts of one resource.
+type AlertGroup struct {
+	Kind   string               `json:"kind"`
+	Name   string               `json:"name"`
+	Alerts []alertmanager.Alert `json:"alerts"`
+}
+
+type AlertGroupsResponse struct {
+	Groups []AlertGroup `json:"groups"`
+}
+
+type SilencesResponse struct {
+	Silences []alertmanager.Silence `json:"silences"`
+}
+
+type CreateSilenceRequest struct {
+	Matchers []alertmanager.Matcher `json:"matchers"`
+	Comment  string                 `json:"comment"`
+	// StartsAt defaults to now
+	StartsAt *time.Time `json:"startsAt,omitempty"`
+	EndsAt   time.Time  `json:"endsAt"`
+}
+
+type CreateSilenceResponse struct {
+	SilenceID string `json:"silenceID"`
+}
+
+// Handler serves the alerts of the selected organization, grouped by resource, and manages the
+// organization's silences. Silences are created with the user's name as createdBy.
+type Handler struct {
+	backends *upstream.Registry
+	clients  map[string]*alertmanager.Client
+}
+
+func NewHandler(backends *upstream.Registry) *Handler {
+	clients := map[string]*alertmanager.Client{}
+	for _, b := range backends.List() {
+		if b.AlertManagerUrl == "" {
+			continue
+		}
+		target, err := url.Parse(b.AlertManagerUrl)
+		if err != nil {
+			log.GetLogger().WithError(err).Errorf("Failed to parse URL '%s'", b.AlertManagerUrl)
+			os.Exit(1)
+		}
+		clients[b.Name] = alertmanager.NewClient(target, &http.Transport{TLSClientConfig: b.TlsConfig})
+	}
+	return &Handler{backends: backends, clients: clients}
+}
+
+// requestContext returns the AlertManager client of the selected backend and the organization,
+// or responds with an error and returns false.
+func (h *Handler) requestContext(w http.ResponseWriter, r *http.Request) (*alertmanager.Client, string, bool) {
+	client, ok := h.clients[h.backends.ForRequest(r).Name]
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		return nil, "", false
+	}
+	orgID, ok := common.OrganizationIDFromContext(r.Context())
+	if !ok {
+		common.RespondWithJSONError(w, http.StatusPreconditionRequired, "Organization selection required", "ORGANIZATION_REQUIRED")
+		return nil, "", false
+	}
+	return client, orgID, true
+}
+
+// ListAlertGroups returns the organization's alerts grouped by the device or fleet they are about.
+// The AlertManager "filter", "active", "silenced" and "inhibited" query parameters are supported.
+func (h *Handler) ListAlertGroups(w http.ResponseWriter, r *http.Request) {
+	client, orgID, ok := h.requestContext(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	for _, key := range []string{"active", "silenced", "inhibited"} {
+		if value := query.Get(key); value != "" {
+			if _, err := strconv.ParseBool(value); err != nil {
+				common.RespondWithJSONError(w, http.StatusBadRequest, "Invalid "+key+" parameter", "INVALID_ALERT_FILTER")
+				return
+			}
+		}
+	}
+
+	// OrganizationMiddleware already added the organization filter; the client adds it again
+	filters := make([]string, 0, len(query["filter"]))
+	for _, filter := range query["filter"] {
+		if filter != alertmanager.OrgFilter(orgID) {
+			filters = append(filters, filter)
+		}
+	}
+	alerts, err := client.ListAlerts(r.Context(), r.Header.Get(common.AuthHeaderKey), orgID, filters, query)
+	if err != nil {
+		respondWithAlertsError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, AlertGroupsResponse{Groups: groupAlerts(alerts)})
+}
+
+// ListSilences returns the organization's silences.
+func (h *Handler) ListSilences(w http.ResponseWriter, r *http.Request) {
+	client, orgID, ok := h.requestContext(w, r)
+	if !ok {
+		return
+	}
+	silences, err := client.ListSilences(r.Context(), r.Header.Get(common.AuthHeaderKey), orgID)
+	if err != nil {
+		respondWithAlertsError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, SilencesResponse{Silences: silences})
+}
+
+// CreateSilence creates a silence within the organization.
+func (h *Handler) CreateSilence(w http.ResponseWriter, r *http.Request) {
+	client, orgID, ok := h.requestContext(w, r)
+	if !ok {
+		return
+	}
+
+	var req CreateSilenceRequest
+	if !common.DecodeJSONBody(w, r, &req) {
+		return
+	}
+	silence, err := newSilence(req, time.Now())
+	if err != nil {
+		common.RespondWithJSONError(w, http.StatusBadRequest, err.Error(), "INVALID_SILENCE")
+		return
+	}
+
+	authHeader := r.Header.Get(common.AuthHeaderKey)
+	silence.CreatedBy, err = auth.GetUsername(h.backends.ForRequest(r), authHeader)
+	if err != nil {
+		log.GetLogger().WithError(err).Warn("Failed to get the user creating a silence")
+		common.RespondWithJSONError(w, http.StatusUnauthorized, "Failed to identify the user", "UNAUTHORIZED")
+		return
+	}
+
+	silenceID, err := client.CreateSilence(r.Context(), authHeader, orgID, silence)
+	if err != nil {
+		respondWithAlertsError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, CreateSilenceResponse{SilenceID: silenceID})
+}
+
+// ExpireSilence expires a silence of the organization.
+func (h *Handler) ExpireSilence(w http.ResponseWriter, r *http.Request) {
+	client, orgID, ok := h.requestContext(w, r)
+	if !ok {
+		return
+	}
+	if err := client.ExpireSilence(r.Context(), r.Header.Get(common.AuthHeaderKey), orgID, mux.Vars(r)["silenceId"]); err != nil {
+		respondWithAlertsError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// newSilence validates a silence request. Silences must select alerts by at least one exact label
+// match besides the organization, so a silence can't mute every alert of the organization.
+func newSilence(req CreateSilenceRequest, now time.Time) (alertmanager.Silence, error) {
+	if strings.TrimSpace(req.Comment) == "" {
+		return alertmanager.Silence{}, errors.New("a comment is required")
+	}
+	hasExactMatcher := false
+	for _, m := range req.Matchers {
+		if err := m.Validate(); err != nil {
+			return alertmanager.Silence{}, err
+		}
+		if m.Name != alertmanager.OrgLabel && m.Equal() && !m.IsRegex && m.Value != "" {
+			hasExactMatcher = true
+		}
+	}
+	if !hasExactMatcher {
+		return alertmanager.Silence{}, errors.New("at least one exact label matcher is required")
+	}
+
+	startsAt := now
+	if req.StartsAt != nil && req.StartsAt.After(now) {
+		startsAt = *req.StartsAt
+	}
+	if !req.EndsAt.After(startsAt) {
+		return alertmanager.Silence{}, errors.New("endsAt must be after startsAt")
+	}
+	if req.EndsAt.Sub(startsAt) > maxSilenceDuration {
+		return alertmanager.Silence{}, errors.New("silences cannot last longer than 30 days")
+	}
+	return alertmanager.Silence{
+		Matchers: req.Matchers,
+		Comment:  req.Comment,
+		StartsAt: startsAt,
+		EndsAt:   req.EndsAt,
+	}, nil
+}
+
+// groupAlerts groups alerts by resource, devices first, then fleets and other resources, by name.
+func groupAlerts(alerts []alertmanager.Alert) []AlertGroup {
+	groups := []AlertGroup{}
+	index := map[[2]string]int{}
+	for _, alert := range alerts {
+		key := [2]string{alertResourceKind(alert.Labels["alertname"]), alert.Labels[resourceLabel]}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, AlertGroup{Kind: key[0], Name: key[1]})
+		}
+		groups[i].Alerts = append(groups[i].Alerts, alert)
+	}
+	kindOrder := map[string]int{resourceKindDevice: 0, resourceKindFleet: 1, resourceKindOther: 2}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].Kind != groups[j].Kind {
+			return kindOrder[groups[i].Kind] < kindOrder[groups[j].Kind]
+		}
+		return groups[i].Name < groups[j].Name
+	})
+	return groups
+}
+
+func alertResourceKind(alertName string) string {
+	switch {
+	case strings.HasPrefix(alertName, resourceKindDevice):
+		return resourceKindDevice
+	case strings.HasPrefix(alertName, resourceKindFleet):
+		return resourceKindFleet
+	default:
+		return resourceKindOther
+	}
+}
+
+func respondWithAlertsError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, alertmanager.ErrNotFound):
+		common.RespondWithJSONError(w, http.StatusNotFound, "Silence not found", "SILENCE_NOT_FOUND")
+	case errors.Is(err, alertmanager.ErrForeignOrganization):
+		common.RespondWithJSONError(w, http.StatusForbidden, "Silences cannot target other organizations", "ORGANIZATION_FORBIDDEN")
+	case errors.Is(err, alertmanager.ErrUnavailable):
+		// As in the alerts proxy, a 401 from AlertManager means alerting is not available to the user
+		w.WriteHeader(http.StatusNotImplemented)
+	default:
+		log.GetLogger().WithError(err).Warn("AlertManager request failed")
+		common.RespondWithJSONError(w, http.StatusBadGateway, "Failed to reach the alerts service", "ALERTS_UNAVAILABLE")
+	}
+}
+
+func respondWithJSON(w http.ResponseWriter, status int, value any) {
+	payload, err := json.Marshal(value)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(payload)
+}
@@ -0,0 +1,85 @@
+package alerts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/flightctl/flightctl-ui/alertmanager"
+)
+
+func TestNewSilence(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	later := now.Add(time.Hour)
+	deviceMatcher := []alertmanager.Matcher{{Name: "resource", Value: "device-1"}}
+
+	tests := []struct {
+		name    string
+		req     CreateSilenceRequest
+		wantErr bool
+	}{
+		{name: "valid", req: CreateSilenceRequest{Matchers: deviceMatcher, Comment: "maintenance", EndsAt: later}},
+		{name: "missing comment", req: CreateSilenceRequest{Matchers: deviceMatcher, EndsAt: later}, wantErr: true},
+		{name: "no matchers", req: CreateSilenceRequest{Comment: "c", EndsAt: later}, wantErr: true},
+		{
+			name:    "only regex matchers",
+			req:     CreateSilenceRequest{Matchers: []alertmanager.Matcher{{Name: "resource", Value: ".*", IsRegex: true}}, Comment: "c", EndsAt: later},
+			wantErr: true,
+		},
+		{
+			name:    "only org matcher",
+			req:     CreateSilenceRequest{Matchers: []alertmanager.Matcher{{Name: alertmanager.OrgLabel, Value: "x"}}, Comment: "c", EndsAt: later},
+			wantErr: true,
+		},
+		{name: "ends in the past", req: CreateSilenceRequest{Matchers: deviceMatcher, Comment: "c", EndsAt: now.Add(-time.Minute)}, wantErr: true},
+		{name: "too long", req: CreateSilenceRequest{Matchers: deviceMatcher, Comment: "c", EndsAt: now.Add(31 * 24 * time.Hour)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			silence, err := newSilence(tt.req, now)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got silence %+v", silence)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !silence.StartsAt.Equal(now) {
+				t.Fatalf("expected the silence to start now, got %v", silence.StartsAt)
+			}
+		})
+	}
+}
+
+func TestGroupAlerts(t *testing.T) {
+	alert := func(name, resource string) alertmanager.Alert {
+		return alertmanager.Alert{Labels: map[string]string{"alertname": name, resourceLabel: resource}}
+	}
+	groups := groupAlerts([]alertmanager.Alert{
+		alert("ResourceQuota", "cluster"),
+		alert("FleetRolloutFailed", "fleet-a"),
+		alert("DeviceDisconnected", "device-b"),
+		alert("DeviceCPUCritical", "device-a"),
+		alert("DeviceMemoryWarning", "device-b"),
+	})
+
+	want := []struct {
+		kind, name string
+		alerts     int
+	}{
+		{resourceKindDevice, "device-a", 1},
+		{resourceKindDevice, "device-b", 2},
+		{resourceKindFleet, "fleet-a", 1},
+		{resourceKindOther, "cluster", 1},
+	}
+	if len(groups) != len(want) {
+		t.Fatalf("expected %d groups, got %+v", len(want), groups)
+	}
+	for i, w := range want {
+		if groups[i].Kind != w.kind || groups[i].Name != w.name || len(groups[i].Alerts) != w.alerts {
+			t.Fatalf("group %d: expected %s/%s with %d alerts, got %s/%s with %d", i, w.kind, w.name, w.alerts,
+				groups[i].Kind, groups[i].Name, len(groups[i].Alerts))
+		}
+	}
+}
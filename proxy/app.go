@@ -2,6 +2,7 @@ package main
 
 import (
 	"crypto/tls"
+	"expvar"
 	"net/http"
 	"os"
 	"time"
@@ -9,19 +10,24 @@ import (
 	gorillaHandlers "github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 
+	"github.com/flightctl/flightctl-ui/alerts"
 	"github.com/flightctl/flightctl-ui/auth"
 	"github.com/flightctl/flightctl-ui/bridge"
 	"github.com/flightctl/flightctl-ui/config"
+	"github.com/flightctl/flightctl-ui/events"
 	"github.com/flightctl/flightctl-ui/log"
 	"github.com/flightctl/flightctl-ui/middleware"
+	"github.com/flightctl/flightctl-ui/organization"
+	"github.com/flightctl/flightctl-ui/permissions"
 	"github.com/flightctl/flightctl-ui/server"
+	"github.com/flightctl/flightctl-ui/upstream"
 )
 
 func corsHandler(router *mux.Router) http.Handler {
 	return gorillaHandlers.CORS(
 		gorillaHandlers.AllowedOrigins([]string{"http://localhost:9000"}),
 		gorillaHandlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "PATCH"}),
-		gorillaHandlers.AllowedHeaders([]string{"Content-Type", "Authorization", "X-FlightCtl-Organization-ID", "Flightctl-API-Version"}),
+		gorillaHandlers.AllowedHeaders([]string{"Content-Type", "Authorization", "X-FlightCtl-Organization-ID", "X-FlightCtl-Backend", "Flightctl-API-Version"}),
 		gorillaHandlers.AllowCredentials(),
 	)(router)
 }
@@ -31,41 +37,70 @@ func main() {
 	router := mux.NewRouter()
 	apiRouter := router.PathPrefix("/api").Subrouter()
 
-	apiRouter.Use(middleware.AuthMiddleware)
-	apiRouter.Use(middleware.OrganizationMiddleware)
-
 	tlsConfig, err := bridge.GetTlsConfig()
 	if err != nil {
 		log.WithError(err).Error("Failed to get TLS configuration")
 		os.Exit(1)
 	}
 
-	apiRouter.Handle("/imagebuilder/{forward:.*}", bridge.NewImageBuilderHandler(tlsConfig))
-
-	apiRouter.Handle("/flightctl/{forward:.*}", bridge.NewFlightCtlHandler(tlsConfig))
-
-	alertManagerUrl, alertManagerEnabled := os.LookupEnv("FLIGHTCTL_ALERTMANAGER_PROXY")
-	if alertManagerEnabled && alertManagerUrl != "" {
-		apiRouter.Handle("/alerts/{forward:.*}", bridge.NewAlertManagerHandler(tlsConfig))
-	} else {
-		apiRouter.HandleFunc("/alerts/{forward:.*}", bridge.UnimplementedHandler)
+	backends, err := upstream.Load(tlsConfig)
+	if err != nil {
+		log.WithError(err).Error("Failed to load backends configuration")
+		os.Exit(1)
 	}
 
-	cliArtifactsUrl, cliArtifactsEnabled := os.LookupEnv("FLIGHTCTL_CLI_ARTIFACTS_SERVER")
-	if cliArtifactsEnabled && cliArtifactsUrl != "" {
-		apiRouter.Handle("/cli-artifacts", bridge.NewFlightCtlCliArtifactsHandler(tlsConfig))
-	} else {
-		apiRouter.HandleFunc("/cli-artifacts", bridge.UnimplementedHandler)
+	serviceLogins, err := auth.LoadServiceLogins()
+	if err != nil {
+		log.WithError(err).Error("Failed to load service logins")
+		os.Exit(1)
 	}
 
-	terminalBridge := bridge.TerminalBridge{TlsConfig: tlsConfig}
+	logouts := auth.NewLogoutRegistry()
+
+	apiRouter.Use(middleware.RateLimitMiddleware())
+	apiRouter.Use(middleware.CSRFMiddleware)
+	apiRouter.Use(middleware.RequestLimitsMiddleware)
+	apiRouter.Use(middleware.BackendMiddleware(backends))
+	apiRouter.Use(middleware.AuthMiddleware(backends, serviceLogins, logouts))
+	memberships := organization.NewMembershipCache(config.OrganizationCacheTTL)
+	apiRouter.Use(middleware.OrganizationMiddleware(backends, memberships))
+
+	apiRouter.HandleFunc("/backends", server.BackendsHandler(backends)).Methods(http.MethodGet)
+
+	organizationHandler := organization.NewHandler(backends, memberships)
+	apiRouter.HandleFunc("/organization", organizationHandler.GetOrganization).Methods(http.MethodGet)
+	apiRouter.HandleFunc("/organization", organizationHandler.SetOrganization).Methods(http.MethodPut)
+
+	apiRouter.Handle("/imagebuilder/{forward:.*}", bridge.NewImageBuilderHandler(backends))
+
+	apiRouter.Handle("/flightctl/{forward:.*}", bridge.NewFlightCtlHandler(backends))
+
+	// Backends without AlertManager or CLI artifacts answer these routes with 501
+	apiRouter.Handle("/alerts/{forward:.*}", bridge.NewAlertManagerHandler(backends))
+
+	apiRouter.Handle("/cli-artifacts", bridge.NewFlightCtlCliArtifactsHandler(backends))
+
+	alertsHandler := alerts.NewHandler(backends)
+	apiRouter.HandleFunc("/alerting/alerts", alertsHandler.ListAlertGroups).Methods(http.MethodGet)
+	apiRouter.HandleFunc("/alerting/silences", alertsHandler.ListSilences).Methods(http.MethodGet)
+	apiRouter.HandleFunc("/alerting/silences", alertsHandler.CreateSilence).Methods(http.MethodPost)
+	apiRouter.HandleFunc("/alerting/silences/{silenceId}", alertsHandler.ExpireSilence).Methods(http.MethodDelete)
+
+	permissionsHandler := permissions.NewHandler(backends, config.PermissionsCacheTTL)
+	apiRouter.HandleFunc("/permissions", permissionsHandler.GetPermissions).Methods(http.MethodGet)
+
+	eventsHandler := events.NewHandler(backends)
+	apiRouter.HandleFunc("/events", eventsHandler.Stream).Methods(http.MethodGet)
+
+	terminalBridge := bridge.TerminalBridge{Backends: backends}
 	apiRouter.HandleFunc("/terminal/{forward:.*}", terminalBridge.HandleTerminal)
 	apiRouter.HandleFunc("/app-terminal/{deviceId}/{appName}", terminalBridge.HandleAppTerminal)
+	apiRouter.HandleFunc("/port-forward/{deviceId}/{port}", terminalBridge.HandlePortForward)
 
 	testAuthHandler := bridge.NewTestAuthHandler(tlsConfig)
 	apiRouter.HandleFunc("/test-auth-provider-connection", testAuthHandler.TestConnection)
 
-	authHandler, err := auth.NewAuth(tlsConfig)
+	authHandler, err := auth.NewAuth(backends, serviceLogins, logouts)
 	if err != nil {
 		log.WithError(err).Error("Failed to initialize authentication")
 		os.Exit(1)
@@ -78,9 +113,13 @@ func main() {
 	} else {
 		// Login/logout actions are only available in the standalone UI
 		apiRouter.HandleFunc("/login", authHandler.Login)
+		apiRouter.HandleFunc("/login/device", authHandler.StartDeviceLogin)
+		apiRouter.HandleFunc("/login/device/token", authHandler.PollDeviceLogin)
 		apiRouter.HandleFunc("/login/info", authHandler.GetUserInfo)
 		apiRouter.HandleFunc("/login/refresh", authHandler.Refresh)
 		apiRouter.HandleFunc("/logout", authHandler.Logout)
+		apiRouter.HandleFunc("/logout/backchannel", authHandler.BackchannelLogout)
+		apiRouter.HandleFunc("/logout/frontchannel", authHandler.FrontchannelLogout)
 	}
 
 	spa := server.SpaHandler{}
@@ -107,6 +146,15 @@ func main() {
 		ReadTimeout:  15 * time.Second,
 	}
 
+	if config.MetricsPort != "" {
+		go func() {
+			log.Info("Metrics available at", config.MetricsPort)
+			if err := http.ListenAndServe(config.MetricsPort, expvar.Handler()); err != nil {
+				log.WithError(err).Error("Metrics server stopped")
+			}
+		}()
+	}
+
 	log.Info("Proxy running at", config.BridgePort)
 
 	if serverTlsconfig != nil {
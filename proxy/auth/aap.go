@@ -1,14 +1,11 @@
 package auth
 
 import (
-	"bytes"
 	"crypto/tls"
 	"fmt"
 	"net/http"
-	"net/url"
 
 	"github.com/flightctl/flightctl-ui/bridge"
-	"github.com/flightctl/flightctl-ui/log"
 	"github.com/flightctl/flightctl/api/v1beta1"
 	"github.com/openshift/osincli"
 )
@@ -112,31 +109,15 @@ func getAAPClient(authorizationUrl, tokenUrl string, tlsConfig *tls.Config, clie
 }
 
 func (a *AAPAuthHandler) Logout(token string, _ string) (string, error) {
-	data := url.Values{}
-	data.Set("client_id", a.clientId)
-	data.Set("token", token)
-
-	httpClient := http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: a.tlsConfig,
-		},
-	}
-	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/o/revoke_token/", a.internalAuthURL), bytes.NewBufferString(data.Encode()))
-	if err != nil {
-		log.GetLogger().WithError(err).Warn("failed to create http request")
-		return "", err
-	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-	res, err := httpClient.Do(req)
-	if err != nil {
-		log.GetLogger().WithError(err).Warn("Failed to logout")
-		return "", err
-	}
-	defer res.Body.Close()
+	// The tokens are revoked by revokeTokens, and the cookie will be cleared by the proxy
 	return "", nil
 }
 
+// revokeTokens revokes the access and refresh tokens at the AAP gateway's revocation endpoint
+func (a *AAPAuthHandler) revokeTokens(tokenData TokenData) error {
+	return revokeSessionTokens(fmt.Sprintf("%s/o/revoke_token/", a.internalAuthURL), a.tlsConfig, a.providerName, a.clientId, tokenData.RefreshToken, tokenData.Token)
+}
+
 func (a *AAPAuthHandler) GetLoginRedirectURL(state string, codeChallenge string, redirectURI string) (string, error) {
 	client, err := getAAPClient(a.authURL, a.tokenURL, a.tlsConfig, a.clientId, redirectURI)
 	if err != nil {
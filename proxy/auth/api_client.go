@@ -2,7 +2,6 @@ package auth
 
 import (
 	"bytes"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,7 +9,7 @@ import (
 	"strings"
 	"time"
 
-	"github.com/flightctl/flightctl-ui/common"
+	"github.com/flightctl/flightctl-ui/upstream"
 	"github.com/flightctl/flightctl/api/v1beta1"
 )
 
@@ -18,19 +17,19 @@ import (
 const k8sServiceAccountPrefix = "system:serviceaccount:"
 
 // exchangeTokenWithApiServer allows us to perform the token exchange through the Flight Control API
-func exchangeTokenWithApiServer(apiTlsConfig *tls.Config, providerConfig *v1beta1.AuthProvider, tokenReq *v1beta1.TokenRequest) (*v1beta1.TokenResponse, error) {
+func exchangeTokenWithApiServer(api *upstream.Backend, providerConfig *v1beta1.AuthProvider, tokenReq *v1beta1.TokenRequest) (*v1beta1.TokenResponse, error) {
 	if providerConfig == nil || providerConfig.Metadata.Name == nil {
 		return nil, fmt.Errorf("invalid provider configuration")
 	}
 
 	client := &http.Client{
 		Transport: &http.Transport{
-			TLSClientConfig: apiTlsConfig,
+			TLSClientConfig: api.TlsConfig,
 		},
 		Timeout: 30 * time.Second,
 	}
 
-	tokenURL, err := common.BuildFctlApiUrl("api/v1/auth", *providerConfig.Metadata.Name, "token")
+	tokenURL, err := api.ApiURL("api/v1/auth", *providerConfig.Metadata.Name, "token")
 	if err != nil {
 		return nil, fmt.Errorf("failed to construct token URL: %w", err)
 	}
@@ -96,23 +95,24 @@ func exchangeTokenWithApiServer(apiTlsConfig *tls.Config, providerConfig *v1beta
 	return &tokenResp, nil
 }
 
-// getUserInfoFromApiServer allows us to get the user info from the Flight Control API
-func getUserInfoFromApiServer(apiTlsConfig *tls.Config, token string) (string, error) {
+// getUserInfoFromApiServer allows us to get the user info from the Flight Control API, and the
+// username it names the user by
+func getUserInfoFromApiServer(api *upstream.Backend, token string) (*v1beta1.UserInfoResponse, string, error) {
 	client := &http.Client{
 		Transport: &http.Transport{
-			TLSClientConfig: apiTlsConfig,
+			TLSClientConfig: api.TlsConfig,
 		},
 		Timeout: 30 * time.Second,
 	}
 
-	userInfoURL, err := common.BuildFctlApiUrl("api/v1/auth/userinfo")
+	userInfoURL, err := api.ApiURL("api/v1/auth/userinfo")
 	if err != nil {
-		return "", &UserInfoError{UserMessage: "Unable to reach userinfo service.", Err: err}
+		return nil, "", &UserInfoError{UserMessage: "Unable to reach userinfo service.", Err: err}
 	}
 
 	req, err := http.NewRequest(http.MethodGet, userInfoURL, nil)
 	if err != nil {
-		return "", &UserInfoError{UserMessage: "Unable to reach userinfo service.", Err: err}
+		return nil, "", &UserInfoError{UserMessage: "Unable to reach userinfo service.", Err: err}
 	}
 
 	req.Header.Set("Authorization", "Bearer "+token)
@@ -120,13 +120,13 @@ func getUserInfoFromApiServer(apiTlsConfig *tls.Config, token string) (string, e
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", &UserInfoError{UserMessage: "Unable to reach userinfo service.", Err: err}
+		return nil, "", &UserInfoError{UserMessage: "Unable to reach userinfo service.", Err: err}
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", &UserInfoError{UserMessage: "Invalid response from userinfo service.", Err: err}
+		return nil, "", &UserInfoError{UserMessage: "Invalid response from userinfo service.", Err: err}
 	}
 
 	// Check if response is a Kubernetes Status error object (can occur with any HTTP status)
@@ -148,7 +148,7 @@ func getUserInfoFromApiServer(apiTlsConfig *tls.Config, token string) (string, e
 			if errorMsg == "" {
 				errorMsg = fmt.Sprintf("Failed to obtain the user details (code: %d)", statusObj.Code)
 			}
-			return "", &UserInfoError{UserMessage: errorMsg}
+			return nil, "", &UserInfoError{UserMessage: errorMsg}
 		}
 	}
 
@@ -156,26 +156,26 @@ func getUserInfoFromApiServer(apiTlsConfig *tls.Config, token string) (string, e
 		var userInfoResp v1beta1.UserInfoResponse
 		if err := json.Unmarshal(body, &userInfoResp); err == nil {
 			if userInfoResp.Error != nil {
-				return "", &UserInfoError{UserMessage: *userInfoResp.Error}
+				return nil, "", &UserInfoError{UserMessage: *userInfoResp.Error}
 			}
-			return "", &UserInfoError{UserMessage: fmt.Sprintf("Failed to obtain the user details (status code: %d)", resp.StatusCode)}
+			return nil, "", &UserInfoError{UserMessage: fmt.Sprintf("Failed to obtain the user details (status code: %d)", resp.StatusCode)}
 		}
-		return "", &UserInfoError{UserMessage: fmt.Sprintf("Failed to obtain the user details (status code: %d)", resp.StatusCode)}
+		return nil, "", &UserInfoError{UserMessage: fmt.Sprintf("Failed to obtain the user details (status code: %d)", resp.StatusCode)}
 	}
 
 	// Status is OK, parse as JSON
 	var userInfoResp v1beta1.UserInfoResponse
 	if err := json.Unmarshal(body, &userInfoResp); err != nil {
-		return "", &UserInfoError{UserMessage: "Failed to obtain the user details (invalid response format).", Err: err}
+		return nil, "", &UserInfoError{UserMessage: "Failed to obtain the user details (invalid response format).", Err: err}
 	}
 
 	// Check for errors in response (even with 200 status)
 	if userInfoResp.Error != nil {
-		return "", &UserInfoError{UserMessage: *userInfoResp.Error}
+		return nil, "", &UserInfoError{UserMessage: *userInfoResp.Error}
 	}
 
 	if userInfoResp.PreferredUsername == nil {
-		return "", &UserInfoError{UserMessage: "Failed to obtain the user details (missing username)."}
+		return nil, "", &UserInfoError{UserMessage: "Failed to obtain the user details (missing username)."}
 	}
 
 	// Extract and strip the k8s service account prefix from preferred_username if present
@@ -184,7 +184,18 @@ func getUserInfoFromApiServer(apiTlsConfig *tls.Config, token string) (string, e
 		username = strings.TrimPrefix(username, k8sServiceAccountPrefix)
 	}
 
-	return username, nil
+	return &userInfoResp, username, nil
+}
+
+// GetUsername returns the name of the user the bearer token in authHeader belongs to,
+// as reported by the Flight Control API
+func GetUsername(api *upstream.Backend, authHeader string) (string, error) {
+	token, found := strings.CutPrefix(authHeader, "Bearer ")
+	if !found || token == "" {
+		return "", &UserInfoError{UserMessage: "No authentication token found in request"}
+	}
+	_, username, err := getUserInfoFromApiServer(api, token)
+	return username, err
 }
 
 // convertTokenResponseToTokenData converts TokenResponse to proxy TokenData
@@ -1,7 +1,6 @@
 package auth
 
 import (
-	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,10 +8,12 @@ import (
 	"net/http"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/flightctl/flightctl-ui/common"
 	"github.com/flightctl/flightctl-ui/config"
 	"github.com/flightctl/flightctl-ui/log"
+	"github.com/flightctl/flightctl-ui/upstream"
 	"github.com/flightctl/flightctl/api/v1beta1"
 )
 
@@ -21,7 +22,17 @@ type ExpiresInResp struct {
 }
 
 type UserInfoResponse struct {
-	Username string `json:"username,omitempty"`
+	Username    string   `json:"username,omitempty"`
+	DisplayName string   `json:"displayName,omitempty"`
+	Email       string   `json:"email,omitempty"`
+	Groups      []string `json:"groups,omitempty"`
+	// Provider is the name of the authentication provider the user logged in with
+	Provider string `json:"provider,omitempty"`
+	// SessionExpiresAt is when the session's token expires, when it is known
+	SessionExpiresAt *time.Time `json:"sessionExpiresAt,omitempty"`
+	// Organizations are the organizations the user belongs to. The actions the user may perform in
+	// them are answered by the Flight Control API through /api/permissions.
+	Organizations []UserOrganization `json:"organizations,omitempty"`
 }
 
 type RedirectResponse struct {
@@ -60,15 +71,21 @@ func (e *UserInfoError) Unwrap() error {
 
 type AuthHandler struct {
 	provider       AuthProvider
-	apiTlsConfig   *tls.Config
+	backends       *upstream.Registry
+	serviceLogins  *ServiceLogins
+	logouts        *LogoutRegistry
 	authConfigData *v1beta1.AuthConfig
 }
 
-func NewAuth(apiTlsConfig *tls.Config) (*AuthHandler, error) {
+// NewAuth creates the auth handler. Authentication requests are served by the backend selected
+// for each request; the default backend must be reachable at startup.
+func NewAuth(backends *upstream.Registry, serviceLogins *ServiceLogins, logouts *LogoutRegistry) (*AuthHandler, error) {
 	auth := AuthHandler{
-		apiTlsConfig: apiTlsConfig,
+		backends:      backends,
+		serviceLogins: serviceLogins,
+		logouts:       logouts,
 	}
-	authConfig, err := getAuthInfo(apiTlsConfig)
+	authConfig, err := getAuthInfo(backends.Default())
 	if err != nil {
 		return nil, err
 	}
@@ -100,8 +117,8 @@ func findProviderConfig(authConfig *v1beta1.AuthConfig, providerName string) (*v
 
 // getProviderInstance creates a provider instance by fetching the latest auth config
 // Returns both the provider instance and the provider config to avoid duplicate API calls
-func (a *AuthHandler) getProviderInstance(providerName string) (AuthProvider, *v1beta1.AuthProvider, error) {
-	authConfig, err := getAuthInfo(a.apiTlsConfig)
+func (a *AuthHandler) getProviderInstance(api *upstream.Backend, providerName string) (AuthProvider, *v1beta1.AuthProvider, error) {
+	authConfig, err := getAuthInfo(api)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get auth config: %w", err)
 	}
@@ -137,7 +154,7 @@ func (a *AuthHandler) getProviderInstance(providerName string) (AuthProvider, *v
 			return nil, nil, fmt.Errorf("failed to parse K8s provider spec for %s: %w", providerName, err)
 		}
 		// This is regular k8s token auth
-		provider, err = getK8sAuthHandler(providerConfig, &k8sSpec)
+		provider, err = getK8sAuthHandler(api, providerConfig, &k8sSpec)
 		if err != nil {
 			return nil, nil, fmt.Errorf("failed to create K8s provider %s: %w", providerName, err)
 		}
@@ -235,15 +252,7 @@ func isProviderWithCustomerToken(provider AuthProvider) bool {
 // handleTokenProviderLogin handles login for token-based auth providers (K8s)
 func handleTokenProviderLogin(w http.ResponseWriter, r *http.Request, tokenProvider *TokenAuthProvider, providerName string) bool {
 	var loginParams TokenLoginParameters
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		return false
-	}
-
-	err = json.Unmarshal(body, &loginParams)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+	if !common.DecodeJSONBody(w, r, &loginParams) {
 		return false
 	}
 
@@ -263,6 +272,49 @@ func handleTokenProviderLogin(w http.ResponseWriter, r *http.Request, tokenProvi
 	return true
 }
 
+// handleServiceLogin logs in a non-browser client with a service login. The upstream token is
+// validated against the selected backend and kept by the proxy; the client gets a session cookie.
+func (a AuthHandler) handleServiceLogin(w http.ResponseWriter, r *http.Request, provider *ServiceAuthProvider) {
+	var loginParams ServiceLoginParameters
+	if !common.DecodeJSONBody(w, r, &loginParams) {
+		return
+	}
+
+	token, expiresIn, err := provider.authenticate(loginParams)
+	if errors.Is(err, errInvalidServiceCredentials) {
+		respondWithError(w, http.StatusUnauthorized, "Invalid credentials")
+		return
+	}
+	if err != nil {
+		log.GetLogger().WithError(err).Warnf("Failed to authenticate with service login %s", provider.name)
+		respondWithError(w, http.StatusInternalServerError, "Failed to authenticate")
+		return
+	}
+
+	api := a.backends.ForRequest(r)
+	_, tokenExpiresIn, err := NewTokenAuthProvider(api, "", provider.name).ValidateToken(token)
+	if err != nil {
+		log.GetLogger().WithError(err).Warnf("Token of service login %s was rejected by the API server", provider.name)
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	ttl := config.ServiceSessionTTL
+	for _, expires := range []*int64{expiresIn, tokenExpiresIn} {
+		if expires != nil && time.Duration(*expires)*time.Second < ttl {
+			ttl = time.Duration(*expires) * time.Second
+		}
+	}
+	sessionID, err := a.serviceLogins.startSession(provider, api.Name, token, ttl)
+	if err != nil {
+		log.GetLogger().WithError(err).Warn("Failed to start service session")
+		respondWithError(w, http.StatusInternalServerError, "Failed to authenticate")
+		return
+	}
+	sessionExpiresIn := int64(ttl / time.Second)
+	respondWithToken(w, r, TokenData{Provider: provider.name, ServiceSession: sessionID}, &sessionExpiresIn)
+}
+
 func (a AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	// For GET requests, extract provider from query parameter
 	var provider AuthProvider
@@ -274,7 +326,7 @@ func (a AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		provider, _, err = a.getProviderInstance(providerName)
+		provider, _, err = a.getProviderInstance(a.backends.ForRequest(r), providerName)
 		if err != nil {
 			log.GetLogger().WithError(err).Warn("Failed to set up authentication provider")
 			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid authentication provider: %s", providerName))
@@ -356,7 +408,12 @@ func (a AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		// Token providers pass provider in query param, not state
 		providerNameFromQuery := r.URL.Query().Get("provider")
 		if providerNameFromQuery != "" && common.IsSafeResourceName(providerNameFromQuery) {
-			provider, _, err := a.getProviderInstance(providerNameFromQuery)
+			// Service logins are defined by the proxy and take precedence over the backend's providers
+			if serviceProvider, ok := a.serviceLogins.Provider(providerNameFromQuery); ok {
+				a.handleServiceLogin(w, r, serviceProvider)
+				return
+			}
+			provider, _, err := a.getProviderInstance(a.backends.ForRequest(r), providerNameFromQuery)
 			if err == nil && isProviderWithCustomerToken(provider) {
 				// Handle token provider login immediately and return
 				tokenProvider := provider.(*TokenAuthProvider)
@@ -381,7 +438,7 @@ func (a AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		}
 
 		var providerConfig *v1beta1.AuthProvider
-		provider, providerConfig, err = a.getProviderInstance(providerName)
+		provider, providerConfig, err = a.getProviderInstance(a.backends.ForRequest(r), providerName)
 		if err != nil {
 			log.GetLogger().WithError(err).Warnf("Failed to set up authentication provider %s", providerName)
 			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid authentication provider: %s", providerName))
@@ -389,17 +446,8 @@ func (a AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Flow for all providers except K8s token providers
-		body, err := io.ReadAll(r.Body)
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-
 		loginParams := LoginParameters{}
-		err = json.Unmarshal(body, &loginParams)
-		if err != nil {
-			log.GetLogger().WithError(err).Warn("Failed to unmarshal login parameters from JSON")
-			w.WriteHeader(http.StatusBadRequest)
+		if !common.DecodeJSONBody(w, r, &loginParams) {
 			return
 		}
 
@@ -457,14 +505,20 @@ func (a AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 			RedirectUri:  &redirectURI,
 		}
 
-		tokenResp, err := exchangeTokenWithApiServer(a.apiTlsConfig, providerConfig, tokenReq)
+		tokenResp, err := a.exchangeToken(r, provider, providerConfig, tokenReq)
 		if err != nil {
-			log.GetLogger().WithError(err).Warn("Failed to exchange token with API server")
+			log.GetLogger().WithError(err).Warn("Failed to exchange token")
 			handleOAuthErrorResponse(w, tokenResp, "Failed to obtain login authorization code")
 			return
 		}
 
 		tokenData, expiresIn := convertTokenResponseToTokenData(tokenResp, providerConfig)
+		expiresIn, err = verifySessionToken(provider, tokenData, expiresIn)
+		if err != nil {
+			log.GetLogger().WithError(err).Warnf("Rejected ID token of provider %s", providerName)
+			respondWithError(w, http.StatusUnauthorized, "Invalid ID token")
+			return
+		}
 		respondWithToken(w, r, tokenData, expiresIn)
 	} else {
 		respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
@@ -479,6 +533,24 @@ func (a AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Service sessions end with their upstream token; clients log in again
+	if tokenData.ServiceSession != "" {
+		respondWithError(w, http.StatusBadRequest, "Token refresh not supported for service logins")
+		return
+	}
+
+	if a.logouts.IsLoggedOut(tokenData) {
+		clearSessionCookie(w, r)
+		respondWithError(w, http.StatusUnauthorized, "Session was logged out at the identity provider")
+		return
+	}
+
+	// The refresh token is only sent to the backend that issued it
+	if errors.Is(AuthorizeSessionBackend(a.backends, r, tokenData), ErrForeignBackend) {
+		respondWithError(w, http.StatusUnauthorized, "Session was issued by another backend")
+		return
+	}
+
 	// Validate provider name from cookie to prevent SSRF attacks
 	if !common.IsSafeResourceName(tokenData.Provider) {
 		w.WriteHeader(http.StatusBadRequest)
@@ -487,7 +559,7 @@ func (a AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
 
 	// Get provider to determine routing
 	var providerConfig *v1beta1.AuthProvider
-	provider, providerConfig, err := a.getProviderInstance(tokenData.Provider)
+	provider, providerConfig, err := a.getProviderInstance(a.backends.ForRequest(r), tokenData.Provider)
 	if err != nil {
 		log.GetLogger().WithError(err).Warnf("Failed to set up authentication for provider %s", tokenData.Provider)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -517,18 +589,58 @@ func (a AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
 		RefreshToken: &tokenData.RefreshToken,
 	}
 
-	tokenResp, err := exchangeTokenWithApiServer(a.apiTlsConfig, providerConfig, tokenReq)
+	tokenResp, err := a.exchangeToken(r, provider, providerConfig, tokenReq)
 	if err != nil {
-		log.GetLogger().WithError(err).Warn("Failed to exchange token with API server")
+		log.GetLogger().WithError(err).Warn("Failed to exchange token")
 		handleOAuthErrorResponse(w, tokenResp, "Failed to obtain new access token")
 		return
 	}
 
 	// Convert backend response to TokenData
 	newTokenData, expiresIn := convertTokenResponseToTokenData(tokenResp, providerConfig)
+	expiresIn, err = verifySessionToken(provider, newTokenData, expiresIn)
+	if err != nil {
+		log.GetLogger().WithError(err).Warnf("Rejected ID token of provider %s", tokenData.Provider)
+		respondWithError(w, http.StatusUnauthorized, "Invalid ID token")
+		return
+	}
 	respondWithToken(w, r, newTokenData, expiresIn)
 }
 
+// verifySessionToken verifies the ID token of new OIDC sessions when config.OidcVerifyIdTokens is set.
+// The session then expires with its ID token, when it expires before the access token.
+func verifySessionToken(provider AuthProvider, tokenData TokenData, expiresIn *int64) (*int64, error) {
+	oidcProvider, ok := provider.(*OIDCAuthHandler)
+	if !ok || !config.OidcVerifyIdTokens {
+		return expiresIn, nil
+	}
+	idToken, err := oidcProvider.verifyIdToken(tokenData.Token)
+	if err != nil {
+		return nil, err
+	}
+	remaining := max(int64(time.Until(idToken.Expiration()).Seconds()), 0)
+	if expiresIn == nil || remaining < *expiresIn {
+		expiresIn = &remaining
+	}
+	return expiresIn, nil
+}
+
+// exchangeToken performs the token exchange directly with the provider when the proxy holds client
+// credentials for it (confidential clients), and through the Flight Control API otherwise
+func (a AuthHandler) exchangeToken(r *http.Request, provider AuthProvider, providerConfig *v1beta1.AuthProvider, tokenReq *v1beta1.TokenRequest) (*v1beta1.TokenResponse, error) {
+	if endpointProvider, ok := provider.(tokenEndpointProvider); ok {
+		clientAuth, err := loadClientAuth(extractProviderName(providerConfig), tokenReq.ClientId)
+		if err != nil {
+			return nil, err
+		}
+		if clientAuth != nil {
+			endpoint, tlsConfig := endpointProvider.tokenEndpointConfig()
+			return exchangeTokenWithProvider(endpoint, tlsConfig, clientAuth, tokenReq)
+		}
+	}
+	return exchangeTokenWithApiServer(a.backends.ForRequest(r), providerConfig, tokenReq)
+}
+
 // handleOAuthErrorResponse handles OAuth2 error responses from token exchange/refresh
 func handleOAuthErrorResponse(w http.ResponseWriter, tokenResp *v1beta1.TokenResponse, defaultMessage string) {
 	if tokenResp != nil && tokenResp.Error != nil {
@@ -542,7 +654,11 @@ func handleOAuthErrorResponse(w http.ResponseWriter, tokenResp *v1beta1.TokenRes
 	}
 }
 
+// respondWithToken sets the session cookie, bound to the backend selected by the request
 func respondWithToken(w http.ResponseWriter, r *http.Request, tokenData TokenData, expires *int64) {
+	if b, ok := upstream.FromContext(r.Context()); ok {
+		tokenData.Backend = b.Name
+	}
 	err := setCookie(w, r, tokenData)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -571,7 +687,22 @@ func (a AuthHandler) GetUserInfo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if a.logouts.IsLoggedOut(tokenData) {
+		clearSessionCookie(w, r)
+		respondWithError(w, http.StatusUnauthorized, "Session was logged out at the identity provider")
+		return
+	}
+
+	// The session stays valid for its own backend, so it is kept when another backend is selected
+	if errors.Is(AuthorizeSessionBackend(a.backends, r, tokenData), ErrForeignBackend) {
+		respondWithError(w, http.StatusUnauthorized, "Session was issued by another backend")
+		return
+	}
+
 	token := tokenData.Token
+	if tokenData.ServiceSession != "" {
+		token, _ = a.serviceLogins.AuthorizeRequest(a.backends, r, tokenData.ServiceSession)
+	}
 	if token == "" {
 		clearSessionCookie(w, r)
 		respondWithError(w, http.StatusUnauthorized, "No authentication token found in session")
@@ -579,7 +710,8 @@ func (a AuthHandler) GetUserInfo(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Route ALL providers to API server userinfo endpoint
-	username, err := getUserInfoFromApiServer(a.apiTlsConfig, token)
+	api := a.backends.ForRequest(r)
+	apiUserInfo, username, err := getUserInfoFromApiServer(api, token)
 	if err != nil {
 		log.GetLogger().WithError(err).Warn("Failed to get user info from API server")
 
@@ -597,12 +729,11 @@ func (a AuthHandler) GetUserInfo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	a.respondWithUserInfo(w, username)
+	a.respondWithUserInfo(w, a.buildUserInfo(tokenData, token, apiUserInfo, username))
 }
 
 // respondWithUserInfo is a helper to send the UserInfoResponse
-func (a AuthHandler) respondWithUserInfo(w http.ResponseWriter, username string) {
-	userInfo := UserInfoResponse{Username: username}
+func (a AuthHandler) respondWithUserInfo(w http.ResponseWriter, userInfo UserInfoResponse) {
 	res, err := json.Marshal(userInfo)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -615,7 +746,15 @@ func (a AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	tokenData, err := ParseSessionCookie(r)
 	if err != nil {
 		// No valid session, but still clear cookies and return success
-		clearSessionCookie(w, r)
+		a.clearLogoutCookies(w, r)
+		response, _ := json.Marshal(RedirectResponse{})
+		w.Write(response)
+		return
+	}
+
+	if tokenData.ServiceSession != "" {
+		a.serviceLogins.endSession(tokenData.ServiceSession)
+		a.clearLogoutCookies(w, r)
 		response, _ := json.Marshal(RedirectResponse{})
 		w.Write(response)
 		return
@@ -635,23 +774,33 @@ func (a AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 		authToken := tokenData.Token
 		if authToken == "" {
 			// No valid session, but still clear cookies and return success
-			clearSessionCookie(w, r)
+			a.clearLogoutCookies(w, r)
 			response, _ := json.Marshal(RedirectResponse{})
 			w.Write(response)
 			return
 		}
 
-		provider, _, err := a.getProviderInstance(tokenData.Provider)
-		if err == nil {
-			redirectUrl, err = provider.Logout(authToken, postLogoutBase)
-			if err != nil {
-				log.GetLogger().WithError(err).Warn("Failed to logout from provider")
+		// The session is ended at its provider on the backend that issued it, whichever backend is selected
+		api, ok := sessionBackend(a.backends, tokenData)
+		if ok {
+			provider, _, err := a.getProviderInstance(api, tokenData.Provider)
+			if err == nil {
+				// Invalidate the tokens at the provider, so they can't be used after logging out of the UI
+				if revoker, ok := provider.(tokenRevoker); ok {
+					if err := revoker.revokeTokens(tokenData); err != nil {
+						log.GetLogger().WithError(err).Warnf("Failed to revoke tokens of provider %s", tokenData.Provider)
+					}
+				}
+				redirectUrl, err = provider.Logout(authToken, postLogoutBase)
+				if err != nil {
+					log.GetLogger().WithError(err).Warn("Failed to logout from provider")
+				}
 			}
 		}
 	}
 
 	// In any case, we proceed to clear the cookies
-	clearSessionCookie(w, r)
+	a.clearLogoutCookies(w, r)
 	redirectResp := RedirectResponse{}
 	if redirectUrl != "" {
 		redirectResp.Url = redirectUrl
@@ -664,11 +813,20 @@ func (a AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	w.Write(response)
 }
 
-func getAuthInfo(apiTlsConfig *tls.Config) (*v1beta1.AuthConfig, error) {
+// clearLogoutCookies clears the session and the organizations selected on every backend,
+// so the next user of the browser starts without a selection
+func (a AuthHandler) clearLogoutCookies(w http.ResponseWriter, r *http.Request) {
+	clearSessionCookie(w, r)
+	for _, b := range a.backends.List() {
+		ClearOrganizationCookie(w, r, b.Name)
+	}
+}
+
+func getAuthInfo(api *upstream.Backend) (*v1beta1.AuthConfig, error) {
 	client := &http.Client{Transport: &http.Transport{
-		TLSClientConfig: apiTlsConfig,
+		TLSClientConfig: api.TlsConfig,
 	}}
-	authConfigUrl, err := common.BuildFctlApiUrl("api/v1/auth/config")
+	authConfigUrl, err := api.ApiURL("api/v1/auth/config")
 	if err != nil {
 		return nil, err
 	}
@@ -771,7 +929,8 @@ func getDisplayNameFromProviderSpec(providerSpec *v1beta1.AuthProviderSpec) (boo
 
 // GetLoginCommand generates CLI login commands based on enabled auth providers
 func (a AuthHandler) GetLoginCommand(w http.ResponseWriter, r *http.Request) {
-	authConfig, err := getAuthInfo(a.apiTlsConfig)
+	api := a.backends.ForRequest(r)
+	authConfig, err := getAuthInfo(api)
 	if err != nil {
 		log.GetLogger().WithError(err).Error("Failed to get auth config for login command")
 		respondWithError(w, http.StatusInternalServerError, "Failed to retrieve authentication configuration")
@@ -812,9 +971,9 @@ func (a AuthHandler) GetLoginCommand(w http.ResponseWriter, r *http.Request) {
 
 		if providersCount == 1 || providerTypeStr == ProviderTypeK8s {
 			// --token cannot be used with --provider
-			command = fmt.Sprintf("flightctl login %s --%s", config.FctlApiExternalUrl, providerFlag)
+			command = fmt.Sprintf("flightctl login %s --%s", api.ApiExternalUrl, providerFlag)
 		} else {
-			command = fmt.Sprintf("flightctl login %s --provider=%s --%s", config.FctlApiExternalUrl, providerName, providerFlag)
+			command = fmt.Sprintf("flightctl login %s --provider=%s --%s", api.ApiExternalUrl, providerName, providerFlag)
 		}
 		commands = append(commands, LoginCommand{ProviderName: providerName, DisplayName: displayName, Command: command})
 	}
@@ -0,0 +1,318 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flightctl/flightctl-ui/log"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+// backchannelLogoutEvent is the member of the events claim of logout tokens (OIDC Back-Channel Logout section 2.4)
+const backchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+// logoutRetention is how long sessions logged out at the provider are remembered. ID tokens, and the
+// sessions holding them, don't outlive it.
+const logoutRetention = 24 * time.Hour
+
+// logoutProvidersTTL is how long the OIDC providers of the backends are cached to verify logout requests
+const logoutProvidersTTL = 5 * time.Minute
+
+// logoutMaxEntries bounds each map of the LogoutRegistry; the oldest logouts are forgotten once it is reached
+const logoutMaxEntries = 10000
+
+// ErrSessionLoggedOut is returned for sessions the provider logged out through back-channel or front-channel logout
+var ErrSessionLoggedOut = errors.New("session was logged out at the identity provider")
+
+// LogoutRegistry remembers the sessions that OIDC providers logged out. Session cookies are held by
+// the browser, so they can't be deleted: instead, requests are rejected when the ID token of their
+// session belongs to a logged out provider session (sid), or was issued to a logged out user (sub)
+// before the logout.
+//
+// The registry lives in the memory of one proxy process: it is not shared between replicas, and is
+// lost when the proxy restarts.
+type LogoutRegistry struct {
+	mu sync.Mutex
+	// sessions maps issuer|sid to when the provider session was logged out
+	sessions map[string]time.Time
+	// subjects maps issuer|sub to when all the sessions of the user were logged out
+	subjects map[string]time.Time
+	// tokenIds maps the jti of the logout tokens received to when they were received, to reject replays
+	tokenIds map[string]time.Time
+	// providers caches the OIDC providers by issuer. Logout requests are not authenticated, so they
+	// must not make the proxy fetch the auth config of every backend and provider each time.
+	providers issuerProviders
+}
+
+type issuerProviders struct {
+	mu        sync.Mutex
+	providers map[string]*OIDCAuthHandler
+	fetched   time.Time
+}
+
+// get returns the providers by issuer, loading them when they are older than logoutProvidersTTL
+func (p *issuerProviders) get(load func() map[string]*OIDCAuthHandler) map[string]*OIDCAuthHandler {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.providers == nil || time.Since(p.fetched) >= logoutProvidersTTL {
+		p.providers = load()
+		p.fetched = time.Now()
+	}
+	return p.providers
+}
+
+func NewLogoutRegistry() *LogoutRegistry {
+	return &LogoutRegistry{
+		sessions: map[string]time.Time{},
+		subjects: map[string]time.Time{},
+		tokenIds: map[string]time.Time{},
+	}
+}
+
+func logoutKey(issuer string, value string) string {
+	return strings.TrimSuffix(issuer, "/") + "|" + value
+}
+
+// logout records the logout of a provider session, or of all the sessions of a user when sid is
+// empty. Returns false when the logout token jti was already used.
+func (l *LogoutRegistry) logout(issuer string, sid string, sub string, jti string) bool {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.prune(now)
+
+	if jti != "" {
+		key := logoutKey(issuer, jti)
+		if _, ok := l.tokenIds[key]; ok {
+			return false
+		}
+		record(l.tokenIds, key, now)
+	}
+	if sid != "" {
+		record(l.sessions, logoutKey(issuer, sid), now)
+	} else {
+		record(l.subjects, logoutKey(issuer, sub), now)
+	}
+	return true
+}
+
+// record adds the entry, evicting the oldest one when the map holds logoutMaxEntries
+func record(entries map[string]time.Time, key string, at time.Time) {
+	if _, ok := entries[key]; !ok && len(entries) >= logoutMaxEntries {
+		var oldestKey string
+		var oldest time.Time
+		for k, t := range entries {
+			if oldestKey == "" || t.Before(oldest) {
+				oldestKey, oldest = k, t
+			}
+		}
+		delete(entries, oldestKey)
+	}
+	entries[key] = at
+}
+
+// prune forgets the logouts older than logoutRetention. Must be called with l.mu held.
+func (l *LogoutRegistry) prune(now time.Time) {
+	for _, entries := range []map[string]time.Time{l.sessions, l.subjects, l.tokenIds} {
+		for key, at := range entries {
+			if now.Sub(at) > logoutRetention {
+				delete(entries, key)
+			}
+		}
+	}
+}
+
+// IsLoggedOut reports whether the session was logged out at its provider. Only sessions holding an
+// OIDC ID token can be logged out by the provider.
+func (l *LogoutRegistry) IsLoggedOut(tokenData TokenData) bool {
+	if l == nil || tokenData.Token == "" || tokenData.ServiceSession != "" {
+		return false
+	}
+	l.mu.Lock()
+	empty := len(l.sessions) == 0 && len(l.subjects) == 0
+	l.mu.Unlock()
+	if empty {
+		return false
+	}
+
+	// The session's token was verified when the session started; its claims only identify it here
+	idToken, err := jwt.ParseInsecure([]byte(tokenData.Token))
+	if err != nil {
+		return false
+	}
+	sid, _ := stringClaim(idToken, "sid")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.sessions[logoutKey(idToken.Issuer(), sid)]; sid != "" && ok {
+		return true
+	}
+	loggedOutAt, ok := l.subjects[logoutKey(idToken.Issuer(), idToken.Subject())]
+	return ok && !idToken.IssuedAt().After(loggedOutAt)
+}
+
+// AuthorizeSession returns ErrSessionLoggedOut when the session was logged out at its provider,
+// unless the request checks or ends the session, or logs in again.
+func (l *LogoutRegistry) AuthorizeSession(r *http.Request, tokenData TokenData) error {
+	if !l.IsLoggedOut(tokenData) || slices.Contains(sessionPaths, strings.TrimSuffix(r.URL.Path, "/")) {
+		return nil
+	}
+	return ErrSessionLoggedOut
+}
+
+func stringClaim(token jwt.Token, name string) (string, bool) {
+	value, ok := token.Get(name)
+	if !ok {
+		return "", false
+	}
+	s, ok := value.(string)
+	return s, ok && s != ""
+}
+
+// findOIDCProviderByIssuer returns the OIDC provider of any backend whose issuer is the given one
+func (a AuthHandler) findOIDCProviderByIssuer(issuer string) (*OIDCAuthHandler, error) {
+	if provider, ok := a.logouts.providers.get(a.oidcProvidersByIssuer)[strings.TrimSuffix(issuer, "/")]; ok {
+		return provider, nil
+	}
+	return nil, fmt.Errorf("no OIDC provider with issuer %s", issuer)
+}
+
+// oidcProvidersByIssuer returns the OIDC providers of all the backends by issuer
+func (a AuthHandler) oidcProvidersByIssuer() map[string]*OIDCAuthHandler {
+	providers := map[string]*OIDCAuthHandler{}
+	for _, backend := range a.backends.List() {
+		authConfig, err := getAuthInfo(backend)
+		if err != nil || authConfig == nil || authConfig.Providers == nil {
+			log.GetLogger().WithError(err).Warnf("Failed to get auth config of backend %s", backend.Name)
+			continue
+		}
+		for i, providerConfig := range *authConfig.Providers {
+			providerType, err := providerConfig.Spec.Discriminator()
+			if err != nil || providerType != ProviderTypeOIDC {
+				continue
+			}
+			oidcSpec, err := providerConfig.Spec.AsOIDCProviderSpec()
+			if err != nil {
+				continue
+			}
+			issuer := strings.TrimSuffix(oidcSpec.Issuer, "/")
+			if _, ok := providers[issuer]; ok {
+				continue
+			}
+			provider, err := getOIDCAuthHandler(&(*authConfig.Providers)[i], &oidcSpec)
+			if err != nil {
+				log.GetLogger().WithError(err).Warnf("Failed to get OIDC provider %s of backend %s", extractProviderName(&providerConfig), backend.Name)
+				continue
+			}
+			providers[issuer] = provider
+		}
+	}
+	return providers
+}
+
+// verifyLogoutToken validates a logout token as required by OIDC Back-Channel Logout section 2.6
+func (a AuthHandler) verifyLogoutToken(logoutToken string) (jwt.Token, error) {
+	unverified, err := jwt.ParseInsecure([]byte(logoutToken))
+	if err != nil {
+		return nil, fmt.Errorf("malformed logout token: %w", err)
+	}
+	provider, err := a.findOIDCProviderByIssuer(unverified.Issuer())
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := provider.verifyProviderToken(logoutToken,
+		jwt.WithIssuer(unverified.Issuer()),
+		jwt.WithAudience(provider.clientId),
+		jwt.WithRequiredClaim(jwt.IssuedAtKey),
+		jwt.WithAcceptableSkew(tokenClockSkew),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid logout token: %w", err)
+	}
+
+	events, _ := token.Get("events")
+	if eventsClaim, ok := events.(map[string]interface{}); !ok || eventsClaim[backchannelLogoutEvent] == nil {
+		return nil, fmt.Errorf("logout token is missing the back-channel logout event")
+	}
+	_, hasSid := stringClaim(token, "sid")
+	if !hasSid && token.Subject() == "" {
+		return nil, fmt.Errorf("logout token has neither sid nor sub")
+	}
+	// A nonce would make the logout token usable as an ID token
+	if _, ok := token.Get("nonce"); ok {
+		return nil, fmt.Errorf("logout token must not contain a nonce")
+	}
+	return token, nil
+}
+
+// BackchannelLogout receives the logout tokens that OIDC providers post when a user logs out at the
+// provider, and ends the matching UI sessions
+func (a AuthHandler) BackchannelLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	logoutToken := r.PostFormValue("logout_token")
+	if logoutToken == "" {
+		respondWithError(w, http.StatusBadRequest, "Missing logout_token")
+		return
+	}
+	token, err := a.verifyLogoutToken(logoutToken)
+	if err != nil {
+		log.GetLogger().WithError(err).Warn("Rejected back-channel logout")
+		respondWithError(w, http.StatusBadRequest, "Invalid logout token")
+		return
+	}
+
+	sid, _ := stringClaim(token, "sid")
+	if !a.logouts.logout(token.Issuer(), sid, token.Subject(), token.JwtID()) {
+		respondWithError(w, http.StatusBadRequest, "Logout token was already used")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// FrontchannelLogout is loaded by OIDC providers in an iframe when a user logs out at the provider
+// (OIDC Front-Channel Logout). The session cookie is SameSite=Strict, so it is not sent to the
+// provider's frame: the provider session is identified by the iss and sid parameters instead, and
+// recorded in the LogoutRegistry so the sessions holding it are rejected on their next request.
+// The request is not authenticated; sid values are only known to the provider and its sessions.
+func (a AuthHandler) FrontchannelLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	issuer := r.URL.Query().Get("iss")
+	sid := r.URL.Query().Get("sid")
+	if issuer == "" || sid == "" {
+		respondWithError(w, http.StatusBadRequest, "Missing iss or sid")
+		return
+	}
+	provider, err := a.findOIDCProviderByIssuer(issuer)
+	if err != nil {
+		log.GetLogger().WithError(err).Warn("Rejected front-channel logout")
+		respondWithError(w, http.StatusBadRequest, "Unknown issuer")
+		return
+	}
+	a.logouts.logout(issuer, sid, "", "")
+
+	// Only the provider may frame the page
+	frameAncestors := "'none'"
+	if issuerURL, err := url.Parse(provider.authURL); err == nil {
+		frameAncestors = issuerURL.Scheme + "://" + issuerURL.Host
+	}
+	w.Header().Set("Content-Security-Policy", "frame-ancestors "+frameAncestors)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte("<!DOCTYPE html><html><head><title>Logged out</title></head><body></body></html>"))
+}
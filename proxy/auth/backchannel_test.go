@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flightctl/flightctl-ui/log"
+	"github.com/flightctl/flightctl-ui/upstream"
+	"github.com/flightctl/flightctl/api/v1beta1"
+	"github.com/google/uuid"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+// newLogoutServer serves both the Flight Control auth config and an OIDC provider publishing the
+// public key of the returned signing key
+func newLogoutServer(t *testing.T) (*httptest.Server, jwk.Key) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingKey, err := jwk.FromRaw(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingKey.Set(jwk.KeyIDKey, "key-1")
+	signingKey.Set(jwk.AlgorithmKey, jwa.ES256)
+	publicKey, err := signingKey.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keySet := jwk.NewSet()
+	keySet.AddKey(publicKey)
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	mux.HandleFunc("/api/v1/auth/config", func(w http.ResponseWriter, r *http.Request) {
+		spec := v1beta1.AuthProviderSpec{}
+		if err := spec.FromOIDCProviderSpec(v1beta1.OIDCProviderSpec{Issuer: srv.URL, ClientId: "ui", ProviderType: v1beta1.Oidc}); err != nil {
+			t.Fatal(err)
+		}
+		name := "sso"
+		json.NewEncoder(w).Encode(v1beta1.AuthConfig{Providers: &[]v1beta1.AuthProvider{{Metadata: v1beta1.ObjectMeta{Name: &name}, Spec: spec}}})
+	})
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcServerResponse{JwksUri: srv.URL + "/jwks"})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(keySet)
+	})
+	return srv, signingKey
+}
+
+func signToken(t *testing.T, key jwk.Key, claims map[string]interface{}) string {
+	token := jwt.New()
+	for name, value := range claims {
+		if err := token.Set(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.ES256, key, jws.WithProtectedHeaders(jws.NewHeaders())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(signed)
+}
+
+func TestBackchannelLogout(t *testing.T) {
+	log.InitLogs()
+	srv, key := newLogoutServer(t)
+	backends, err := upstream.NewRegistry([]*upstream.Backend{{Name: "default", ApiUrl: srv.URL}}, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := AuthHandler{backends: backends, logouts: NewLogoutRegistry()}
+
+	issuedAt := time.Now().Add(-time.Minute)
+	session := TokenData{Provider: "sso", Token: signToken(t, key, map[string]interface{}{"iss": srv.URL, "aud": "ui", "sub": "alice", "sid": "s1", "iat": issuedAt})}
+	otherSession := TokenData{Provider: "sso", Token: signToken(t, key, map[string]interface{}{"iss": srv.URL, "aud": "ui", "sub": "bob", "sid": "s2", "iat": issuedAt})}
+
+	logoutClaims := func(overrides map[string]interface{}) map[string]interface{} {
+		claims := map[string]interface{}{
+			"iss":    srv.URL,
+			"aud":    "ui",
+			"iat":    time.Now(),
+			"jti":    uuid.NewString(),
+			"sid":    "s1",
+			"events": map[string]interface{}{backchannelLogoutEvent: map[string]interface{}{}},
+		}
+		for name, value := range overrides {
+			if value == nil {
+				delete(claims, name)
+				continue
+			}
+			claims[name] = value
+		}
+		return claims
+	}
+	post := func(logoutToken string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/logout/backchannel", strings.NewReader(url.Values{"logout_token": {logoutToken}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		handler.BackchannelLogout(rec, req)
+		return rec
+	}
+
+	for name, claims := range map[string]map[string]interface{}{
+		"foreign audience": logoutClaims(map[string]interface{}{"aud": "other"}),
+		"missing event":    logoutClaims(map[string]interface{}{"events": map[string]interface{}{}}),
+		"nonce":            logoutClaims(map[string]interface{}{"nonce": "n"}),
+	} {
+		if rec := post(signToken(t, key, claims)); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected a logout token with %s to be rejected, got %d", name, rec.Code)
+		}
+	}
+	if handler.logouts.IsLoggedOut(session) {
+		t.Fatal("expected rejected logout tokens to leave sessions alone")
+	}
+
+	logoutToken := signToken(t, key, logoutClaims(nil))
+	if rec := post(logoutToken); rec.Code != http.StatusOK {
+		t.Fatalf("expected the logout token to be accepted, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !handler.logouts.IsLoggedOut(session) || handler.logouts.IsLoggedOut(otherSession) {
+		t.Fatal("expected only the session of the logged out sid to end")
+	}
+	if rec := post(logoutToken); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected a replayed logout token to be rejected, got %d", rec.Code)
+	}
+
+	// Logging out a user ends their sessions started before the logout
+	if rec := post(signToken(t, key, logoutClaims(map[string]interface{}{"sid": nil, "sub": "bob"}))); rec.Code != http.StatusOK {
+		t.Fatalf("expected the logout token to be accepted, got %d: %s", rec.Code, rec.Body.String())
+	}
+	newSession := TokenData{Provider: "sso", Token: signToken(t, key, map[string]interface{}{"iss": srv.URL, "aud": "ui", "sub": "bob", "iat": time.Now().Add(time.Minute)})}
+	if !handler.logouts.IsLoggedOut(otherSession) || handler.logouts.IsLoggedOut(newSession) {
+		t.Fatal("expected only the sessions started before the logout to end")
+	}
+}
+
+func TestFrontchannelLogout(t *testing.T) {
+	log.InitLogs()
+	srv, key := newLogoutServer(t)
+	backends, err := upstream.NewRegistry([]*upstream.Backend{{Name: "default", ApiUrl: srv.URL}}, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := AuthHandler{backends: backends, logouts: NewLogoutRegistry()}
+
+	rec := httptest.NewRecorder()
+	handler.FrontchannelLogout(rec, httptest.NewRequest(http.MethodGet, "/api/logout/frontchannel?iss=https://evil.example.com&sid=s1", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected an unknown issuer to be rejected, got %d", rec.Code)
+	}
+
+	session := TokenData{Provider: "sso", Token: signToken(t, key, map[string]interface{}{"iss": srv.URL, "sub": "alice", "sid": "s1", "iat": time.Now()})}
+	other := TokenData{Provider: "sso", Token: signToken(t, key, map[string]interface{}{"iss": srv.URL, "sub": "bob", "sid": "s2", "iat": time.Now()})}
+
+	// The provider's frame doesn't send the SameSite=Strict session cookie
+	rec = httptest.NewRecorder()
+	handler.FrontchannelLogout(rec, httptest.NewRequest(http.MethodGet, "/api/logout/frontchannel?"+url.Values{"iss": {srv.URL}, "sid": {"s1"}}.Encode(), nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Security-Policy") != "frame-ancestors "+srv.URL {
+		t.Fatalf("unexpected front-channel logout response %d: %v", rec.Code, rec.Header())
+	}
+	if !handler.logouts.IsLoggedOut(session) {
+		t.Fatal("expected the session of the sid to be logged out")
+	}
+	if handler.logouts.IsLoggedOut(other) {
+		t.Fatal("expected the sessions of other sids to be kept")
+	}
+
+	// The session is rejected on its next request
+	req := httptest.NewRequest(http.MethodGet, "/api/flightctl/api/v1/devices", nil)
+	if err := handler.logouts.AuthorizeSession(req, session); err != ErrSessionLoggedOut {
+		t.Fatalf("expected the session to be rejected, got %v", err)
+	}
+
+	// The providers are cached: logout requests don't reach the backends every time
+	srv.Close()
+	rec = httptest.NewRecorder()
+	handler.FrontchannelLogout(rec, httptest.NewRequest(http.MethodGet, "/api/logout/frontchannel?"+url.Values{"iss": {srv.URL}, "sid": {"s3"}}.Encode(), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected the provider to be cached, got %d", rec.Code)
+	}
+}
+
+func TestLogoutRegistryIsBounded(t *testing.T) {
+	logouts := NewLogoutRegistry()
+	for i := range logoutMaxEntries + 10 {
+		logouts.logout("https://sso.example.com", fmt.Sprintf("sid-%d", i), "", "")
+	}
+	if len(logouts.sessions) != logoutMaxEntries {
+		t.Fatalf("expected %d logouts to be kept, got %d", logoutMaxEntries, len(logouts.sessions))
+	}
+	if _, ok := logouts.sessions[logoutKey("https://sso.example.com", fmt.Sprintf("sid-%d", logoutMaxEntries+9))]; !ok {
+		t.Fatal("expected the latest logout to be kept")
+	}
+}
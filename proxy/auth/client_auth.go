@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	b64 "encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/flightctl/flightctl-ui/config"
+	"github.com/flightctl/flightctl/api/v1beta1"
+	"github.com/google/uuid"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+// Files read from the provider's directory in config.AuthClientSecretsDir
+const (
+	clientSecretFile = "client-secret"
+	privateKeyFile   = "private-key.pem"
+	keyIdFile        = "key-id"
+)
+
+// clientAssertionType is the client_assertion_type of private_key_jwt client authentication (RFC 7523 section 2.2)
+const clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// clientAssertionLifetime is how long the JWTs used for private_key_jwt client authentication are valid
+const clientAssertionLifetime = time.Minute
+
+// clientAuth authenticates the proxy to a provider as a confidential client, with a client secret
+// (client_secret_basic) or a private key (private_key_jwt).
+type clientAuth struct {
+	clientId     string
+	clientSecret string
+	privateKey   crypto.Signer
+	keyId        string
+}
+
+// loadClientAuth reads the client credentials of a provider from config.AuthClientSecretsDir/<providerName>/.
+// The files are read on every use so rotated secrets are picked up. Returns nil when the provider has
+// no credentials, meaning it is a public client.
+func loadClientAuth(providerName string, clientId string) (*clientAuth, error) {
+	if config.AuthClientSecretsDir == "" || providerName == "" {
+		return nil, nil
+	}
+	dir := filepath.Join(config.AuthClientSecretsDir, providerName)
+
+	secret, err := readSecretFile(filepath.Join(dir, clientSecretFile))
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := readSecretFile(filepath.Join(dir, privateKeyFile))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case secret == "" && keyPEM == "":
+		return nil, nil
+	case secret != "" && keyPEM != "":
+		return nil, fmt.Errorf("provider %s has both a client secret and a private key", providerName)
+	case secret != "":
+		return &clientAuth{clientId: clientId, clientSecret: secret}, nil
+	}
+
+	privateKey, err := parsePrivateKey([]byte(keyPEM))
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key for provider %s: %w", providerName, err)
+	}
+	keyId, err := readSecretFile(filepath.Join(dir, keyIdFile))
+	if err != nil {
+		return nil, err
+	}
+	return &clientAuth{clientId: clientId, privateKey: privateKey, keyId: keyId}, nil
+}
+
+// readSecretFile returns the trimmed content of a secret file, or an empty string when it doesn't exist
+func readSecretFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+func parsePrivateKey(keyPEM []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported private key format")
+}
+
+// signatureAlgorithm picks the JWS algorithm for the client's private key
+func signatureAlgorithm(key crypto.Signer) (jwa.SignatureAlgorithm, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return jwa.RS256, nil
+	case *ecdsa.PrivateKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return jwa.ES256, nil
+		case elliptic.P384():
+			return jwa.ES384, nil
+		case elliptic.P521():
+			return jwa.ES512, nil
+		}
+	case ed25519.PrivateKey:
+		return jwa.EdDSA, nil
+	}
+	return "", fmt.Errorf("unsupported private key type %T", key)
+}
+
+// authenticate adds the client credentials to the headers or form of a request to one of the
+// provider's endpoints; the endpoint is the audience of private_key_jwt assertions.
+func (c *clientAuth) authenticate(header http.Header, form url.Values, endpoint string) error {
+	if c.privateKey == nil {
+		credentials := url.QueryEscape(c.clientId) + ":" + url.QueryEscape(c.clientSecret)
+		header.Set("Authorization", "Basic "+b64.StdEncoding.EncodeToString([]byte(credentials)))
+		return nil
+	}
+
+	alg, err := signatureAlgorithm(c.privateKey)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	assertion, err := jwt.NewBuilder().
+		Issuer(c.clientId).
+		Subject(c.clientId).
+		Audience([]string{endpoint}).
+		JwtID(uuid.NewString()).
+		IssuedAt(now).
+		Expiration(now.Add(clientAssertionLifetime)).
+		Build()
+	if err != nil {
+		return err
+	}
+	headers := jws.NewHeaders()
+	if c.keyId != "" {
+		if err := headers.Set(jws.KeyIDKey, c.keyId); err != nil {
+			return err
+		}
+	}
+	signed, err := jwt.Sign(assertion, jwt.WithKey(alg, c.privateKey, jws.WithProtectedHeaders(headers)))
+	if err != nil {
+		return fmt.Errorf("failed to sign client assertion: %w", err)
+	}
+	form.Set("client_assertion_type", clientAssertionType)
+	form.Set("client_assertion", string(signed))
+	return nil
+}
+
+// tokenEndpointProvider is implemented by the providers whose token endpoint the proxy can call directly
+type tokenEndpointProvider interface {
+	tokenEndpointConfig() (string, *tls.Config)
+}
+
+func (o *OIDCAuthHandler) tokenEndpointConfig() (string, *tls.Config) {
+	return o.tokenEndpoint, o.tlsConfig
+}
+
+func (o *OAuth2AuthHandler) tokenEndpointConfig() (string, *tls.Config) {
+	return o.tokenURL, o.tlsConfig
+}
+
+func (a *AAPAuthHandler) tokenEndpointConfig() (string, *tls.Config) {
+	return a.tokenURL, a.tlsConfig
+}
+
+func (o *OpenShiftAuthHandler) tokenEndpointConfig() (string, *tls.Config) {
+	return o.tokenURL, o.tlsConfig
+}
+
+// exchangeTokenWithProvider performs the token exchange directly with the provider's token endpoint,
+// authenticating as a confidential client
+func exchangeTokenWithProvider(endpoint string, tlsConfig *tls.Config, clientAuth *clientAuth, tokenReq *v1beta1.TokenRequest) (*v1beta1.TokenResponse, error) {
+	form := url.Values{
+		"grant_type": {string(tokenReq.GrantType)},
+		"client_id":  {tokenReq.ClientId},
+	}
+	for name, value := range map[string]*string{
+		"code":          tokenReq.Code,
+		"code_verifier": tokenReq.CodeVerifier,
+		"redirect_uri":  tokenReq.RedirectUri,
+		"refresh_token": tokenReq.RefreshToken,
+		"scope":         tokenReq.Scope,
+	} {
+		if value != nil && *value != "" {
+			form.Set(name, *value)
+		}
+	}
+
+	var tokenResp v1beta1.TokenResponse
+	status, err := postTokenForm(endpoint, form, tlsConfig, clientAuth, &tokenResp)
+	if err != nil {
+		return nil, err
+	}
+	if tokenResp.Error != nil {
+		errorDesc := ""
+		if tokenResp.ErrorDescription != nil {
+			errorDesc = *tokenResp.ErrorDescription
+		}
+		return &tokenResp, fmt.Errorf("oauth2 error: %s - %s", *tokenResp.Error, errorDesc)
+	}
+	// AAP answers with 201
+	if status != http.StatusOK && status != http.StatusCreated {
+		return nil, fmt.Errorf("token endpoint returned status %d", status)
+	}
+	return &tokenResp, nil
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/flightctl/flightctl-ui/config"
+	"github.com/flightctl/flightctl/api/v1beta1"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+func writeProviderSecret(t *testing.T, providerName string, file string, content []byte) {
+	dir := filepath.Join(config.AuthClientSecretsDir, providerName)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, file), content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExchangeTokenWithClientSecret(t *testing.T) {
+	secretsDir := config.AuthClientSecretsDir
+	config.AuthClientSecretsDir = t.TempDir()
+	t.Cleanup(func() { config.AuthClientSecretsDir = secretsDir })
+	writeProviderSecret(t, "sso", clientSecretFile, []byte("s3cret\n"))
+
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientId, clientSecret, ok := r.BasicAuth()
+		if !ok || clientId != "ui" || clientSecret != "s3cret" || r.FormValue("code") != "code" || r.FormValue("grant_type") != "authorization_code" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"invalid_client"}`))
+			return
+		}
+		w.Write([]byte(`{"id_token":"id-token","expires_in":300}`))
+	}))
+	defer tokenServer.Close()
+
+	clientAuth, err := loadClientAuth("sso", "ui")
+	if err != nil || clientAuth == nil {
+		t.Fatalf("expected client credentials, got %v", err)
+	}
+	code := "code"
+	tokenResp, err := exchangeTokenWithProvider(tokenServer.URL, nil, clientAuth, &v1beta1.TokenRequest{GrantType: v1beta1.AuthorizationCode, ClientId: "ui", Code: &code})
+	if err != nil || tokenResp.IdToken == nil || *tokenResp.IdToken != "id-token" {
+		t.Fatalf("unexpected token response %+v: %v", tokenResp, err)
+	}
+
+	if clientAuth, err := loadClientAuth("public", "ui"); err != nil || clientAuth != nil {
+		t.Fatalf("expected providers without secrets to be public clients, got %+v %v", clientAuth, err)
+	}
+}
+
+func TestPrivateKeyJWTClientAuth(t *testing.T) {
+	secretsDir := config.AuthClientSecretsDir
+	config.AuthClientSecretsDir = t.TempDir()
+	t.Cleanup(func() { config.AuthClientSecretsDir = secretsDir })
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeProviderSecret(t, "sso", privateKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	writeProviderSecret(t, "sso", keyIdFile, []byte("key-1"))
+
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		endpoint := "http://" + r.Host + r.URL.Path
+		assertion, err := jwt.Parse([]byte(r.FormValue("client_assertion")), jwt.WithKey(jwa.ES256, &key.PublicKey), jwt.WithAudience(endpoint), jwt.WithIssuer("ui"), jwt.WithSubject("ui"))
+		if err != nil || r.FormValue("client_assertion_type") != clientAssertionType || assertion.JwtID() == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"invalid_client"}`))
+			return
+		}
+		w.Write([]byte(`{"access_token":"access-token"}`))
+	}))
+	defer tokenServer.Close()
+
+	clientAuth, err := loadClientAuth("sso", "ui")
+	if err != nil || clientAuth == nil || clientAuth.keyId != "key-1" {
+		t.Fatalf("expected private key client credentials, got %+v %v", clientAuth, err)
+	}
+	refreshToken := "refresh-token"
+	tokenResp, err := exchangeTokenWithProvider(tokenServer.URL+"/token", nil, clientAuth, &v1beta1.TokenRequest{GrantType: v1beta1.RefreshToken, ClientId: "ui", RefreshToken: &refreshToken})
+	if err != nil || tokenResp.AccessToken == nil || *tokenResp.AccessToken != "access-token" {
+		t.Fatalf("unexpected token response %+v: %v", tokenResp, err)
+	}
+
+	writeProviderSecret(t, "sso", clientSecretFile, []byte("s3cret"))
+	if _, err := loadClientAuth("sso", "ui"); err == nil {
+		t.Fatal("expected an error when both a client secret and a private key are configured")
+	}
+}
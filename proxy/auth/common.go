@@ -12,7 +12,9 @@ import (
 	"strings"
 
 	"github.com/flightctl/flightctl-ui/common"
+	"github.com/flightctl/flightctl-ui/upstream"
 	"github.com/flightctl/flightctl/api/v1beta1"
+	"github.com/google/uuid"
 	"github.com/openshift/osincli"
 )
 
@@ -32,6 +34,10 @@ type TokenData struct {
 	Token        string `json:"token"`
 	RefreshToken string `json:"refreshToken"`
 	Provider     string `json:"provider,omitempty"`
+	// ServiceSession identifies the session of a service login; its token is kept by the proxy (see ServiceLogins)
+	ServiceSession string `json:"serviceSession,omitempty"`
+	// Backend is the name of the backend that issued the session; its credentials are only sent to that backend
+	Backend string `json:"backend,omitempty"`
 }
 
 type LoginParameters struct {
@@ -93,6 +99,34 @@ func ParseSessionCookie(r *http.Request) (TokenData, error) {
 	return tokenData, nil
 }
 
+// ErrForeignBackend is returned for requests that select another backend than the one that issued their session
+var ErrForeignBackend = errors.New("session was issued by another backend")
+
+// sessionBackend returns the backend that issued the session. Sessions that don't record it were
+// issued by the default backend. The session cookie is not signed, so the backend it records can be
+// edited by the client: it must not be trusted to protect credentials held by the proxy.
+func sessionBackend(backends *upstream.Registry, tokenData TokenData) (*upstream.Backend, bool) {
+	if tokenData.Backend == "" {
+		return backends.Default(), true
+	}
+	return backends.Get(tokenData.Backend)
+}
+
+// AuthorizeSessionBackend returns ErrForeignBackend when the request selects another backend than the
+// one recorded in the session cookie. It is only a guard against sending user tokens to the wrong
+// backend by mistake: a forged cookie passes it, but user tokens are issued for the audience of
+// their own backend anyway. Service sessions are bound to their backend by ServiceLogins.
+func AuthorizeSessionBackend(backends *upstream.Registry, r *http.Request, tokenData TokenData) error {
+	if tokenData.Token == "" && tokenData.ServiceSession == "" {
+		return nil
+	}
+	issuer, ok := sessionBackend(backends, tokenData)
+	if !ok || issuer.Name != backends.ForRequest(r).Name {
+		return ErrForeignBackend
+	}
+	return nil
+}
+
 type ErrorResponse struct {
 	Error string `json:"error"`
 }
@@ -342,3 +376,46 @@ func validateAndExtractProviderFromState(r *http.Request, state string) (string,
 
 	return providerName, nil
 }
+
+// Organization cookie name prefix; the backend name is appended since organizations are per backend
+const organizationCookiePrefix = "flightctl-organization-"
+
+// SetOrganizationCookie remembers the organization selected by the user on a backend
+func SetOrganizationCookie(w http.ResponseWriter, r *http.Request, backendName string, orgID string) {
+	cookie := http.Cookie{
+		Name:     organizationCookiePrefix + backendName,
+		Value:    orgID,
+		Secure:   cookieSecureForRequest(r),
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+		Path:     "/",
+	}
+	http.SetCookie(w, &cookie)
+}
+
+// GetOrganizationCookie returns the organization selected by the user on a backend.
+// Returns empty string if no organization is selected or the cookie value is not an organization ID
+func GetOrganizationCookie(r *http.Request, backendName string) string {
+	cookie, err := r.Cookie(organizationCookiePrefix + backendName)
+	if err != nil {
+		return ""
+	}
+	if _, err := uuid.Parse(cookie.Value); err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// ClearOrganizationCookie forgets the organization selected by the user on a backend
+func ClearOrganizationCookie(w http.ResponseWriter, r *http.Request, backendName string) {
+	cookie := http.Cookie{
+		Name:     organizationCookiePrefix + backendName,
+		Value:    "",
+		MaxAge:   -1,
+		Path:     "/",
+		Secure:   cookieSecureForRequest(r),
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	}
+	http.SetCookie(w, &cookie)
+}
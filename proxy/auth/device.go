@@ -0,0 +1,411 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/tls"
+	b64 "encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/flightctl/flightctl-ui/common"
+	"github.com/flightctl/flightctl-ui/log"
+	"github.com/flightctl/flightctl/api/v1beta1"
+)
+
+// deviceCodeGrantType is the grant type used to poll for the tokens of a device login (RFC 8628 section 3.4)
+const deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// deviceLoginCookieName holds the device login in progress, so the device code never reaches the page
+const deviceLoginCookieName = "device_login"
+
+const (
+	// defaultDevicePollInterval is the polling interval when the provider does not set one
+	defaultDevicePollInterval = 5
+	// devicePollSlowDown is added to the interval each time the provider asks to slow down
+	devicePollSlowDown = 5
+)
+
+var errDeviceLoginUnsupported = errors.New("provider does not support device login")
+
+// deviceLoginConfig is what a provider needs to run the device authorization grant (RFC 8628)
+type deviceLoginConfig struct {
+	deviceAuthorizationURL string
+	tokenURL               string
+	clientId               string
+	scope                  string
+	tlsConfig              *tls.Config
+	clientAuth             *clientAuth
+}
+
+// deviceLoginProvider is implemented by the providers supporting device logins (OIDC and OAuth2)
+type deviceLoginProvider interface {
+	deviceLoginConfig() (deviceLoginConfig, error)
+}
+
+// DeviceLoginResponse tells the user where to enter the user code to complete a device login
+type DeviceLoginResponse struct {
+	UserCode                string `json:"userCode"`
+	VerificationUri         string `json:"verificationUri"`
+	VerificationUriComplete string `json:"verificationUriComplete,omitempty"`
+	ExpiresIn               int64  `json:"expiresIn"`
+	Interval                int64  `json:"interval"`
+}
+
+// DevicePollResponse is returned while the user has not completed the device login yet
+type DevicePollResponse struct {
+	// Status is "pending", or "slow_down" when polling too often
+	Status   string `json:"status"`
+	Interval int64  `json:"interval"`
+}
+
+type deviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationUri         string `json:"verification_uri"`
+	VerificationUriComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+	Error                   string `json:"error"`
+	ErrorDescription        string `json:"error_description"`
+}
+
+// deviceLogin is the device login in progress, stored in the device login cookie
+type deviceLogin struct {
+	Provider   string `json:"provider"`
+	DeviceCode string `json:"deviceCode"`
+	Interval   int64  `json:"interval"`
+	NextPoll   int64  `json:"nextPoll"`
+	// Expires is when the device code expires, as a Unix timestamp
+	Expires int64 `json:"expires"`
+}
+
+func (o *OIDCAuthHandler) deviceLoginConfig() (deviceLoginConfig, error) {
+	if o.deviceAuthorizationEndpoint == "" {
+		return deviceLoginConfig{}, errDeviceLoginUnsupported
+	}
+	clientAuth, err := loadClientAuth(o.providerName, o.clientId)
+	if err != nil {
+		return deviceLoginConfig{}, err
+	}
+	return deviceLoginConfig{
+		deviceAuthorizationURL: o.deviceAuthorizationEndpoint,
+		tokenURL:               o.tokenEndpoint,
+		clientId:               o.clientId,
+		scope:                  buildScopeParam(o.scopes, defaultOIDCScopes),
+		tlsConfig:              o.tlsConfig,
+		clientAuth:             clientAuth,
+	}, nil
+}
+
+func (o *OAuth2AuthHandler) deviceLoginConfig() (deviceLoginConfig, error) {
+	// OAuth2 providers don't declare a device authorization endpoint; look it up in the issuer's metadata
+	metadata, err := o.issuerMetadata()
+	if err != nil {
+		return deviceLoginConfig{}, err
+	}
+	if metadata.DeviceAuthorizationEndpoint == "" {
+		return deviceLoginConfig{}, errDeviceLoginUnsupported
+	}
+	clientAuth, err := loadClientAuth(o.providerName, o.clientId)
+	if err != nil {
+		return deviceLoginConfig{}, err
+	}
+	return deviceLoginConfig{
+		deviceAuthorizationURL: metadata.DeviceAuthorizationEndpoint,
+		tokenURL:               o.tokenURL,
+		clientId:               o.clientId,
+		scope:                  o.scope,
+		tlsConfig:              o.tlsConfig,
+		clientAuth:             clientAuth,
+	}, nil
+}
+
+// postTokenForm posts an OAuth2 form to one of the provider's endpoints and decodes the JSON response into dst.
+// Confidential clients authenticate with clientAuth; it is nil for public clients.
+func postTokenForm(endpoint string, form url.Values, tlsConfig *tls.Config, clientAuth *clientAuth, dst any) (int, error) {
+	header := http.Header{}
+	if clientAuth != nil {
+		if err := clientAuth.authenticate(header, form, endpoint); err != nil {
+			return 0, fmt.Errorf("failed to authenticate client: %w", err)
+		}
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return 0, err
+	}
+	req.Header = header
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: tlsConfig,
+		},
+		Timeout: 30 * time.Second,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to call %s: %w", endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return resp.StatusCode, fmt.Errorf("failed to read response: %w", err)
+	}
+	// Some endpoints, such as token revocation, answer with an empty body
+	if len(bytes.TrimSpace(body)) == 0 {
+		return resp.StatusCode, nil
+	}
+	if err := json.Unmarshal(body, dst); err != nil {
+		return resp.StatusCode, fmt.Errorf("%s returned status %d", endpoint, resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// StartDeviceLogin starts a device authorization grant with the provider in the "provider" query
+// parameter, and returns the code the user enters on another device to complete the login
+func (a AuthHandler) StartDeviceLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	providerName := r.URL.Query().Get("provider")
+	if !common.IsSafeResourceName(providerName) {
+		respondWithError(w, http.StatusBadRequest, "Invalid authentication provider")
+		return
+	}
+
+	provider, _, err := a.getProviderInstance(a.backends.ForRequest(r), providerName)
+	if err != nil {
+		log.GetLogger().WithError(err).Warn("Failed to set up authentication provider")
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid authentication provider: %s", providerName))
+		return
+	}
+	deviceProvider, ok := provider.(deviceLoginProvider)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "The authentication provider does not support device login")
+		return
+	}
+	cfg, err := deviceProvider.deviceLoginConfig()
+	if errors.Is(err, errDeviceLoginUnsupported) {
+		respondWithError(w, http.StatusBadRequest, "The authentication provider does not support device login")
+		return
+	}
+	if err != nil {
+		log.GetLogger().WithError(err).Warnf("Failed to set up device login for provider %s", providerName)
+		respondWithError(w, http.StatusInternalServerError, "Failed to initialize authentication flow")
+		return
+	}
+
+	form := url.Values{"client_id": {cfg.clientId}}
+	if cfg.scope != "" {
+		form.Set("scope", cfg.scope)
+	}
+	var authResp deviceAuthorizationResponse
+	status, err := postTokenForm(cfg.deviceAuthorizationURL, form, cfg.tlsConfig, cfg.clientAuth, &authResp)
+	if err == nil && (status != http.StatusOK || authResp.Error != "" || authResp.DeviceCode == "" || authResp.UserCode == "") {
+		err = fmt.Errorf("device authorization failed with status %d: %s %s", status, authResp.Error, authResp.ErrorDescription)
+	}
+	if err != nil {
+		log.GetLogger().WithError(err).Warnf("Failed to start device login for provider %s", providerName)
+		respondWithError(w, http.StatusInternalServerError, "Failed to initialize authentication flow")
+		return
+	}
+
+	if authResp.Interval <= 0 {
+		authResp.Interval = defaultDevicePollInterval
+	}
+	now := time.Now().Unix()
+	login := deviceLogin{
+		Provider:   providerName,
+		DeviceCode: authResp.DeviceCode,
+		Interval:   authResp.Interval,
+		NextPoll:   now + authResp.Interval,
+		Expires:    now + authResp.ExpiresIn,
+	}
+	if err := setDeviceLoginCookie(w, r, login); err != nil {
+		log.GetLogger().WithError(err).Warn("Failed to store device login")
+		respondWithError(w, http.StatusInternalServerError, "Failed to initialize authentication flow")
+		return
+	}
+
+	response, err := json.Marshal(DeviceLoginResponse{
+		UserCode:                authResp.UserCode,
+		VerificationUri:         authResp.VerificationUri,
+		VerificationUriComplete: authResp.VerificationUriComplete,
+		ExpiresIn:               authResp.ExpiresIn,
+		Interval:                authResp.Interval,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// PollDeviceLogin checks whether the user completed the device login started by StartDeviceLogin.
+// It answers 202 with the polling interval while the login is pending, and sets the session cookie
+// once it completes.
+func (a AuthHandler) PollDeviceLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	login, err := getDeviceLoginCookie(r)
+	if err != nil || login.DeviceCode == "" || !common.IsSafeResourceName(login.Provider) {
+		respondWithError(w, http.StatusBadRequest, "No device login in progress. Please restart the login flow.")
+		return
+	}
+
+	now := time.Now().Unix()
+	if now >= login.Expires {
+		clearDeviceLoginCookie(w, r)
+		respondWithError(w, http.StatusBadRequest, "The device login expired. Please restart the login flow.")
+		return
+	}
+	// Don't relay polls the provider would answer with slow_down anyway
+	if now < login.NextPoll {
+		respondWithDevicePoll(w, "slow_down", login.Interval)
+		return
+	}
+
+	provider, providerConfig, err := a.getProviderInstance(a.backends.ForRequest(r), login.Provider)
+	if err != nil {
+		log.GetLogger().WithError(err).Warnf("Failed to set up authentication provider %s", login.Provider)
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid authentication provider: %s", login.Provider))
+		return
+	}
+	deviceProvider, ok := provider.(deviceLoginProvider)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "The authentication provider does not support device login")
+		return
+	}
+	cfg, err := deviceProvider.deviceLoginConfig()
+	if err != nil {
+		log.GetLogger().WithError(err).Warnf("Failed to set up device login for provider %s", login.Provider)
+		respondWithError(w, http.StatusInternalServerError, "Failed to complete authentication flow")
+		return
+	}
+
+	form := url.Values{
+		"grant_type":  {deviceCodeGrantType},
+		"device_code": {login.DeviceCode},
+		"client_id":   {cfg.clientId},
+	}
+	var tokenResp v1beta1.TokenResponse
+	status, err := postTokenForm(cfg.tokenURL, form, cfg.tlsConfig, cfg.clientAuth, &tokenResp)
+	if err != nil {
+		log.GetLogger().WithError(err).Warnf("Failed to poll device login for provider %s", login.Provider)
+		respondWithError(w, http.StatusInternalServerError, "Failed to complete authentication flow")
+		return
+	}
+
+	if tokenResp.Error != nil {
+		switch *tokenResp.Error {
+		case "authorization_pending", "slow_down":
+			if *tokenResp.Error == "slow_down" {
+				login.Interval += devicePollSlowDown
+			}
+			login.NextPoll = now + login.Interval
+			if err := setDeviceLoginCookie(w, r, login); err != nil {
+				log.GetLogger().WithError(err).Warn("Failed to store device login")
+			}
+			respondWithDevicePoll(w, strings.TrimPrefix(*tokenResp.Error, "authorization_"), login.Interval)
+		case "access_denied":
+			clearDeviceLoginCookie(w, r)
+			respondWithError(w, http.StatusForbidden, "The device login was denied")
+		case "expired_token":
+			clearDeviceLoginCookie(w, r)
+			respondWithError(w, http.StatusBadRequest, "The device login expired. Please restart the login flow.")
+		default:
+			clearDeviceLoginCookie(w, r)
+			handleOAuthErrorResponse(w, &tokenResp, "Failed to complete authentication flow")
+		}
+		return
+	}
+	if status != http.StatusOK {
+		log.GetLogger().Warnf("Device login token request for provider %s returned status %d", login.Provider, status)
+		respondWithError(w, http.StatusInternalServerError, "Failed to complete authentication flow")
+		return
+	}
+
+	clearDeviceLoginCookie(w, r)
+	tokenData, expiresIn := convertTokenResponseToTokenData(&tokenResp, providerConfig)
+	expiresIn, err = verifySessionToken(provider, tokenData, expiresIn)
+	if err != nil {
+		log.GetLogger().WithError(err).Warnf("Rejected ID token of provider %s", login.Provider)
+		respondWithError(w, http.StatusUnauthorized, "Invalid ID token")
+		return
+	}
+	respondWithToken(w, r, tokenData, expiresIn)
+}
+
+func respondWithDevicePoll(w http.ResponseWriter, status string, interval int64) {
+	response, err := json.Marshal(DevicePollResponse{Status: status, Interval: interval})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(response)
+}
+
+// setDeviceLoginCookie stores the device login until the device code expires
+func setDeviceLoginCookie(w http.ResponseWriter, r *http.Request, login deviceLogin) error {
+	cookieVal, err := json.Marshal(login)
+	if err != nil {
+		return err
+	}
+	encodedValue := b64.StdEncoding.EncodeToString(cookieVal)
+	if len(encodedValue) > maxCookieValueSize {
+		return fmt.Errorf("cookie value size (%d bytes) exceeds maximum allowed size (%d bytes)", len(encodedValue), maxCookieValueSize)
+	}
+	cookie := http.Cookie{
+		Name:     deviceLoginCookieName,
+		Value:    encodedValue,
+		Secure:   cookieSecureForRequest(r),
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+		Path:     "/",
+		MaxAge:   int(max(login.Expires-time.Now().Unix(), 1)),
+	}
+	http.SetCookie(w, &cookie)
+	return nil
+}
+
+func getDeviceLoginCookie(r *http.Request) (deviceLogin, error) {
+	login := deviceLogin{}
+	cookie, err := r.Cookie(deviceLoginCookieName)
+	if err != nil {
+		return login, err
+	}
+	val, err := b64.StdEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return login, err
+	}
+	err = json.Unmarshal(val, &login)
+	return login, err
+}
+
+// clearDeviceLoginCookie removes the device login cookie
+func clearDeviceLoginCookie(w http.ResponseWriter, r *http.Request) {
+	cookie := http.Cookie{
+		Name:     deviceLoginCookieName,
+		Value:    "",
+		MaxAge:   -1,
+		Path:     "/",
+		Secure:   cookieSecureForRequest(r),
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	}
+	http.SetCookie(w, &cookie)
+}
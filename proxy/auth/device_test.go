@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flightctl/flightctl-ui/log"
+	"github.com/flightctl/flightctl-ui/upstream"
+	"github.com/flightctl/flightctl/api/v1beta1"
+)
+
+// newDeviceLoginServer serves both the Flight Control auth config and an OIDC provider
+// supporting device logins, which is authorized after the given number of polls
+func newDeviceLoginServer(t *testing.T, pendingPolls int) *httptest.Server {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	mux.HandleFunc("/api/v1/auth/config", func(w http.ResponseWriter, r *http.Request) {
+		spec := v1beta1.AuthProviderSpec{}
+		if err := spec.FromOIDCProviderSpec(v1beta1.OIDCProviderSpec{Issuer: srv.URL, ClientId: "ui", ProviderType: v1beta1.Oidc}); err != nil {
+			t.Fatal(err)
+		}
+		name := "sso"
+		json.NewEncoder(w).Encode(v1beta1.AuthConfig{Providers: &[]v1beta1.AuthProvider{{Metadata: v1beta1.ObjectMeta{Name: &name}, Spec: spec}}})
+	})
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcServerResponse{TokenEndpoint: srv.URL + "/token", DeviceAuthorizationEndpoint: srv.URL + "/device"})
+	})
+	mux.HandleFunc("/device", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("client_id") != "ui" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"device_code":"dc","user_code":"ABCD-EFGH","verification_uri":"https://sso.example.com/device","expires_in":600,"interval":1}`))
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("grant_type") != deviceCodeGrantType || r.FormValue("device_code") != "dc" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		if pendingPolls > 0 {
+			pendingPolls--
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"authorization_pending"}`))
+			return
+		}
+		w.Write([]byte(`{"id_token":"id-token","access_token":"access-token","refresh_token":"refresh-token","expires_in":300}`))
+	})
+	return srv
+}
+
+func TestDeviceLogin(t *testing.T) {
+	log.InitLogs()
+	srv := newDeviceLoginServer(t, 1)
+	backends, err := upstream.NewRegistry([]*upstream.Backend{{Name: "default", ApiUrl: srv.URL}}, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := AuthHandler{backends: backends}
+
+	rec := httptest.NewRecorder()
+	handler.StartDeviceLogin(rec, httptest.NewRequest(http.MethodPost, "/api/login/device?provider=sso", nil))
+	var started DeviceLoginResponse
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &started) != nil || started.UserCode != "ABCD-EFGH" {
+		t.Fatalf("unexpected start response %d: %s", rec.Code, rec.Body.String())
+	}
+	loginCookie := rec.Result().Cookies()[0]
+
+	poll := func(cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/login/device/token", nil)
+		req.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		handler.PollDeviceLogin(rec, req)
+		return rec
+	}
+
+	// Polling before the interval elapsed is not relayed to the provider
+	if rec := poll(loginCookie); rec.Code != http.StatusAccepted {
+		t.Fatalf("expected a slow_down answer, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	login, _ := getDeviceLoginCookie(&http.Request{Header: http.Header{"Cookie": {loginCookie.String()}}})
+	login.NextPoll = 0
+	rec = httptest.NewRecorder()
+	if err := setDeviceLoginCookie(rec, httptest.NewRequest(http.MethodGet, "/", nil), login); err != nil {
+		t.Fatal(err)
+	}
+	rec = poll(rec.Result().Cookies()[0])
+	var pending DevicePollResponse
+	if rec.Code != http.StatusAccepted || json.Unmarshal(rec.Body.Bytes(), &pending) != nil || pending.Status != "pending" {
+		t.Fatalf("expected a pending answer, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	login.NextPoll = 0
+	rec = httptest.NewRecorder()
+	setDeviceLoginCookie(rec, httptest.NewRequest(http.MethodGet, "/", nil), login)
+	rec = poll(rec.Result().Cookies()[0])
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected the login to complete, got %d: %s", rec.Code, rec.Body.String())
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.MaxAge >= 0 {
+			req.AddCookie(cookie)
+		}
+	}
+	tokenData, err := ParseSessionCookie(req)
+	if err != nil || tokenData.Token != "id-token" || tokenData.RefreshToken != "refresh-token" || tokenData.Provider != "sso" {
+		t.Fatalf("unexpected session %+v: %v", tokenData, err)
+	}
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+const (
+	// jwksRefreshInterval is how long a provider's key set is used before it is fetched again
+	jwksRefreshInterval = time.Hour
+	// jwksMinRefreshInterval bounds how often a key set is fetched again when a token is signed
+	// with an unknown key, which happens when the provider rotates its keys
+	jwksMinRefreshInterval = time.Minute
+	// tokenClockSkew is the clock difference with the providers tolerated when validating token times
+	tokenClockSkew = 2 * time.Minute
+)
+
+// providerKeySets caches the key sets of the OIDC providers by JWKS URI. Provider handlers are built
+// for each request, so the cache is shared by all of them.
+var providerKeySets = &jwksCache{sets: map[string]*cachedKeySet{}}
+
+type jwksCache struct {
+	mu   sync.Mutex
+	sets map[string]*cachedKeySet
+}
+
+type cachedKeySet struct {
+	set     jwk.Set
+	fetched time.Time
+}
+
+// keySet returns the key set published at uri, fetching it when it is not cached or older than
+// maxAge
+func (c *jwksCache) keySet(uri string, tlsConfig *tls.Config, maxAge time.Duration) (jwk.Set, error) {
+	c.mu.Lock()
+	cached, ok := c.sets[uri]
+	c.mu.Unlock()
+	if ok && time.Since(cached.fetched) < maxAge {
+		return cached.set, nil
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: tlsConfig,
+		},
+		Timeout: 30 * time.Second,
+	}
+	set, err := jwk.Fetch(context.Background(), uri, jwk.WithHTTPClient(client))
+	if err != nil {
+		if ok {
+			// Keep using the known keys while the provider can't be reached
+			return cached.set, nil
+		}
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+
+	c.mu.Lock()
+	c.sets[uri] = &cachedKeySet{set: set, fetched: time.Now()}
+	c.mu.Unlock()
+	return set, nil
+}
+
+// verifyProviderToken verifies the signature of a JWT issued by the provider against its key set,
+// and validates its claims with the given options. When the signature can't be verified with the
+// cached keys, the key set is fetched again in case the provider rotated them.
+func (o *OIDCAuthHandler) verifyProviderToken(token string, options ...jwt.ParseOption) (jwt.Token, error) {
+	if o.jwksURI == "" {
+		return nil, fmt.Errorf("OIDC provider %s does not publish a JWKS", o.providerName)
+	}
+
+	parse := func(maxAge time.Duration) (jwt.Token, error) {
+		set, err := providerKeySets.keySet(o.jwksURI, o.tlsConfig, maxAge)
+		if err != nil {
+			return nil, err
+		}
+		parseOptions := append([]jwt.ParseOption{
+			jwt.WithKeySet(set, jws.WithInferAlgorithmFromKey(true)),
+			jwt.WithValidate(true),
+		}, options...)
+		return jwt.ParseString(token, parseOptions...)
+	}
+
+	parsed, err := parse(jwksRefreshInterval)
+	if err == nil {
+		return parsed, nil
+	}
+	// Claim errors don't depend on the keys
+	if jwt.IsValidationError(err) {
+		return nil, err
+	}
+	return parse(jwksMinRefreshInterval)
+}
+
+// verifyIdToken verifies the signature of an ID token issued by the provider, that it was issued to
+// the UI's client, and that it is valid now
+func (o *OIDCAuthHandler) verifyIdToken(idToken string) (jwt.Token, error) {
+	return o.verifyProviderToken(idToken,
+		jwt.WithIssuer(o.authURL),
+		jwt.WithAudience(o.clientId),
+		jwt.WithRequiredClaim(jwt.ExpirationKey),
+		jwt.WithAcceptableSkew(tokenClockSkew),
+	)
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/flightctl/flightctl-ui/config"
+)
+
+func TestVerifySessionToken(t *testing.T) {
+	srv, key := newLogoutServer(t)
+	verify := config.OidcVerifyIdTokens
+	config.OidcVerifyIdTokens = true
+	t.Cleanup(func() { config.OidcVerifyIdTokens = verify })
+
+	provider := &OIDCAuthHandler{authURL: srv.URL, clientId: "ui", providerName: "sso", jwksURI: srv.URL + "/jwks"}
+	idToken := func(claims map[string]interface{}) TokenData {
+		allClaims := map[string]interface{}{"iss": srv.URL, "aud": "ui", "sub": "alice", "iat": time.Now(), "exp": time.Now().Add(5 * time.Minute)}
+		for name, value := range claims {
+			allClaims[name] = value
+		}
+		return TokenData{Provider: "sso", Token: signToken(t, key, allClaims)}
+	}
+
+	// The session ends with the ID token when it expires before the access token
+	accessTokenExpiresIn := int64(3600)
+	expiresIn, err := verifySessionToken(provider, idToken(nil), &accessTokenExpiresIn)
+	if err != nil || expiresIn == nil || *expiresIn > 300 || *expiresIn < 290 {
+		t.Fatalf("unexpected session expiry %v: %v", expiresIn, err)
+	}
+
+	for name, claims := range map[string]map[string]interface{}{
+		"foreign audience": {"aud": "other"},
+		"foreign issuer":   {"iss": "https://evil.example.com"},
+		"expired":          {"exp": time.Now().Add(-10 * time.Minute)},
+		"not yet valid":    {"nbf": time.Now().Add(10 * time.Minute)},
+	} {
+		if _, err := verifySessionToken(provider, idToken(claims), nil); err == nil {
+			t.Fatalf("expected an ID token with %s to be rejected", name)
+		}
+	}
+
+	forged := idToken(nil)
+	forged.Token = forged.Token[:len(forged.Token)-4] + "AAAA"
+	if _, err := verifySessionToken(provider, forged, nil); err == nil {
+		t.Fatal("expected an ID token with an invalid signature to be rejected")
+	}
+
+	config.OidcVerifyIdTokens = false
+	if expiresIn, err := verifySessionToken(provider, forged, &accessTokenExpiresIn); err != nil || *expiresIn != 3600 {
+		t.Fatalf("expected ID tokens not to be verified when disabled, got %v: %v", expiresIn, err)
+	}
+}
@@ -1,19 +1,17 @@
 package auth
 
 import (
-	"crypto/tls"
 	"fmt"
 	"net/http"
 	"time"
 
-	"github.com/flightctl/flightctl-ui/bridge"
-	"github.com/flightctl/flightctl-ui/common"
+	"github.com/flightctl/flightctl-ui/upstream"
 	"github.com/flightctl/flightctl/api/v1beta1"
 	"github.com/lestrrat-go/jwx/v2/jwt"
 )
 
 type TokenAuthProvider struct {
-	apiTlsConfig *tls.Config
+	api          *upstream.Backend
 	authURL      string
 	providerName string
 }
@@ -22,9 +20,9 @@ type TokenLoginParameters struct {
 	Token string `json:"token"`
 }
 
-func NewTokenAuthProvider(apiTlsConfig *tls.Config, authURL string, providerName string) *TokenAuthProvider {
+func NewTokenAuthProvider(api *upstream.Backend, authURL string, providerName string) *TokenAuthProvider {
 	return &TokenAuthProvider{
-		apiTlsConfig: apiTlsConfig,
+		api:          api,
 		authURL:      authURL,
 		providerName: providerName,
 	}
@@ -33,11 +31,11 @@ func NewTokenAuthProvider(apiTlsConfig *tls.Config, authURL string, providerName
 // ValidateToken validates a K8s token by calling the backend API
 func (t *TokenAuthProvider) ValidateToken(token string) (TokenData, *int64, error) {
 	client := &http.Client{Transport: &http.Transport{
-		TLSClientConfig: t.apiTlsConfig,
+		TLSClientConfig: t.api.TlsConfig,
 	}}
 
 	// Endpoint to validate that a given token is authorized to access the Flight Control API
-	validateUrl, err := common.BuildFctlApiUrl("api/v1/auth/validate")
+	validateUrl, err := t.api.ApiURL("api/v1/auth/validate")
 	if err != nil {
 		return TokenData{}, nil, err
 	}
@@ -127,18 +125,13 @@ func (t *TokenAuthProvider) GetLoginRedirectURL(state string, codeChallenge stri
 }
 
 // getK8sAuthHandler creates a new K8s token authentication handler
-func getK8sAuthHandler(provider *v1beta1.AuthProvider, k8sSpec *v1beta1.K8sProviderSpec) (*TokenAuthProvider, error) {
+func getK8sAuthHandler(api *upstream.Backend, provider *v1beta1.AuthProvider, k8sSpec *v1beta1.K8sProviderSpec) (*TokenAuthProvider, error) {
 	providerName := extractProviderName(provider)
 
-	// Use API TLS config since we're calling the FlightCtl API to validate tokens
-	tlsConfig, err := bridge.GetTlsConfig()
-	if err != nil {
-		return nil, err
-	}
-
 	// For K8s token auth, we don't need authURL for the provider itself
 	// The token validation happens against the FlightCtl API
 	authURL := ""
 
-	return NewTokenAuthProvider(tlsConfig, authURL, providerName), nil
+	// The token is validated against the backend the login request targets
+	return NewTokenAuthProvider(api, authURL, providerName), nil
 }
@@ -2,8 +2,12 @@ package auth
 
 import (
 	"crypto/tls"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/flightctl/flightctl-ui/bridge"
 	"github.com/flightctl/flightctl/api/v1beta1"
@@ -18,6 +22,8 @@ type OAuth2AuthHandler struct {
 	clientId         string
 	scope            string
 	providerName     string
+	// issuer is optional; when set, its metadata is used to discover the device authorization endpoint
+	issuer string
 }
 
 // getOAuth2AuthHandler creates an OAuth2 handler using explicit endpoints
@@ -50,6 +56,9 @@ func getOAuth2AuthHandler(provider *v1beta1.AuthProvider, oauth2Spec *v1beta1.OA
 		scope:            scope,
 		providerName:     providerName,
 	}
+	if oauth2Spec.Issuer != nil {
+		handler.issuer = *oauth2Spec.Issuer
+	}
 
 	return handler, nil
 }
@@ -77,8 +86,36 @@ func (o *OAuth2AuthHandler) oauth2ClientForRedirect(redirectURI string) (*osincl
 	return client, nil
 }
 
+// issuerMetadata reads the issuer's OpenID Connect or OAuth2 authorization server metadata (RFC 8414),
+// which declares the optional endpoints OAuth2 providers are not configured with
+func (o *OAuth2AuthHandler) issuerMetadata() (oidcServerResponse, error) {
+	if o.issuer == "" {
+		return oidcServerResponse{}, nil
+	}
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: o.tlsConfig,
+		},
+		Timeout: 30 * time.Second,
+	}
+	issuer := strings.TrimSuffix(o.issuer, "/")
+	for _, metadataURL := range []string{issuer + "/.well-known/openid-configuration", issuer + "/.well-known/oauth-authorization-server"} {
+		resp, err := client.Get(metadataURL)
+		if err != nil {
+			return oidcServerResponse{}, fmt.Errorf("failed to fetch provider metadata: %w", err)
+		}
+		var metadata oidcServerResponse
+		err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&metadata)
+		resp.Body.Close()
+		if err == nil && resp.StatusCode == http.StatusOK {
+			return metadata, nil
+		}
+	}
+	return oidcServerResponse{}, nil
+}
+
 func (o *OAuth2AuthHandler) Logout(token string, _ string) (string, error) {
-	// OAuth2 providers typically don't have a standardized logout endpoint
+	// OAuth2 providers typically don't have a standardized logout endpoint; tokens are revoked by revokeTokens.
 	// Return empty string to indicate no logout URL
 	return "", nil
 }
@@ -14,24 +14,33 @@ import (
 )
 
 type OIDCAuthHandler struct {
-	tlsConfig              *tls.Config
-	oidcDiscoveryForClient oidcServerResponse
-	scopes                 *[]string
-	endSessionEndpoint     string
-	userInfoEndpoint       string
-	authURL                string
-	tokenEndpoint          string
-	clientId               string
-	providerName           string
+	tlsConfig                   *tls.Config
+	oidcDiscoveryForClient      oidcServerResponse
+	scopes                      *[]string
+	endSessionEndpoint          string
+	userInfoEndpoint            string
+	authURL                     string
+	tokenEndpoint               string
+	deviceAuthorizationEndpoint string
+	revocationEndpoint          string
+	jwksURI                     string
+	clientId                    string
+	providerName                string
 }
 
 type oidcServerResponse struct {
-	TokenEndpoint      string `json:"token_endpoint"`
-	AuthEndpoint       string `json:"authorization_endpoint"`
-	UserInfoEndpoint   string `json:"userinfo_endpoint"`
-	EndSessionEndpoint string `json:"end_session_endpoint"`
+	TokenEndpoint               string `json:"token_endpoint"`
+	AuthEndpoint                string `json:"authorization_endpoint"`
+	UserInfoEndpoint            string `json:"userinfo_endpoint"`
+	EndSessionEndpoint          string `json:"end_session_endpoint"`
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+	RevocationEndpoint          string `json:"revocation_endpoint"`
+	JwksUri                     string `json:"jwks_uri"`
 }
 
+// defaultOIDCScopes are requested from OIDC providers that don't configure scopes
+const defaultOIDCScopes = "openid profile email organization:*"
+
 func getOIDCAuthHandler(provider *v1beta1.AuthProvider, oidcSpec *v1beta1.OIDCProviderSpec) (*OIDCAuthHandler, error) {
 	providerName := extractProviderName(provider)
 
@@ -87,15 +96,18 @@ func getOIDCAuthHandler(provider *v1beta1.AuthProvider, oidcSpec *v1beta1.OIDCPr
 
 	oidcForClient := oidcResponse
 	handler := &OIDCAuthHandler{
-		tlsConfig:              tlsConfig,
-		oidcDiscoveryForClient: oidcForClient,
-		scopes:                 oidcSpec.Scopes,
-		endSessionEndpoint:     oidcResponse.EndSessionEndpoint,
-		userInfoEndpoint:       oidcResponse.UserInfoEndpoint,
-		authURL:                authURL,
-		tokenEndpoint:          oidcResponse.TokenEndpoint,
-		clientId:               clientId,
-		providerName:           providerName,
+		tlsConfig:                   tlsConfig,
+		oidcDiscoveryForClient:      oidcForClient,
+		scopes:                      oidcSpec.Scopes,
+		endSessionEndpoint:          oidcResponse.EndSessionEndpoint,
+		userInfoEndpoint:            oidcResponse.UserInfoEndpoint,
+		authURL:                     authURL,
+		tokenEndpoint:               oidcResponse.TokenEndpoint,
+		deviceAuthorizationEndpoint: oidcResponse.DeviceAuthorizationEndpoint,
+		revocationEndpoint:          oidcResponse.RevocationEndpoint,
+		jwksURI:                     oidcResponse.JwksUri,
+		clientId:                    clientId,
+		providerName:                providerName,
 	}
 
 	if internalAuthURL != nil {
@@ -108,6 +120,8 @@ func getOIDCAuthHandler(provider *v1beta1.AuthProvider, oidcSpec *v1beta1.OIDCPr
 		handler.oidcDiscoveryForClient = extConfig
 		handler.endSessionEndpoint = extConfig.EndSessionEndpoint
 		handler.tokenEndpoint = extConfig.TokenEndpoint
+		handler.deviceAuthorizationEndpoint = replaceBaseURL(oidcResponse.DeviceAuthorizationEndpoint, *internalAuthURL, authURL)
+		handler.revocationEndpoint = replaceBaseURL(oidcResponse.RevocationEndpoint, *internalAuthURL, authURL)
 	}
 
 	return handler, nil
@@ -134,8 +148,7 @@ func replaceBaseURL(endpoint, oldBase, newBase string) string {
 }
 
 func getOIDCClient(oidcConfig oidcServerResponse, tlsConfig *tls.Config, clientId string, providerScopes *[]string, redirectURL string) (*osincli.Client, error) {
-	defaultScopes := "openid profile email organization:*"
-	scope := buildScopeParam(providerScopes, defaultScopes)
+	scope := buildScopeParam(providerScopes, defaultOIDCScopes)
 
 	oidcClientConfig := &osincli.ClientConfig{
 		ClientId:                 clientId,
@@ -124,7 +124,7 @@ func (o *OpenShiftAuthHandler) openshiftClientForRedirect(redirectURI string) (*
 }
 
 func (o *OpenShiftAuthHandler) Logout(token string, _ string) (string, error) {
-	// The cookie will be cleared by the proxy
+	// The access token is deleted by revokeTokens, and the cookie will be cleared by the proxy
 	return "", nil
 }
 
@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	b64 "encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/flightctl/flightctl-ui/common"
+)
+
+// Token type hints sent with revocation requests (RFC 7009 section 2.1)
+const (
+	tokenTypeHintAccessToken  = "access_token"
+	tokenTypeHintRefreshToken = "refresh_token"
+)
+
+// openshiftTokenPrefix marks OpenShift OAuth access tokens whose OAuthAccessToken object is named after their hash
+const openshiftTokenPrefix = "sha256~"
+
+// tokenRevoker is implemented by the providers that can invalidate the tokens of a session on logout
+type tokenRevoker interface {
+	revokeTokens(tokenData TokenData) error
+}
+
+// revokeToken revokes a token at the provider's revocation endpoint (RFC 7009). Confidential clients
+// authenticate with clientAuth; public clients only send their client ID.
+func revokeToken(endpoint string, tlsConfig *tls.Config, providerName string, clientId string, token string, tokenTypeHint string) error {
+	clientAuth, err := loadClientAuth(providerName, clientId)
+	if err != nil {
+		return err
+	}
+	form := url.Values{
+		"token":           {token},
+		"token_type_hint": {tokenTypeHint},
+		"client_id":       {clientId},
+	}
+	var revokeResp struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := postTokenForm(endpoint, form, tlsConfig, clientAuth, &revokeResp)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("revocation of %s failed with status %d: %s %s", tokenTypeHint, status, revokeResp.Error, revokeResp.ErrorDescription)
+	}
+	return nil
+}
+
+// revokeSessionTokens revokes the refresh token of a session, then its access token when the session holds one
+func revokeSessionTokens(endpoint string, tlsConfig *tls.Config, providerName string, clientId string, refreshToken string, accessToken string) error {
+	var errs []error
+	if refreshToken != "" {
+		errs = append(errs, revokeToken(endpoint, tlsConfig, providerName, clientId, refreshToken, tokenTypeHintRefreshToken))
+	}
+	if accessToken != "" {
+		errs = append(errs, revokeToken(endpoint, tlsConfig, providerName, clientId, accessToken, tokenTypeHintAccessToken))
+	}
+	return errors.Join(errs...)
+}
+
+// revokeTokens revokes the refresh token when the provider advertises a revocation endpoint. OIDC
+// sessions keep the ID token rather than the access token, which is short-lived and can't be revoked;
+// revoking the refresh token ends the provider's session for most providers.
+func (o *OIDCAuthHandler) revokeTokens(tokenData TokenData) error {
+	if o.revocationEndpoint == "" {
+		return nil
+	}
+	return revokeSessionTokens(o.revocationEndpoint, o.tlsConfig, o.providerName, o.clientId, tokenData.RefreshToken, "")
+}
+
+// revokeTokens revokes the access and refresh tokens when the issuer's metadata advertises a revocation endpoint
+func (o *OAuth2AuthHandler) revokeTokens(tokenData TokenData) error {
+	metadata, err := o.issuerMetadata()
+	if err != nil {
+		return err
+	}
+	if metadata.RevocationEndpoint == "" {
+		return nil
+	}
+	return revokeSessionTokens(metadata.RevocationEndpoint, o.tlsConfig, o.providerName, o.clientId, tokenData.RefreshToken, tokenData.Token)
+}
+
+// revokeTokens deletes the OAuthAccessToken of the session, as `oc logout` does. OpenShift has no
+// revocation endpoint; deleting the object invalidates the access token.
+func (o *OpenShiftAuthHandler) revokeTokens(tokenData TokenData) error {
+	if tokenData.Token == "" {
+		return nil
+	}
+	tokenURL, err := common.BuildApiUrl(o.apiServerURL, "apis/oauth.openshift.io/v1/oauthaccesstokens", openshiftAccessTokenName(tokenData.Token))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodDelete, tokenURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+tokenData.Token)
+	req.Header.Set("Accept", "application/json")
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: o.tlsConfig,
+		},
+		Timeout: 30 * time.Second,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to delete OAuth access token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// The token is already gone when it expired or was deleted by another logout
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusUnauthorized {
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("deleting OAuth access token failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// openshiftAccessTokenName returns the name of the OAuthAccessToken object of an access token:
+// "sha256~" tokens are stored under the hash of the token, older tokens under the token itself
+func openshiftAccessTokenName(token string) string {
+	secret, found := strings.CutPrefix(token, openshiftTokenPrefix)
+	if !found {
+		return token
+	}
+	sum := sha256.Sum256([]byte(secret))
+	return openshiftTokenPrefix + b64.RawURLEncoding.EncodeToString(sum[:])
+}
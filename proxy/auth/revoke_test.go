@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestOAuth2RevokeTokens(t *testing.T) {
+	var revoked []string
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcServerResponse{RevocationEndpoint: srv.URL + "/revoke"})
+	})
+	mux.HandleFunc("/revoke", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("client_id") != "ui" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		revoked = append(revoked, r.FormValue("token_type_hint")+":"+r.FormValue("token"))
+	})
+
+	handler := &OAuth2AuthHandler{issuer: srv.URL, clientId: "ui", providerName: "sso"}
+	if err := handler.revokeTokens(TokenData{Token: "access", RefreshToken: "refresh"}); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(revoked)
+	if strings.Join(revoked, ",") != "access_token:access,refresh_token:refresh" {
+		t.Fatalf("unexpected revoked tokens %v", revoked)
+	}
+
+	// Without a revocation endpoint, logging out only clears the session
+	if err := (&OAuth2AuthHandler{clientId: "ui"}).revokeTokens(TokenData{Token: "access"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenShiftRevokeTokens(t *testing.T) {
+	var deleted string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete || r.Header.Get("Authorization") != "Bearer sha256~token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		deleted = strings.TrimPrefix(r.URL.Path, "/apis/oauth.openshift.io/v1/oauthaccesstokens/")
+	}))
+	defer srv.Close()
+
+	handler := &OpenShiftAuthHandler{apiServerURL: srv.URL}
+	if err := handler.revokeTokens(TokenData{Token: "sha256~token"}); err != nil {
+		t.Fatal(err)
+	}
+	// sha256 of "token", base64url encoded without padding
+	if deleted != "sha256~PEaenWxYddN6Q_NT1PiOYfz4EsZu7jRXRlpAsNpBU-A" {
+		t.Fatalf("unexpected OAuthAccessToken deleted: %q", deleted)
+	}
+}
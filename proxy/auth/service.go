@@ -0,0 +1,362 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flightctl/flightctl-ui/bridge"
+	"github.com/flightctl/flightctl-ui/common"
+	"github.com/flightctl/flightctl-ui/config"
+	"github.com/flightctl/flightctl-ui/upstream"
+)
+
+var (
+	// ErrServiceSessionExpired is returned for service sessions that ended or were never started
+	ErrServiceSessionExpired = errors.New("service session expired")
+	// ErrOutsideServiceScope is returned for requests a service session is not allowed to send
+	ErrOutsideServiceScope = errors.New("request is outside the scope of the service login")
+
+	errInvalidServiceCredentials = errors.New("invalid client credentials or API token")
+)
+
+// defaultServiceAllowedPaths is the scope of service logins that don't declare allowedPaths
+var defaultServiceAllowedPaths = []string{"/api/flightctl/"}
+
+// sessionPaths are always allowed, so clients of service sessions and of sessions logged out at the
+// provider can check and end their session, and log in again
+var sessionPaths = []string{"/api/login", "/api/login/info", "/api/logout"}
+
+// ServiceLoginParameters are sent by non-browser clients to log in with a service login:
+// a client ID and secret for client-credentials logins, or a token for API token logins.
+type ServiceLoginParameters struct {
+	ClientId     string `json:"clientId,omitempty"`
+	ClientSecret string `json:"clientSecret,omitempty"`
+	Token        string `json:"token,omitempty"`
+}
+
+// serviceLoginsFile describes the service logins, see config.ServiceLoginsFile
+type serviceLoginsFile struct {
+	Providers []serviceProviderEntry `json:"providers"`
+}
+
+type serviceProviderEntry struct {
+	Name string `json:"name"`
+	// TokenUrl, ClientIds and Scopes configure an OAuth2 client-credentials login
+	TokenUrl  string   `json:"tokenUrl,omitempty"`
+	ClientIds []string `json:"clientIds,omitempty"`
+	Scopes    []string `json:"scopes,omitempty"`
+	// ApiTokens configures a static API token login
+	ApiTokens    []serviceAPITokenEntry `json:"apiTokens,omitempty"`
+	AllowedPaths []string               `json:"allowedPaths,omitempty"`
+	ReadOnly     bool                   `json:"readOnly,omitempty"`
+}
+
+type serviceAPITokenEntry struct {
+	Name string `json:"name"`
+	// Sha256 is the hex-encoded SHA-256 of the token presented by the client
+	Sha256 string `json:"sha256"`
+	// UpstreamTokenFile holds the token sent to the Flight Control API on behalf of the client
+	UpstreamTokenFile string `json:"upstreamTokenFile"`
+}
+
+// ServiceAuthProvider logs in non-browser clients, such as CI pipelines, with an OAuth2
+// client-credentials grant or a static API token. The resulting sessions are limited to
+// allowedPaths (and to reads when readOnly), and their upstream token never leaves the proxy.
+type ServiceAuthProvider struct {
+	name         string
+	tokenURL     string
+	clientIds    []string
+	scope        string
+	apiTokens    []serviceAPITokenEntry
+	allowedPaths []string
+	readOnly     bool
+	tlsConfig    *tls.Config
+}
+
+// Logout for service logins just ends the session
+func (s *ServiceAuthProvider) Logout(token string, _ string) (string, error) {
+	return "", nil
+}
+
+// GetLoginRedirectURL is not applicable, service logins are not available to browsers
+func (s *ServiceAuthProvider) GetLoginRedirectURL(state string, codeChallenge string, redirectURI string) (string, error) {
+	return "", fmt.Errorf("service login %s does not support browser logins", s.name)
+}
+
+// authenticate returns the upstream token for the client's credentials, and how long it is valid when known
+func (s *ServiceAuthProvider) authenticate(params ServiceLoginParameters) (string, *int64, error) {
+	if s.tokenURL != "" {
+		if params.ClientId == "" || params.ClientSecret == "" || params.Token != "" {
+			return "", nil, errInvalidServiceCredentials
+		}
+		if len(s.clientIds) > 0 && !slices.Contains(s.clientIds, params.ClientId) {
+			return "", nil, errInvalidServiceCredentials
+		}
+		return s.clientCredentialsToken(params.ClientId, params.ClientSecret)
+	}
+
+	if params.Token == "" || params.ClientId != "" || params.ClientSecret != "" {
+		return "", nil, errInvalidServiceCredentials
+	}
+	sum := sha256.Sum256([]byte(params.Token))
+	presented := hex.EncodeToString(sum[:])
+	for _, apiToken := range s.apiTokens {
+		if subtle.ConstantTimeCompare([]byte(presented), []byte(strings.ToLower(apiToken.Sha256))) != 1 {
+			continue
+		}
+		// Read on every login so rotated upstream tokens are picked up
+		upstreamToken, err := os.ReadFile(apiToken.UpstreamTokenFile)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to read upstream token of API token %s: %w", apiToken.Name, err)
+		}
+		return strings.TrimSpace(string(upstreamToken)), nil, nil
+	}
+	return "", nil, errInvalidServiceCredentials
+}
+
+type clientCredentialsResponse struct {
+	AccessToken      string `json:"access_token"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// clientCredentialsToken requests an access token with the client-credentials grant (RFC 6749 section 4.4)
+func (s *ServiceAuthProvider) clientCredentialsToken(clientId string, clientSecret string) (string, *int64, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if s.scope != "" {
+		form.Set("scope", s.scope)
+	}
+	req, err := http.NewRequest(http.MethodPost, s.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(clientId), url.QueryEscape(clientSecret))
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: s.tlsConfig,
+		},
+		Timeout: 30 * time.Second,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to call token endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read token response: %w", err)
+	}
+	tokenResp := clientCredentialsResponse{}
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return "", nil, fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+	switch {
+	case tokenResp.Error == "invalid_client" || tokenResp.Error == "unauthorized_client" || resp.StatusCode == http.StatusUnauthorized:
+		return "", nil, errInvalidServiceCredentials
+	case tokenResp.Error != "":
+		return "", nil, fmt.Errorf("oauth2 error: %s - %s", tokenResp.Error, tokenResp.ErrorDescription)
+	case resp.StatusCode != http.StatusOK || tokenResp.AccessToken == "":
+		return "", nil, fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+
+	if tokenResp.ExpiresIn > 0 {
+		return tokenResp.AccessToken, &tokenResp.ExpiresIn, nil
+	}
+	return tokenResp.AccessToken, nil, nil
+}
+
+// allows reports whether a service session may send the request
+func (s *ServiceAuthProvider) allows(r *http.Request) bool {
+	if s.readOnly && r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	for _, allowed := range s.allowedPaths {
+		if pathHasPrefix(r.URL.Path, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathHasPrefix matches whole path segments, so /api/v1/devices does not match /api/v1/devicesX
+func pathHasPrefix(path string, prefix string) bool {
+	if strings.HasSuffix(prefix, "/") {
+		return strings.HasPrefix(path, prefix)
+	}
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+type serviceSession struct {
+	provider *ServiceAuthProvider
+	// backend is the name of the backend the upstream token was validated by. The token is held by the
+	// proxy, so it is bound to its backend here rather than by the session cookie, which clients can edit.
+	backend string
+	token   string
+	expires time.Time
+}
+
+// ServiceLogins holds the service logins and their sessions. Sessions are kept in memory: they
+// end when the proxy restarts, and are only known to the replica that started them.
+type ServiceLogins struct {
+	providers map[string]*ServiceAuthProvider
+
+	mu       sync.Mutex
+	sessions map[string]*serviceSession
+}
+
+// LoadServiceLogins reads the service logins from config.ServiceLoginsFile. Without the file, no service logins are available.
+func LoadServiceLogins() (*ServiceLogins, error) {
+	if config.ServiceLoginsFile == "" {
+		return newServiceLogins(serviceLoginsFile{}, nil)
+	}
+
+	content, err := os.ReadFile(config.ServiceLoginsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service logins file: %w", err)
+	}
+	var file serviceLoginsFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse service logins file: %w", err)
+	}
+	tlsConfig, err := bridge.GetAuthTlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	return newServiceLogins(file, tlsConfig)
+}
+
+func newServiceLogins(file serviceLoginsFile, tlsConfig *tls.Config) (*ServiceLogins, error) {
+	s := &ServiceLogins{
+		providers: map[string]*ServiceAuthProvider{},
+		sessions:  map[string]*serviceSession{},
+	}
+	for _, entry := range file.Providers {
+		if !common.IsSafeResourceName(entry.Name) {
+			return nil, fmt.Errorf("invalid service login name %q", entry.Name)
+		}
+		if _, exists := s.providers[entry.Name]; exists {
+			return nil, fmt.Errorf("duplicate service login name %q", entry.Name)
+		}
+		if (entry.TokenUrl == "") == (len(entry.ApiTokens) == 0) {
+			return nil, fmt.Errorf("service login %s must define either tokenUrl or apiTokens", entry.Name)
+		}
+		if entry.TokenUrl != "" {
+			if u, err := url.Parse(entry.TokenUrl); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, fmt.Errorf("service login %s has an invalid tokenUrl", entry.Name)
+			}
+		}
+		for _, apiToken := range entry.ApiTokens {
+			if sum, err := hex.DecodeString(apiToken.Sha256); err != nil || len(sum) != sha256.Size {
+				return nil, fmt.Errorf("API token %s of service login %s has an invalid sha256", apiToken.Name, entry.Name)
+			}
+			if apiToken.UpstreamTokenFile == "" {
+				return nil, fmt.Errorf("API token %s of service login %s is missing upstreamTokenFile", apiToken.Name, entry.Name)
+			}
+		}
+		allowedPaths := entry.AllowedPaths
+		if len(allowedPaths) == 0 {
+			allowedPaths = defaultServiceAllowedPaths
+		}
+		for _, path := range allowedPaths {
+			if !strings.HasPrefix(path, "/api/") {
+				return nil, fmt.Errorf("service login %s has an allowed path outside /api/: %s", entry.Name, path)
+			}
+		}
+
+		s.providers[entry.Name] = &ServiceAuthProvider{
+			name:         entry.Name,
+			tokenURL:     entry.TokenUrl,
+			clientIds:    entry.ClientIds,
+			scope:        strings.Join(entry.Scopes, " "),
+			apiTokens:    entry.ApiTokens,
+			allowedPaths: allowedPaths,
+			readOnly:     entry.ReadOnly,
+			tlsConfig:    tlsConfig,
+		}
+	}
+	return s, nil
+}
+
+// Provider returns the service login with the given name
+func (s *ServiceLogins) Provider(name string) (*ServiceAuthProvider, bool) {
+	provider, ok := s.providers[name]
+	return provider, ok
+}
+
+// startSession keeps the upstream token of the backend for ttl and returns the ID of the new session
+func (s *ServiceLogins) startSession(provider *ServiceAuthProvider, backend string, token string, ttl time.Duration) (string, error) {
+	id, err := generateState()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sessionID, session := range s.sessions {
+		if now.After(session.expires) {
+			delete(s.sessions, sessionID)
+		}
+	}
+	s.sessions[id] = &serviceSession{provider: provider, backend: backend, token: token, expires: now.Add(ttl)}
+	return id, nil
+}
+
+func (s *ServiceLogins) session(id string) (*serviceSession, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(session.expires) {
+		delete(s.sessions, id)
+		return nil, false
+	}
+	return session, true
+}
+
+func (s *ServiceLogins) endSession(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+}
+
+// AuthorizeRequest returns the upstream token of the service session the request was sent with.
+// It fails with ErrServiceSessionExpired when the session ended, with ErrForeignBackend when the
+// request selects another backend than the session's, and with ErrOutsideServiceScope when the
+// request is not allowed to the session. Logging in and out is always possible: there the token is
+// empty when the session ended or belongs to another backend.
+func (s *ServiceLogins) AuthorizeRequest(backends *upstream.Registry, r *http.Request, sessionID string) (string, error) {
+	isSessionPath := slices.Contains(sessionPaths, strings.TrimSuffix(r.URL.Path, "/"))
+	session, ok := s.session(sessionID)
+	isForeignBackend := ok && session.backend != backends.ForRequest(r).Name
+	switch {
+	case (!ok || isForeignBackend) && isSessionPath:
+		return "", nil
+	case !ok:
+		return "", ErrServiceSessionExpired
+	case isForeignBackend:
+		return "", ErrForeignBackend
+	case !isSessionPath && !session.provider.allows(r):
+		return "", ErrOutsideServiceScope
+	}
+	return session.token, nil
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/flightctl/flightctl-ui/upstream"
+)
+
+func TestServiceLoginClientCredentials(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientId, clientSecret, _ := r.BasicAuth()
+		if r.FormValue("grant_type") != "client_credentials" || r.FormValue("scope") != "openid flightctl" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_request"}`))
+			return
+		}
+		if clientId != "ci" || clientSecret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"invalid_client"}`))
+			return
+		}
+		w.Write([]byte(`{"access_token":"upstream-token","token_type":"Bearer","expires_in":300}`))
+	}))
+	defer tokenServer.Close()
+
+	logins, err := newServiceLogins(serviceLoginsFile{Providers: []serviceProviderEntry{{
+		Name:      "ci",
+		TokenUrl:  tokenServer.URL,
+		ClientIds: []string{"ci"},
+		Scopes:    []string{"openid", "flightctl"},
+	}}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider, _ := logins.Provider("ci")
+
+	token, expiresIn, err := provider.authenticate(ServiceLoginParameters{ClientId: "ci", ClientSecret: "s3cret"})
+	if err != nil || token != "upstream-token" || expiresIn == nil || *expiresIn != 300 {
+		t.Fatalf("unexpected login result: %q %v %v", token, expiresIn, err)
+	}
+	if _, _, err := provider.authenticate(ServiceLoginParameters{ClientId: "ci", ClientSecret: "wrong"}); !errors.Is(err, errInvalidServiceCredentials) {
+		t.Fatalf("expected invalid credentials, got %v", err)
+	}
+	if _, _, err := provider.authenticate(ServiceLoginParameters{ClientId: "other", ClientSecret: "s3cret"}); !errors.Is(err, errInvalidServiceCredentials) {
+		t.Fatalf("expected clients outside clientIds to be rejected, got %v", err)
+	}
+}
+
+func TestServiceLoginAPIToken(t *testing.T) {
+	upstreamTokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(upstreamTokenFile, []byte("upstream-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("api-token"))
+
+	logins, err := newServiceLogins(serviceLoginsFile{Providers: []serviceProviderEntry{{
+		Name:         "pipeline",
+		ApiTokens:    []serviceAPITokenEntry{{Name: "jenkins", Sha256: hex.EncodeToString(sum[:]), UpstreamTokenFile: upstreamTokenFile}},
+		AllowedPaths: []string{"/api/flightctl/api/v1/devices"},
+		ReadOnly:     true,
+	}}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider, _ := logins.Provider("pipeline")
+
+	token, _, err := provider.authenticate(ServiceLoginParameters{Token: "api-token"})
+	if err != nil || token != "upstream-token" {
+		t.Fatalf("unexpected login result: %q %v", token, err)
+	}
+	if _, _, err := provider.authenticate(ServiceLoginParameters{Token: "other"}); !errors.Is(err, errInvalidServiceCredentials) {
+		t.Fatalf("expected invalid token, got %v", err)
+	}
+
+	backends, err := upstream.NewRegistry([]*upstream.Backend{
+		{Name: "prod", ApiUrl: "https://prod.example.com"},
+		{Name: "staging", ApiUrl: "https://staging.example.com"},
+	}, "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionID, err := logins.startSession(provider, "prod", token, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		method  string
+		path    string
+		session string
+		want    error
+	}{
+		{method: http.MethodGet, path: "/api/flightctl/api/v1/devices/dev1", session: sessionID},
+		{method: http.MethodGet, path: "/api/flightctl/api/v1/devicesX", session: sessionID, want: ErrOutsideServiceScope},
+		{method: http.MethodDelete, path: "/api/flightctl/api/v1/devices/dev1", session: sessionID, want: ErrOutsideServiceScope},
+		{method: http.MethodGet, path: "/api/flightctl/api/v1/fleets", session: sessionID, want: ErrOutsideServiceScope},
+		{method: http.MethodPost, path: "/api/logout", session: sessionID},
+		{method: http.MethodGet, path: "/api/flightctl/api/v1/devices", session: "unknown", want: ErrServiceSessionExpired},
+	}
+	for _, tt := range tests {
+		_, err := logins.AuthorizeRequest(backends, httptest.NewRequest(tt.method, tt.path, nil), tt.session)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s %s: expected %v, got %v", tt.method, tt.path, tt.want, err)
+		}
+	}
+
+	// The session cookie can be edited by the client: the session is bound to its backend by the proxy
+	tampered := TokenData{Provider: "pipeline", ServiceSession: sessionID, Backend: "staging"}
+	staging, _ := backends.Get("staging")
+	req := httptest.NewRequest(http.MethodGet, "/api/flightctl/api/v1/devices", nil)
+	req = req.WithContext(upstream.WithBackend(req.Context(), staging))
+	if err := AuthorizeSessionBackend(backends, req, tampered); err != nil {
+		t.Fatalf("expected the tampered cookie to match the selected backend, got %v", err)
+	}
+	if token, err := logins.AuthorizeRequest(backends, req, sessionID); !errors.Is(err, ErrForeignBackend) || token != "" {
+		t.Fatalf("expected the upstream token not to be sent to another backend, got %q %v", token, err)
+	}
+
+	logins.endSession(sessionID)
+	if token, err := logins.AuthorizeRequest(backends, httptest.NewRequest(http.MethodPost, "/api/login", nil), sessionID); err != nil || token != "" {
+		t.Fatalf("expected ended sessions to be able to log in again, got %q %v", token, err)
+	}
+}
+
+func TestNewServiceLoginsRejectsInvalidProviders(t *testing.T) {
+	for name, entry := range map[string]serviceProviderEntry{
+		"no grant":     {Name: "ci"},
+		"both grants":  {Name: "ci", TokenUrl: "https://sso.example.com/token", ApiTokens: []serviceAPITokenEntry{{Name: "t", Sha256: "00", UpstreamTokenFile: "f"}}},
+		"bad hash":     {Name: "ci", ApiTokens: []serviceAPITokenEntry{{Name: "t", Sha256: "00", UpstreamTokenFile: "f"}}},
+		"bad path":     {Name: "ci", TokenUrl: "https://sso.example.com/token", AllowedPaths: []string{"/"}},
+		"unsafe name":  {Name: "../ci", TokenUrl: "https://sso.example.com/token"},
+		"bad tokenUrl": {Name: "ci", TokenUrl: "sso.example.com/token"},
+	} {
+		if _, err := newServiceLogins(serviceLoginsFile{Providers: []serviceProviderEntry{entry}}, nil); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
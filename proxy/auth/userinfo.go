@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/flightctl/flightctl/api/v1beta1"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+// UserOrganization is an organization the user belongs to
+type UserOrganization struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName,omitempty"`
+}
+
+// buildUserInfo completes the user info returned by the Flight Control API with the claims of the
+// session's token, when it is a JWT
+func (a AuthHandler) buildUserInfo(tokenData TokenData, token string, apiUserInfo *v1beta1.UserInfoResponse, username string) UserInfoResponse {
+	userInfo := UserInfoResponse{
+		Username: username,
+		Provider: tokenData.Provider,
+	}
+	if apiUserInfo.Name != nil {
+		userInfo.DisplayName = *apiUserInfo.Name
+	}
+
+	// Tokens were validated by the API server; their claims only describe the user here
+	var claims map[string]interface{}
+	if parsedToken, err := jwt.ParseInsecure([]byte(token)); err == nil {
+		claims, _ = parsedToken.AsMap(context.Background())
+		if exp := parsedToken.Expiration(); !exp.IsZero() {
+			userInfo.SessionExpiresAt = &exp
+		}
+	}
+	if userInfo.DisplayName == "" {
+		userInfo.DisplayName, _ = claims["name"].(string)
+	}
+	userInfo.Email, _ = claims["email"].(string)
+	userInfo.Groups = stringValues(claims["groups"])
+
+	if tokenData.ServiceSession != "" {
+		if session, ok := a.serviceLogins.session(tokenData.ServiceSession); ok {
+			userInfo.SessionExpiresAt = &session.expires
+		}
+	}
+
+	if apiUserInfo.Organizations != nil {
+		for _, org := range *apiUserInfo.Organizations {
+			if org.Metadata.Name == nil {
+				continue
+			}
+			userOrg := UserOrganization{Name: *org.Metadata.Name}
+			if org.Spec != nil && org.Spec.DisplayName != nil {
+				userOrg.DisplayName = *org.Spec.DisplayName
+			}
+			userInfo.Organizations = append(userInfo.Organizations, userOrg)
+		}
+	}
+	return userInfo
+}
+
+// stringValues returns the strings of a claim holding a string or a list of strings
+func stringValues(claim interface{}) []string {
+	switch v := claim.(type) {
+	case string:
+		if v != "" {
+			return []string{v}
+		}
+	case []string:
+		return v
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok && s != "" {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/flightctl/flightctl-ui/log"
+	"github.com/flightctl/flightctl-ui/upstream"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+)
+
+func TestGetUserInfo(t *testing.T) {
+	log.InitLogs()
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	mux.HandleFunc("/api/v1/auth/config", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("expected the user info not to need the auth config")
+	})
+	mux.HandleFunc("/api/v1/auth/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"preferred_username":"alice","name":"Alice Doe","organizations":[
+			{"metadata":{"name":"factory"},"spec":{"displayName":"Factory"}},
+			{"metadata":{"name":"lab"}}]}`))
+	})
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := jwk.FromRaw(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expires := time.Now().Add(5 * time.Minute).Truncate(time.Second)
+	idToken := signToken(t, key, map[string]interface{}{
+		"iss":    srv.URL,
+		"sub":    "alice",
+		"exp":    expires,
+		"email":  "alice@example.com",
+		"groups": []string{"operators"},
+	})
+
+	backends, err := upstream.NewRegistry([]*upstream.Backend{{Name: "default", ApiUrl: srv.URL}}, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := AuthHandler{backends: backends}
+	rec := httptest.NewRecorder()
+	if err := setCookie(rec, httptest.NewRequest(http.MethodGet, "/", nil), TokenData{Token: idToken, Provider: "sso"}); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/login/info", nil)
+	req.AddCookie(rec.Result().Cookies()[0])
+	rec = httptest.NewRecorder()
+	handler.GetUserInfo(rec, req)
+
+	var userInfo UserInfoResponse
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &userInfo) != nil {
+		t.Fatalf("unexpected response %d: %s", rec.Code, rec.Body.String())
+	}
+	if userInfo.Username != "alice" || userInfo.DisplayName != "Alice Doe" || userInfo.Email != "alice@example.com" || userInfo.Provider != "sso" {
+		t.Fatalf("unexpected user info %+v", userInfo)
+	}
+	if !reflect.DeepEqual(userInfo.Groups, []string{"operators"}) || userInfo.SessionExpiresAt == nil || !userInfo.SessionExpiresAt.Equal(expires) {
+		t.Fatalf("unexpected groups or session expiry %+v", userInfo)
+	}
+	expectedOrgs := []UserOrganization{{Name: "factory", DisplayName: "Factory"}, {Name: "lab"}}
+	if !reflect.DeepEqual(userInfo.Organizations, expectedOrgs) {
+		t.Fatalf("unexpected organizations %+v", userInfo.Organizations)
+	}
+}
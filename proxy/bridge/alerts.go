@@ -0,0 +1,159 @@
+package bridge
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/flightctl/flightctl-ui/alertmanager"
+	"github.com/flightctl/flightctl-ui/common"
+	"github.com/flightctl/flightctl-ui/log"
+)
+
+const (
+	alertsSilencesPath = "api/v2/silences"
+	alertsSilencePath  = "api/v2/silence/"
+	// maxSilenceBodySize bounds the silence payloads the proxy reads to enforce the organization
+	maxSilenceBodySize = 1 << 20
+)
+
+// alertsScopedReads are the AlertManager reads that OrganizationMiddleware scopes to the organization
+// through their filters. Other reads (status, receivers, ...) aren't tenant-scoped and are refused.
+var alertsScopedReads = []string{"api/v2/alerts", "api/v2/alerts/groups", alertsSilencesPath}
+
+// alertsTenantHandler keeps AlertManager silences within the selected organization: created silences
+// always carry the organization matcher, and only the organization's silences can be read, updated or expired.
+// Listing is scoped by OrganizationMiddleware, which adds the organization to the AlertManager filters;
+// requests that can't be scoped to the organization are refused.
+type alertsTenantHandler struct {
+	next     http.Handler
+	silences *alertmanager.Client
+}
+
+func (h alertsTenantHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	forward := strings.Trim(mux.Vars(r)["forward"], "/")
+	silenceID, isSilencePath := strings.CutPrefix(forward, alertsSilencePath)
+	isCreate := r.Method == http.MethodPost && forward == alertsSilencesPath
+	isSilence := (r.Method == http.MethodGet || r.Method == http.MethodDelete) && isSilencePath && silenceID != ""
+	if r.Method == http.MethodGet && slices.Contains(alertsScopedReads, forward) {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	if !isCreate && !isSilence {
+		common.RespondWithJSONError(w, http.StatusForbidden, "AlertManager endpoint is not available per organization", "ORGANIZATION_FORBIDDEN")
+		return
+	}
+
+	orgID, ok := common.OrganizationIDFromContext(r.Context())
+	if !ok {
+		common.RespondWithJSONError(w, http.StatusPreconditionRequired, "Organization selection required", "ORGANIZATION_REQUIRED")
+		return
+	}
+
+	if isCreate {
+		if !h.scopeSilenceRequest(w, r, orgID) {
+			return
+		}
+	} else if !h.checkSilenceOwnership(w, r, silenceID, orgID) {
+		return
+	}
+	h.next.ServeHTTP(w, r)
+}
+
+// scopeSilenceRequest rewrites the silence in the request body so its matchers are restricted to the organization.
+// It responds with an error and returns false when the silence can't be created in the organization.
+func (h alertsTenantHandler) scopeSilenceRequest(w http.ResponseWriter, r *http.Request, orgID string) bool {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSilenceBodySize))
+	if common.IsBodyTooLarge(err) {
+		common.RespondWithBodyTooLarge(w)
+		return false
+	}
+	if err != nil {
+		common.RespondWithJSONError(w, http.StatusBadRequest, "Failed to read silence", "INVALID_SILENCE")
+		return false
+	}
+	var silence map[string]json.RawMessage
+	if err := json.Unmarshal(body, &silence); err != nil {
+		common.RespondWithJSONError(w, http.StatusBadRequest, "Invalid silence", "INVALID_SILENCE")
+		return false
+	}
+	var matchers []alertmanager.Matcher
+	if err := json.Unmarshal(silence["matchers"], &matchers); err != nil {
+		common.RespondWithJSONError(w, http.StatusBadRequest, "Invalid silence matchers", "INVALID_SILENCE")
+		return false
+	}
+	if !respondOnMatcherError(w, func() error {
+		matchers, err = alertmanager.ScopeMatchers(matchers, orgID)
+		return err
+	}) {
+		return false
+	}
+
+	// Posting a silence with an ID replaces the existing silence
+	var silenceID string
+	if raw, ok := silence["id"]; ok && json.Unmarshal(raw, &silenceID) == nil && silenceID != "" {
+		if !h.checkSilenceOwnership(w, r, silenceID, orgID) {
+			return false
+		}
+	}
+
+	silence["matchers"], err = json.Marshal(matchers)
+	if err == nil {
+		body, err = json.Marshal(silence)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return false
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return true
+}
+
+// checkSilenceOwnership responds with an error and returns false unless the silence belongs to the organization.
+func (h alertsTenantHandler) checkSilenceOwnership(w http.ResponseWriter, r *http.Request, silenceID, orgID string) bool {
+	_, err := h.silences.GetSilence(r.Context(), r.Header.Get(common.AuthHeaderKey), orgID, silenceID)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, alertmanager.ErrNotFound):
+		// Silences of other organizations are reported as not found too
+		common.RespondWithJSONError(w, http.StatusNotFound, "Silence not found", "SILENCE_NOT_FOUND")
+	case errors.Is(err, alertmanager.ErrUnavailable):
+		UnimplementedHandler(w, r)
+	default:
+		log.GetLogger().WithError(err).Warn("Failed to get silence from AlertManager")
+		common.RespondWithJSONError(w, http.StatusBadGateway, "Failed to get silence", "ALERTS_UNAVAILABLE")
+	}
+	return false
+}
+
+// respondOnMatcherError runs validate and maps its error to a response. Returns true when there was no error.
+func respondOnMatcherError(w http.ResponseWriter, validate func() error) bool {
+	err := validate()
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, alertmanager.ErrForeignOrganization):
+		common.RespondWithJSONError(w, http.StatusForbidden, "Silences cannot target other organizations", "ORGANIZATION_FORBIDDEN")
+	default:
+		common.RespondWithJSONError(w, http.StatusBadRequest, err.Error(), "INVALID_SILENCE")
+	}
+	return false
+}
+
+func newAlertsTenantHandler(next http.Handler, target *url.URL, transport http.RoundTripper) alertsTenantHandler {
+	return alertsTenantHandler{
+		next:     next,
+		silences: alertmanager.NewClient(target, transport),
+	}
+}
@@ -0,0 +1,59 @@
+package bridge
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/flightctl/flightctl-ui/common"
+)
+
+func TestAlertsTenantHandlerReads(t *testing.T) {
+	const ownSilence = "0b7ee2c4-4f4c-4d3e-9a7d-6c0c8a1d5a11"
+	const foreignSilence = "5f0a4d9e-2d2b-4f5e-8d0b-1b9e8f6e7c22"
+	alertManager := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2/silence/" + ownSilence:
+			w.Write([]byte(`{"id":"` + ownSilence + `","matchers":[{"name":"org_id","value":"org-1","isRegex":false,"isEqual":true}]}`))
+		case "/api/v2/silence/" + foreignSilence:
+			w.Write([]byte(`{"id":"` + foreignSilence + `","matchers":[{"name":"org_id","value":"org-2","isRegex":false,"isEqual":true}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer alertManager.Close()
+	target, err := url.Parse(alertManager.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forwarded := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { forwarded++ })
+	handler := newAlertsTenantHandler(next, target, http.DefaultTransport)
+
+	for _, c := range []struct {
+		forward   string
+		status    int
+		forwarded bool
+	}{
+		{"api/v2/alerts", http.StatusOK, true},
+		{"api/v2/alerts/groups", http.StatusOK, true},
+		{"api/v2/silences", http.StatusOK, true},
+		{"api/v2/silence/" + ownSilence, http.StatusOK, true},
+		{"api/v2/silence/" + foreignSilence, http.StatusNotFound, false},
+		{"api/v2/status", http.StatusForbidden, false},
+		{"api/v2/receivers", http.StatusForbidden, false},
+	} {
+		forwarded = 0
+		req := httptest.NewRequest(http.MethodGet, "/api/alerts/"+c.forward, nil)
+		req = mux.SetURLVars(req, map[string]string{"forward": c.forward})
+		req = req.WithContext(common.WithOrganizationID(req.Context(), "org-1"))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != c.status || (forwarded == 1) != c.forwarded {
+			t.Fatalf("GET %s: expected %d (forwarded=%v), got %d (forwarded=%d)", c.forward, c.status, c.forwarded, rec.Code, forwarded)
+		}
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/flightctl/flightctl-ui/common"
 	"github.com/flightctl/flightctl-ui/config"
@@ -14,61 +16,209 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-const appConsoleTypeSerial = "serial"
+const (
+	appConsoleTypeSerial = "serial"
+	appConsoleTypeExec   = "exec"
+	appConsoleTypeAttach = "attach"
+	appConsoleTypeVNC    = "vnc"
 
-// allowedAppConsoleClientQueryParams are query keys the UI may send to the proxy.
-// org_id and force are forwarded to remote-access when present.
+	maxAppConsoleCommandArgs   = 16
+	maxAppConsoleCommandArgLen = 256
+	maxAppConsoleTTYDimension  = 1000
+)
+
+// allowedAppConsoleClientQueryParams are query keys the UI may send to the proxy for any console type.
+// org_id and force are forwarded to remote-access when present; resume is handled by the proxy.
 var allowedAppConsoleClientQueryParams = map[string]struct{}{
-	"org_id": {},
-	"force":  {},
+	"org_id":                 {},
+	"force":                  {},
+	"consoleType":            {},
+	terminalResumeQueryParam: {},
+}
+
+// appConsoleTypeParams lists the supported console types and the type-specific query keys each accepts.
+//   - serial: VM serial console
+//   - exec: runs command in a container, optionally with a TTY of cols x rows
+//   - attach: attaches to the container's main process, optionally with a TTY of cols x rows
+//   - vnc: VM graphical console (binary RFB stream)
+var appConsoleTypeParams = map[string]map[string]struct{}{
+	appConsoleTypeSerial: {},
+	appConsoleTypeExec:   {"command": {}, "tty": {}, "cols": {}, "rows": {}},
+	appConsoleTypeAttach: {"tty": {}, "cols": {}, "rows": {}},
+	appConsoleTypeVNC:    {},
+}
+
+// appConsoleClientQuery holds the validated query parameters sent by the UI.
+type appConsoleClientQuery struct {
+	force       bool
+	orgID       string
+	resumeID    string
+	consoleType string
+	command     []string
+	tty         bool
+	cols        int
+	rows        int
 }
 
 // parseAppConsoleClientQuery validates client query parameters against an allow-list
-// and returns whether a forced session takeover was requested and the org ID, if any.
-func parseAppConsoleClientQuery(rawQuery string) (force bool, orgID string, err error) {
+// and returns whether a forced session takeover was requested, the org ID, the resume token
+// and the console type with its type-specific parameters.
+// consoleType defaults to serial for clients that predate the other console types.
+func parseAppConsoleClientQuery(rawQuery string) (appConsoleClientQuery, error) {
+	result := appConsoleClientQuery{consoleType: appConsoleTypeSerial}
 	if rawQuery == "" {
-		return false, "", nil
+		return result, nil
 	}
 
 	parsedQuery, err := url.ParseQuery(rawQuery)
 	if err != nil {
-		return false, "", fmt.Errorf("invalid query string: %w", err)
+		return appConsoleClientQuery{}, fmt.Errorf("invalid query string: %w", err)
+	}
+
+	if typeValues, ok := parsedQuery["consoleType"]; ok {
+		if len(typeValues) != 1 {
+			return appConsoleClientQuery{}, fmt.Errorf("invalid consoleType parameter")
+		}
+		if _, supported := appConsoleTypeParams[typeValues[0]]; !supported {
+			return appConsoleClientQuery{}, fmt.Errorf("unsupported consoleType: %q", typeValues[0])
+		}
+		result.consoleType = typeValues[0]
 	}
+	typeParams := appConsoleTypeParams[result.consoleType]
 
 	for key := range parsedQuery {
-		if _, ok := allowedAppConsoleClientQueryParams[key]; !ok {
-			return false, "", fmt.Errorf("unsupported query parameter: %q", key)
+		if _, ok := allowedAppConsoleClientQueryParams[key]; ok {
+			continue
+		}
+		if _, ok := typeParams[key]; ok {
+			continue
 		}
+		return appConsoleClientQuery{}, fmt.Errorf("unsupported query parameter for %s console: %q", result.consoleType, key)
 	}
 
 	orgValues, hasOrgID := parsedQuery["org_id"]
 	if hasOrgID {
 		if len(orgValues) != 1 || orgValues[0] == "" {
-			return false, "", fmt.Errorf("invalid org_id parameter")
+			return appConsoleClientQuery{}, fmt.Errorf("invalid org_id parameter")
 		}
 		if _, err := uuid.Parse(orgValues[0]); err != nil {
-			return false, "", fmt.Errorf("invalid org_id parameter")
+			return appConsoleClientQuery{}, fmt.Errorf("invalid org_id parameter")
 		}
-		orgID = orgValues[0]
+		result.orgID = orgValues[0]
 	}
 
-	forceValues, hasForce := parsedQuery["force"]
-	if !hasForce {
-		return false, orgID, nil
+	result.resumeID, err = parseTerminalResumeID(parsedQuery)
+	if err != nil {
+		return appConsoleClientQuery{}, err
 	}
-	if len(forceValues) != 1 || forceValues[0] != "true" {
-		return false, "", fmt.Errorf("invalid force parameter")
+
+	if forceValues, hasForce := parsedQuery["force"]; hasForce {
+		if len(forceValues) != 1 || forceValues[0] != "true" {
+			return appConsoleClientQuery{}, fmt.Errorf("invalid force parameter")
+		}
+		result.force = true
 	}
 
-	return true, orgID, nil
+	if commandValues, ok := parsedQuery["command"]; ok {
+		if err := validateAppConsoleCommand(commandValues); err != nil {
+			return appConsoleClientQuery{}, err
+		}
+		result.command = commandValues
+	} else if result.consoleType == appConsoleTypeExec {
+		return appConsoleClientQuery{}, fmt.Errorf("command parameter is required for exec console")
+	}
+
+	if ttyValues, ok := parsedQuery["tty"]; ok {
+		if len(ttyValues) != 1 || (ttyValues[0] != "true" && ttyValues[0] != "false") {
+			return appConsoleClientQuery{}, fmt.Errorf("invalid tty parameter")
+		}
+		result.tty = ttyValues[0] == "true"
+	}
+
+	if result.cols, err = parseAppConsoleTTYDimension(parsedQuery, "cols"); err != nil {
+		return appConsoleClientQuery{}, err
+	}
+	if result.rows, err = parseAppConsoleTTYDimension(parsedQuery, "rows"); err != nil {
+		return appConsoleClientQuery{}, err
+	}
+	if (result.cols != 0 || result.rows != 0) && !result.tty {
+		return appConsoleClientQuery{}, fmt.Errorf("cols and rows require tty=true")
+	}
+
+	return result, nil
 }
 
-// buildAppConsoleURL constructs a websocket URL for an application serial console endpoint.
-// Currently serial console is only supported for VM applications.
-// consoleType is always set server-side; org_id and force may be forwarded from the client.
-func buildAppConsoleURL(basePath string, force bool, orgID string) (string, error) {
+// validateAppConsoleCommand checks the argv of an exec console. Each value of the command
+// parameter is one argument; arguments are passed to the container runtime without a shell.
+func validateAppConsoleCommand(args []string) error {
+	if len(args) == 0 || len(args) > maxAppConsoleCommandArgs {
+		return fmt.Errorf("invalid command parameter")
+	}
+	if args[0] == "" {
+		return fmt.Errorf("invalid command parameter")
+	}
+	for _, arg := range args {
+		if len(arg) > maxAppConsoleCommandArgLen {
+			return fmt.Errorf("invalid command parameter")
+		}
+		for _, c := range arg {
+			if unicode.IsControl(c) {
+				return fmt.Errorf("invalid command parameter")
+			}
+		}
+	}
+	return nil
+}
+
+// parseAppConsoleTTYDimension parses an optional terminal dimension. Zero means not set.
+func parseAppConsoleTTYDimension(query url.Values, key string) (int, error) {
+	values, ok := query[key]
+	if !ok {
+		return 0, nil
+	}
+	if len(values) != 1 {
+		return 0, fmt.Errorf("invalid %s parameter", key)
+	}
+	value, err := strconv.Atoi(values[0])
+	if err != nil || value < 1 || value > maxAppConsoleTTYDimension {
+		return 0, fmt.Errorf("invalid %s parameter", key)
+	}
+	return value, nil
+}
+
+// buildAppConsoleURL constructs a websocket URL for an application console endpoint.
+// Serial and VNC consoles are only supported for VM applications; exec and attach for container applications.
+// Only validated parameters are forwarded to remote-access.
+func buildAppConsoleURL(remoteAccessUrl, basePath string, clientQuery appConsoleClientQuery) (string, error) {
+	consoleType := clientQuery.consoleType
+	if consoleType == "" {
+		consoleType = appConsoleTypeSerial
+	}
+	query := url.Values{"consoleType": {consoleType}}
+	if clientQuery.orgID != "" {
+		query.Set("org_id", clientQuery.orgID)
+	}
+	if clientQuery.force {
+		query.Set("force", "true")
+	}
+	for _, arg := range clientQuery.command {
+		query.Add("command", arg)
+	}
+	if clientQuery.tty {
+		query.Set("tty", "true")
+		if clientQuery.cols != 0 {
+			query.Set("cols", strconv.Itoa(clientQuery.cols))
+		}
+		if clientQuery.rows != 0 {
+			query.Set("rows", strconv.Itoa(clientQuery.rows))
+		}
+	}
+	return buildRemoteAccessURL(remoteAccessUrl, basePath, query)
+}
 
-	baseURL, err := url.Parse(config.FctlRemoteAccessUrl)
+// buildRemoteAccessURL constructs a websocket URL on the remote access service for the given path and query.
+func buildRemoteAccessURL(remoteAccessUrl, basePath string, query url.Values) (string, error) {
+	baseURL, err := url.Parse(remoteAccessUrl)
 	if err != nil {
 		return "", fmt.Errorf("invalid remote access URL: %w", err)
 	}
@@ -78,21 +228,13 @@ func buildAppConsoleURL(basePath string, force bool, orgID string) (string, erro
 		wsScheme = "ws"
 	}
 
-	consoleURL := &url.URL{
-		Scheme: wsScheme,
-		Host:   baseURL.Host,
-		Path:   basePath,
-	}
-	query := url.Values{"consoleType": {appConsoleTypeSerial}}
-	if orgID != "" {
-		query.Set("org_id", orgID)
+	remoteURL := &url.URL{
+		Scheme:   wsScheme,
+		Host:     baseURL.Host,
+		Path:     basePath,
+		RawQuery: query.Encode(),
 	}
-	if force {
-		query.Set("force", "true")
-	}
-	consoleURL.RawQuery = query.Encode()
-
-	return consoleURL.String(), nil
+	return remoteURL.String(), nil
 }
 
 func (t TerminalBridge) HandleAppTerminal(w http.ResponseWriter, r *http.Request) {
@@ -114,7 +256,7 @@ func (t TerminalBridge) HandleAppTerminal(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	force, orgID, err := parseAppConsoleClientQuery(r.URL.RawQuery)
+	clientQuery, err := parseAppConsoleClientQuery(r.URL.RawQuery)
 	if err != nil {
 		log.Warnf("Failed to parse app console query: %v", err)
 		w.WriteHeader(http.StatusBadRequest)
@@ -122,13 +264,28 @@ func (t TerminalBridge) HandleAppTerminal(w http.ResponseWriter, r *http.Request
 	}
 
 	basePath := path.Join("/ws/v1/devices", deviceID, "applications", appName, "console")
-	consoleURL, err := buildAppConsoleURL(basePath, force, orgID)
+	consoleURL, err := buildAppConsoleURL(t.backendFor(r).RemoteAccessUrl, basePath, clientQuery)
 	if err != nil {
 		log.Warnf("Failed to build app console URL: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	log.Infof("Starting app console session for device: %s app: %s", deviceID, appName)
-	t.bridgeWebSocket(w, r, consoleURL, fmt.Sprintf("device %s app %s", deviceID, appName))
+	log.Infof("Starting %s app console session for device: %s app: %s", clientQuery.consoleType, deviceID, appName)
+	label := fmt.Sprintf("device %s app %s (%s)", deviceID, appName, clientQuery.consoleType)
+	t.bridgeWebSocket(w, r, consoleURL, appConsoleBridgeOptions(label, clientQuery))
+}
+
+// appConsoleBridgeOptions returns the options for the console type. A VNC console is a binary RFB
+// stream: like a port-forward, it cannot be replayed to a new client nor multiplexed, so it is relayed
+// as-is and never resumable.
+func appConsoleBridgeOptions(label string, clientQuery appConsoleClientQuery) bridgeOptions {
+	if clientQuery.consoleType == appConsoleTypeVNC {
+		return bridgeOptions{
+			label:                  label,
+			downloadBytesPerSecond: config.PortForwardBytesPerSecond,
+			uploadBytesPerSecond:   config.PortForwardBytesPerSecond,
+		}
+	}
+	return terminalBridgeOptions(label, clientQuery.resumeID, clientQuery.force)
 }
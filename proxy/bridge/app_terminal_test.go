@@ -0,0 +1,105 @@
+package bridge
+
+import (
+	"net/url"
+	"slices"
+	"testing"
+)
+
+func TestParseAppConsoleClientQuery(t *testing.T) {
+	t.Parallel()
+
+	orgID := "5d2c4f3a-6a3b-4c1e-9f1e-2b3c4d5e6f70"
+	tests := []struct {
+		name    string
+		query   string
+		want    appConsoleClientQuery
+		wantErr bool
+	}{
+		{name: "empty defaults to serial", query: "", want: appConsoleClientQuery{consoleType: appConsoleTypeSerial}},
+		{name: "org and force", query: "org_id=" + orgID + "&force=true", want: appConsoleClientQuery{consoleType: appConsoleTypeSerial, orgID: orgID, force: true}},
+		{name: "vnc", query: "consoleType=vnc", want: appConsoleClientQuery{consoleType: appConsoleTypeVNC}},
+		{
+			name:  "exec with tty",
+			query: "consoleType=exec&command=sh&command=-l&tty=true&cols=120&rows=40",
+			want:  appConsoleClientQuery{consoleType: appConsoleTypeExec, command: []string{"sh", "-l"}, tty: true, cols: 120, rows: 40},
+		},
+		{name: "attach without tty", query: "consoleType=attach", want: appConsoleClientQuery{consoleType: appConsoleTypeAttach}},
+		{name: "unknown console type", query: "consoleType=ssh", wantErr: true},
+		{name: "duplicate console type", query: "consoleType=exec&consoleType=serial", wantErr: true},
+		{name: "exec without command", query: "consoleType=exec", wantErr: true},
+		{name: "command on serial console", query: "command=sh", wantErr: true},
+		{name: "command on attach console", query: "consoleType=attach&command=sh", wantErr: true},
+		{name: "command with control characters", query: "consoleType=exec&command=" + url.QueryEscape("sh\n"), wantErr: true},
+		{name: "empty command", query: "consoleType=exec&command=", wantErr: true},
+		{name: "dimensions without tty", query: "consoleType=attach&cols=80", wantErr: true},
+		{name: "dimension out of range", query: "consoleType=attach&tty=true&rows=0", wantErr: true},
+		{name: "invalid tty", query: "consoleType=attach&tty=yes", wantErr: true},
+		{name: "invalid org", query: "org_id=not-a-uuid", wantErr: true},
+		{name: "invalid force", query: "force=1", wantErr: true},
+		{name: "unknown parameter", query: "foo=bar", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parseAppConsoleClientQuery(tc.query)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.consoleType != tc.want.consoleType || got.orgID != tc.want.orgID || got.force != tc.want.force ||
+				got.tty != tc.want.tty || got.cols != tc.want.cols || got.rows != tc.want.rows ||
+				!slices.Equal(got.command, tc.want.command) {
+				t.Fatalf("expected %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestBuildAppConsoleURLForwardsOnlyValidatedParams(t *testing.T) {
+	t.Parallel()
+
+	consoleURL, err := buildAppConsoleURL("https://remote-access.example.com", "/ws/v1/devices/dev/applications/app/console", appConsoleClientQuery{
+		consoleType: appConsoleTypeExec,
+		command:     []string{"sh", "-l"},
+		tty:         true,
+		cols:        80,
+		rows:        24,
+		resumeID:    "5d2c4f3a-6a3b-4c1e-9f1e-2b3c4d5e6f70",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	parsed, err := url.Parse(consoleURL)
+	if err != nil {
+		t.Fatalf("invalid URL %q: %v", consoleURL, err)
+	}
+	query := parsed.Query()
+	if query.Get("consoleType") != "exec" || !slices.Equal(query["command"], []string{"sh", "-l"}) ||
+		query.Get("tty") != "true" || query.Get("cols") != "80" || query.Get("rows") != "24" {
+		t.Fatalf("unexpected console query: %q", parsed.RawQuery)
+	}
+	if query.Has(terminalResumeQueryParam) {
+		t.Fatal("resume token must not be forwarded to remote-access")
+	}
+}
+
+func TestAppConsoleBridgeOptionsRelayVNCWithoutResume(t *testing.T) {
+	t.Parallel()
+
+	resumeID := "5d2c4f3a-6a3b-4c1e-9f1e-2b3c4d5e6f70"
+	vnc := appConsoleBridgeOptions("vnc", appConsoleClientQuery{consoleType: appConsoleTypeVNC, resumeID: resumeID})
+	if vnc.resumeID != "" || vnc.multiplexed {
+		t.Fatalf("expected VNC consoles to be relayed as-is and not resumable, got %+v", vnc)
+	}
+	serial := appConsoleBridgeOptions("serial", appConsoleClientQuery{consoleType: appConsoleTypeSerial, resumeID: resumeID})
+	if serial.resumeID != resumeID || !serial.multiplexed {
+		t.Fatalf("expected serial consoles to be resumable terminals, got %+v", serial)
+	}
+}
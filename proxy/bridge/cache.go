@@ -0,0 +1,260 @@
+package bridge
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"expvar"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiCacheMetrics exposes response cache counters through expvar (see config.MetricsPort).
+var apiCacheMetrics = expvar.NewMap("apiCache")
+
+const (
+	metricCacheHits          = "hits"
+	metricCacheMisses        = "misses"
+	metricCacheRevalidations = "revalidations"
+	metricCacheInvalidations = "invalidations"
+)
+
+const (
+	// cacheStatusHeader tells the UI whether a response was served from the cache
+	cacheStatusHeader = "X-FlightCtl-Cache"
+	// cacheRevalidationWindow is how many TTLs an expired response with an ETag or Last-Modified
+	// header is kept, so it can be revalidated with a conditional request instead of fetched again
+	cacheRevalidationWindow = 10
+	// cacheMaxEntrySize is the size of the largest response body that is cached
+	cacheMaxEntrySize = 4 << 20
+)
+
+// cachedResponse is immutable once stored; refreshing an entry replaces it.
+type cachedResponse struct {
+	status   int
+	header   http.Header
+	body     []byte
+	storedAt time.Time
+	scope    string
+}
+
+// cachingTransport caches successful GET responses for a short time. Responses are cached per user
+// (a hash of the Authorization header), organization and full URL, so users never share responses.
+// Requests with "Cache-Control: no-cache" revalidate, and "no-store" bypasses the cache. Any other
+// method invalidates the cached responses of the resource collection it targets, for every user.
+type cachingTransport struct {
+	base     http.RoundTripper
+	ttl      time.Duration
+	maxBytes int
+
+	mu      sync.Mutex
+	entries map[string]*cachedResponse
+	size    int
+	// generations counts the mutations of each scope, so responses fetched while a mutation
+	// was in progress are not stored
+	generations map[string]uint64
+}
+
+func newCachingTransport(base http.RoundTripper, ttl time.Duration, maxBytes int) *cachingTransport {
+	return &cachingTransport{
+		base:        base,
+		ttl:         ttl,
+		maxBytes:    maxBytes,
+		entries:     map[string]*cachedResponse{},
+		generations: map[string]uint64{},
+	}
+}
+
+func (t *cachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	scope := cacheScope(req)
+	if req.Method != http.MethodGet {
+		resp, err := t.base.RoundTrip(req)
+		if req.Method != http.MethodHead && req.Method != http.MethodOptions {
+			t.invalidate(scope)
+		}
+		return resp, err
+	}
+
+	cacheControl := strings.ToLower(req.Header.Get("Cache-Control"))
+	// Requests the browser makes conditional or partial, and protocol upgrades, are answered by the backend
+	if strings.Contains(cacheControl, "no-store") || req.Header.Get("If-None-Match") != "" ||
+		req.Header.Get("If-Modified-Since") != "" || req.Header.Get("Range") != "" || req.Header.Get("Upgrade") != "" {
+		return t.base.RoundTrip(req)
+	}
+	noCache := strings.Contains(cacheControl, "no-cache") || req.Header.Get("Pragma") == "no-cache"
+
+	key := requestKey(req)
+	now := time.Now()
+	t.mu.Lock()
+	entry := t.entries[key]
+	generation := t.generations[scope]
+	t.mu.Unlock()
+
+	if entry != nil && !noCache && now.Sub(entry.storedAt) < t.ttl {
+		apiCacheMetrics.Add(metricCacheHits, 1)
+		return entry.response(req, "HIT", now), nil
+	}
+
+	outReq := req
+	if entry != nil && entry.hasValidator() && now.Sub(entry.storedAt) < t.ttl*cacheRevalidationWindow {
+		outReq = req.Clone(req.Context())
+		if etag := entry.header.Get("ETag"); etag != "" {
+			outReq.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := entry.header.Get("Last-Modified"); lastModified != "" {
+			outReq.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	resp, err := t.base.RoundTrip(outReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotModified && outReq != req {
+		resp.Body.Close()
+		apiCacheMetrics.Add(metricCacheRevalidations, 1)
+		refreshed := *entry
+		refreshed.storedAt = time.Now()
+		t.store(key, generation, &refreshed)
+		return refreshed.response(req, "REVALIDATED", refreshed.storedAt), nil
+	}
+
+	apiCacheMetrics.Add(metricCacheMisses, 1)
+	resp.Header.Set(cacheStatusHeader, "MISS")
+	if resp.StatusCode != http.StatusOK || strings.Contains(strings.ToLower(resp.Header.Get("Cache-Control")), "no-store") {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, cacheMaxEntrySize+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if len(body) > cacheMaxEntrySize {
+		// Too large to cache: stream the rest of the body
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	header := resp.Header.Clone()
+	header.Del(cacheStatusHeader)
+	t.store(key, generation, &cachedResponse{
+		status:   resp.StatusCode,
+		header:   header,
+		body:     body,
+		storedAt: time.Now(),
+		scope:    scope,
+	})
+	return resp, nil
+}
+
+// store caches the response unless its scope was mutated since the request was sent.
+func (t *cachingTransport) store(key string, generation uint64, entry *cachedResponse) {
+	if len(entry.body) > t.maxBytes {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.generations[entry.scope] != generation {
+		return
+	}
+	if previous, ok := t.entries[key]; ok {
+		t.size -= len(previous.body)
+	}
+	if t.size+len(entry.body) > t.maxBytes {
+		t.pruneLocked(time.Now())
+	}
+	// Every entry is still useful: start over rather than grow without bound
+	if t.size+len(entry.body) > t.maxBytes {
+		clear(t.entries)
+		t.size = 0
+	}
+	t.entries[key] = entry
+	t.size += len(entry.body)
+}
+
+func (t *cachingTransport) invalidate(scope string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.generations[scope]++
+	for key, entry := range t.entries {
+		if entry.scope == scope {
+			t.size -= len(entry.body)
+			delete(t.entries, key)
+		}
+	}
+	apiCacheMetrics.Add(metricCacheInvalidations, 1)
+}
+
+func (t *cachingTransport) pruneLocked(now time.Time) {
+	for key, entry := range t.entries {
+		age := now.Sub(entry.storedAt)
+		if age >= t.ttl*cacheRevalidationWindow || (age >= t.ttl && !entry.hasValidator()) {
+			t.size -= len(entry.body)
+			delete(t.entries, key)
+		}
+	}
+}
+
+func (e *cachedResponse) hasValidator() bool {
+	return e.header.Get("ETag") != "" || e.header.Get("Last-Modified") != ""
+}
+
+func (e *cachedResponse) response(req *http.Request, status string, now time.Time) *http.Response {
+	header := e.header.Clone()
+	header.Set(cacheStatusHeader, status)
+	header.Set("Age", strconv.Itoa(int(now.Sub(e.storedAt).Seconds())))
+	return &http.Response{
+		Status:        strconv.Itoa(e.status) + " " + http.StatusText(e.status),
+		StatusCode:    e.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+		Request:       req,
+	}
+}
+
+// requestKey identifies the user, the URL (including the org_id set by OrganizationMiddleware) and the
+// headers the representation depends on. Requests with the same key get the same response.
+func requestKey(req *http.Request) string {
+	h := sha256.New()
+	for _, value := range []string{
+		req.Header.Get("Authorization"),
+		req.URL.String(),
+		req.Header.Get("Accept"),
+		req.Header.Get("Accept-Encoding"),
+		req.Header.Get("Flightctl-API-Version"),
+	} {
+		h.Write([]byte(value))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cacheScope is the organization and resource collection a request targets,
+// e.g. "<org>/api/v1/devices" for /api/v1/devices/my-device/status.
+func cacheScope(req *http.Request) string {
+	return req.URL.Query().Get("org_id") + "/" + resourceCollection(req.URL.Path)
+}
+
+func resourceCollection(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 0; i+2 < len(segments); i++ {
+		if segments[i] == "api" && strings.HasPrefix(segments[i+1], "v") {
+			return strings.Join(segments[:i+3], "/")
+		}
+	}
+	return strings.Trim(path, "/")
+}
@@ -0,0 +1,103 @@
+package bridge
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newCachedAPI starts a fake API whose responses change with every request, behind a caching transport.
+func newCachedAPI(t *testing.T, etag string) (*httptest.Server, *cachingTransport, *atomic.Int32) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		if etag != "" {
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", etag)
+		}
+		if r.Method == http.MethodGet {
+			io.WriteString(w, strconv.Itoa(int(n)))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, newCachingTransport(http.DefaultTransport, time.Minute, 1<<20), &requests
+}
+
+func cachedGet(t *testing.T, transport http.RoundTripper, url, token string, header ...string) (string, string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body), resp.Header.Get(cacheStatusHeader)
+}
+
+func TestCachingTransport(t *testing.T) {
+	srv, transport, _ := newCachedAPI(t, "")
+	devices := srv.URL + "/api/v1/devices?org_id=org-a"
+
+	first, status := cachedGet(t, transport, devices, "alice")
+	if status != "MISS" {
+		t.Fatalf("expected a miss, got %q", status)
+	}
+	if body, status := cachedGet(t, transport, devices, "alice"); body != first || status != "HIT" {
+		t.Fatalf("expected cached %q, got %q (%s)", first, body, status)
+	}
+	// Users, organizations and queries are cached separately
+	for _, url := range []string{devices, srv.URL + "/api/v1/devices?org_id=org-b", devices + "&limit=1"} {
+		token := "alice"
+		if url == devices {
+			token = "bob"
+		}
+		if _, status := cachedGet(t, transport, url, token); status != "MISS" {
+			t.Fatalf("expected a miss for %s as %s, got %q", url, token, status)
+		}
+	}
+	if body, status := cachedGet(t, transport, devices, "alice", "Cache-Control", "no-cache"); body == first || status != "MISS" {
+		t.Fatalf("expected no-cache to bypass the cache, got %q (%s)", body, status)
+	}
+
+	// A change to a device invalidates the device lists, but not the fleets
+	fleets := srv.URL + "/api/v1/fleets?org_id=org-a"
+	cachedGet(t, transport, fleets, "alice")
+	req, _ := http.NewRequest(http.MethodPatch, srv.URL+"/api/v1/devices/my-device?org_id=org-a", nil)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if _, status := cachedGet(t, transport, devices, "alice"); status != "MISS" {
+		t.Fatalf("expected the device list to be invalidated, got %q", status)
+	}
+	if _, status := cachedGet(t, transport, fleets, "alice"); status != "HIT" {
+		t.Fatalf("expected the fleet list to stay cached, got %q", status)
+	}
+}
+
+func TestCachingTransportRevalidates(t *testing.T) {
+	srv, transport, requests := newCachedAPI(t, `"v1"`)
+	devices := srv.URL + "/api/v1/devices?org_id=org-a"
+
+	first, _ := cachedGet(t, transport, devices, "alice")
+	body, status := cachedGet(t, transport, devices, "alice", "Cache-Control", "no-cache")
+	if body != first || status != "REVALIDATED" {
+		t.Fatalf("expected the cached body to be revalidated, got %q (%s)", body, status)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Fatalf("expected 2 backend requests, got %d", got)
+	}
+}
@@ -0,0 +1,229 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"expvar"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// coalescingMetrics exposes request coalescing counters through expvar (see config.MetricsPort).
+var coalescingMetrics = expvar.NewMap("coalescing")
+
+const (
+	metricCoalescedRequests = "coalescedRequests"
+	metricUpstreamRequests  = "upstreamRequests"
+)
+
+// coalesceMaxBodySize is the size of the largest response shared between coalesced requests.
+// Larger responses are streamed to the request that started the flight; the other requests send
+// their own.
+const coalesceMaxBodySize = 4 << 20
+
+// flight is an upstream GET shared by identical concurrent requests.
+type flight struct {
+	scope   string
+	cancel  context.CancelFunc
+	waiters int
+	done    chan struct{}
+	// leaderWaiting is set while the request that started the flight waits for its response
+	leaderWaiting bool
+	// streamed is set once a waiter took the response too large to share
+	streamed bool
+
+	// Set before done is closed
+	err      error
+	tooLarge bool
+	status   int
+	header   http.Header
+	body     []byte
+	// stream is the response too large to share, until a waiter takes it
+	stream *http.Response
+}
+
+// streamedBody is the body of a response too large to share. Closing it ends the upstream request.
+type streamedBody struct {
+	io.Reader
+	body   io.Closer
+	cancel context.CancelFunc
+}
+
+func (b *streamedBody) Close() error {
+	defer b.cancel()
+	return b.body.Close()
+}
+
+// coalescingTransport sends a single upstream request for identical concurrent GET requests: same
+// user (Authorization header), organization, URL and representation headers. Every waiter receives a
+// copy of the response, when it is no larger than coalesceMaxBodySize. The upstream request is
+// cancelled when every waiter has given up, and requests that change a resource collection stop
+// later GETs of that collection from joining requests sent before the change.
+type coalescingTransport struct {
+	base http.RoundTripper
+
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+func newCoalescingTransport(base http.RoundTripper) *coalescingTransport {
+	return &coalescingTransport{
+		base:    base,
+		flights: map[string]*flight{},
+	}
+}
+
+func (t *coalescingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		if req.Method == http.MethodHead || req.Method == http.MethodOptions {
+			return t.base.RoundTrip(req)
+		}
+		scope := cacheScope(req)
+		t.forgetScope(scope)
+		defer t.forgetScope(scope)
+		return t.base.RoundTrip(req)
+	}
+	if req.Header.Get("Authorization") == "" || req.Header.Get("If-None-Match") != "" ||
+		req.Header.Get("If-Modified-Since") != "" || req.Header.Get("Range") != "" || req.Header.Get("Upgrade") != "" {
+		return t.base.RoundTrip(req)
+	}
+
+	key := requestKey(req)
+	t.mu.Lock()
+	f, joined := t.flights[key]
+	if !joined {
+		ctx, cancel := context.WithCancel(context.WithoutCancel(req.Context()))
+		f = &flight{scope: cacheScope(req), cancel: cancel, done: make(chan struct{}), leaderWaiting: true}
+		t.flights[key] = f
+		go t.send(ctx, key, f, req)
+	}
+	f.waiters++
+	t.mu.Unlock()
+	if joined {
+		coalescingMetrics.Add(metricCoalescedRequests, 1)
+	}
+
+	select {
+	case <-f.done:
+	case <-req.Context().Done():
+		t.leave(key, f, !joined, false)
+		return nil, req.Context().Err()
+	}
+	stream := t.leave(key, f, !joined, true)
+	if f.err != nil {
+		return nil, f.err
+	}
+	if stream != nil {
+		stream.Request = req
+		return stream, nil
+	}
+	if f.tooLarge {
+		return t.base.RoundTrip(req)
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(f.status) + " " + http.StatusText(f.status),
+		StatusCode:    f.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        f.header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(f.body)),
+		ContentLength: int64(len(f.body)),
+		Request:       req,
+	}, nil
+}
+
+// send performs the upstream request of a flight and records its response.
+func (t *coalescingTransport) send(ctx context.Context, key string, f *flight, req *http.Request) {
+	defer close(f.done)
+	defer t.forget(key, f)
+
+	coalescingMetrics.Add(metricUpstreamRequests, 1)
+	resp, err := t.base.RoundTrip(req.Clone(ctx))
+	if err != nil {
+		f.cancel()
+		f.err = err
+		return
+	}
+	var body []byte
+	if resp.ContentLength <= coalesceMaxBodySize {
+		body, err = io.ReadAll(io.LimitReader(resp.Body, coalesceMaxBodySize+1))
+		if err != nil {
+			resp.Body.Close()
+			f.cancel()
+			f.err = err
+			return
+		}
+	}
+	if resp.ContentLength > coalesceMaxBodySize || len(body) > coalesceMaxBodySize {
+		f.tooLarge = true
+		resp.Body = &streamedBody{Reader: io.MultiReader(bytes.NewReader(body), resp.Body), body: resp.Body, cancel: f.cancel}
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if f.waiters == 0 {
+			resp.Body.Close()
+			return
+		}
+		f.stream = resp
+		return
+	}
+	resp.Body.Close()
+	f.cancel()
+	f.status = resp.StatusCode
+	f.header = resp.Header
+	f.body = body
+}
+
+// leave removes a waiter, that gave up or whose flight is done. A waiter whose flight is done takes the
+// response too large to share when it started the flight, or when that request gave up; the other
+// waiters send their own request. The upstream request is cancelled once every waiter left, unless
+// one of them reads the response.
+func (t *coalescingTransport) leave(key string, f *flight, leader bool, done bool) *http.Response {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f.waiters--
+	if leader {
+		f.leaderWaiting = false
+	}
+	var stream *http.Response
+	if done && f.stream != nil && (leader || !f.leaderWaiting) {
+		stream, f.stream = f.stream, nil
+		f.streamed = true
+	}
+	if f.waiters == 0 {
+		t.forgetLocked(key, f)
+		if f.stream != nil {
+			f.stream.Body.Close()
+			f.stream = nil
+		}
+		if !f.streamed {
+			f.cancel()
+		}
+	}
+	return stream
+}
+
+// forget stops new requests from joining the flight.
+func (t *coalescingTransport) forget(key string, f *flight) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.forgetLocked(key, f)
+}
+
+func (t *coalescingTransport) forgetLocked(key string, f *flight) {
+	if t.flights[key] == f {
+		delete(t.flights, key)
+	}
+}
+
+func (t *coalescingTransport) forgetScope(scope string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key, f := range t.flights {
+		if f.scope == scope {
+			delete(t.flights, key)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package bridge
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCoalescingTransportSharesConcurrentRequests(t *testing.T) {
+	var requests atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		<-release
+		io.WriteString(w, r.Header.Get("Authorization")+strconv.Itoa(int(n)))
+	}))
+	t.Cleanup(srv.Close)
+	transport := newCoalescingTransport(http.DefaultTransport)
+
+	tokens := []string{"alice", "alice", "alice", "bob", "bob"}
+	bodies := make([]string, len(tokens))
+	var wg sync.WaitGroup
+	for i, token := range tokens {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/v1/fleets?org_id=org-a", nil)
+			req.Header.Set("Authorization", token)
+			resp, err := transport.RoundTrip(req)
+			if err != nil {
+				t.Errorf("request failed: %v", err)
+				return
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			bodies[i] = string(body)
+		}()
+	}
+	// Wait for every request to join a flight before the backend answers
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		transport.mu.Lock()
+		waiters := 0
+		for _, f := range transport.flights {
+			waiters += f.waiters
+		}
+		transport.mu.Unlock()
+		if waiters == len(tokens) || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if got := requests.Load(); got != 2 {
+		t.Fatalf("expected one backend request per user, got %d", got)
+	}
+	if bodies[0] != bodies[1] || bodies[1] != bodies[2] || bodies[3] != bodies[4] || bodies[0] == bodies[3] {
+		t.Fatalf("expected each user's requests to share a response, got %q", bodies)
+	}
+}
+
+func TestCoalescingTransportCancelsAbandonedRequests(t *testing.T) {
+	cancelled := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(cancelled)
+	}))
+	t.Cleanup(srv.Close)
+	transport := newCoalescingTransport(http.DefaultTransport)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/v1/devices", nil)
+	req.Header.Set("Authorization", "alice")
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := transport.RoundTrip(req); err == nil {
+		t.Fatal("expected the cancelled request to fail")
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the backend request was not cancelled")
+	}
+}
+
+func TestCoalescingTransportStreamsLargeResponses(t *testing.T) {
+	var requests atomic.Int32
+	release := make(chan struct{})
+	large := strings.Repeat("x", coalesceMaxBodySize+1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			<-release
+		}
+		// Without a Content-Length, the size is only known once the body is read
+		w.(http.Flusher).Flush()
+		io.WriteString(w, large)
+	}))
+	t.Cleanup(srv.Close)
+	transport := newCoalescingTransport(http.DefaultTransport)
+
+	const waiters = 3
+	var wg sync.WaitGroup
+	for range waiters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/v1/devices", nil)
+			req.Header.Set("Authorization", "alice")
+			resp, err := transport.RoundTrip(req)
+			if err != nil {
+				t.Errorf("request failed: %v", err)
+				return
+			}
+			defer resp.Body.Close()
+			if body, _ := io.ReadAll(resp.Body); len(body) != len(large) {
+				t.Errorf("expected the whole response, got %d bytes", len(body))
+			}
+		}()
+	}
+	// Wait for every request to join the flight before the backend answers
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		transport.mu.Lock()
+		joined := 0
+		for _, f := range transport.flights {
+			joined += f.waiters
+		}
+		transport.mu.Unlock()
+		if joined == waiters {
+			break
+		}
+	}
+	close(release)
+	wg.Wait()
+
+	// The request that started the flight streams the response, the others send their own request
+	if got := requests.Load(); got != waiters {
+		t.Fatalf("expected one backend request per waiter, got %d", got)
+	}
+}
@@ -2,7 +2,6 @@ package bridge
 
 import (
 	"bytes"
-	"crypto/tls"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -13,8 +12,10 @@ import (
 
 	"github.com/gorilla/mux"
 
+	"github.com/flightctl/flightctl-ui/common"
 	"github.com/flightctl/flightctl-ui/config"
 	"github.com/flightctl/flightctl-ui/log"
+	"github.com/flightctl/flightctl-ui/upstream"
 )
 
 type handler struct {
@@ -31,6 +32,17 @@ func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.proxy.ServeHTTP(w, r)
 }
 
+// proxyErrorHandler answers requests that could not be forwarded. Request bodies cut by
+// middleware.RequestLimitsMiddleware get a 413; other errors a 502, as with the default handler.
+func proxyErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	if common.IsBodyTooLarge(err) {
+		common.RespondWithBodyTooLarge(w)
+		return
+	}
+	log.GetLogger().WithError(err).Warnf("Failed to proxy request to %s", r.URL.Path)
+	w.WriteHeader(http.StatusBadGateway)
+}
+
 func createReverseProxy(apiURL string) (*url.URL, *httputil.ReverseProxy) {
 	target, err := url.Parse(apiURL)
 	if err != nil {
@@ -38,6 +50,7 @@ func createReverseProxy(apiURL string) (*url.URL, *httputil.ReverseProxy) {
 		os.Exit(1)
 	}
 	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.ErrorHandler = proxyErrorHandler
 	proxy.ModifyResponse = func(r *http.Response) error {
 		filterHeaders := []string{
 			"Access-Control-Allow-Headers",
@@ -68,6 +81,7 @@ func createAlertsReverseProxy(apiURL string) (*url.URL, *httputil.ReverseProxy)
 		os.Exit(1)
 	}
 	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.ErrorHandler = proxyErrorHandler
 	proxy.ModifyResponse = func(r *http.Response) error {
 		filterHeaders := []string{
 			"Access-Control-Allow-Headers",
@@ -92,34 +106,80 @@ func createAlertsReverseProxy(apiURL string) (*url.URL, *httputil.ReverseProxy)
 	return target, proxy
 }
 
-func NewFlightCtlHandler(tlsConfig *tls.Config) handler {
-	target, proxy := createReverseProxy(config.FctlApiUrl)
+// backendHandler dispatches each request to the proxy of the backend selected for it.
+// Backends without a handler (e.g. no AlertManager configured) answer with 501.
+type backendHandler struct {
+	backends *upstream.Registry
+	handlers map[string]http.Handler
+}
 
-	proxy.Transport = &http.Transport{
-		TLSClientConfig: tlsConfig,
+func (h backendHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if handler, ok := h.handlers[h.backends.ForRequest(r).Name]; ok {
+		handler.ServeHTTP(w, r)
+		return
 	}
+	UnimplementedHandler(w, r)
+}
 
-	return handler{target: target, proxy: proxy}
+func newBackendHandler(backends *upstream.Registry, newHandler func(b *upstream.Backend) (http.Handler, bool)) backendHandler {
+	handlers := map[string]http.Handler{}
+	for _, b := range backends.List() {
+		if handler, ok := newHandler(b); ok {
+			handlers[b.Name] = handler
+		}
+	}
+	return backendHandler{backends: backends, handlers: handlers}
 }
 
-func NewFlightCtlCliArtifactsHandler(tlsConfig *tls.Config) handler {
-	target, proxy := createReverseProxy(config.FctlCliArtifactsUrl)
+func NewFlightCtlHandler(backends *upstream.Registry) http.Handler {
+	return newBackendHandler(backends, func(b *upstream.Backend) (http.Handler, bool) {
+		target, proxy := createReverseProxy(b.ApiUrl)
 
-	proxy.Transport = &http.Transport{
-		TLSClientConfig: tlsConfig,
-	}
+		// Identical concurrent GETs share one upstream request (when enabled), which the cache (when enabled) sits in front of
+		var transport http.RoundTripper = &http.Transport{
+			TLSClientConfig: b.TlsConfig,
+		}
+		if config.ApiCoalesceRequests {
+			transport = newCoalescingTransport(transport)
+		}
+		if config.ApiCacheTTL > 0 {
+			transport = newCachingTransport(transport, config.ApiCacheTTL, config.ApiCacheMaxBytes)
+		}
+		proxy.Transport = transport
 
-	return handler{target: target, proxy: proxy}
+		return handler{target: target, proxy: proxy}, true
+	})
 }
 
-func NewAlertManagerHandler(tlsConfig *tls.Config) handler {
-	target, proxy := createAlertsReverseProxy(config.AlertManagerApiUrl)
+func NewFlightCtlCliArtifactsHandler(backends *upstream.Registry) http.Handler {
+	return newBackendHandler(backends, func(b *upstream.Backend) (http.Handler, bool) {
+		if b.CliArtifactsUrl == "" {
+			return nil, false
+		}
+		target, proxy := createReverseProxy(b.CliArtifactsUrl)
 
-	proxy.Transport = &http.Transport{
-		TLSClientConfig: tlsConfig,
-	}
+		proxy.Transport = &http.Transport{
+			TLSClientConfig: b.TlsConfig,
+		}
 
-	return handler{target: target, proxy: proxy}
+		return handler{target: target, proxy: proxy}, true
+	})
+}
+
+func NewAlertManagerHandler(backends *upstream.Registry) http.Handler {
+	return newBackendHandler(backends, func(b *upstream.Backend) (http.Handler, bool) {
+		if b.AlertManagerUrl == "" {
+			return nil, false
+		}
+		target, proxy := createAlertsReverseProxy(b.AlertManagerUrl)
+
+		transport := &http.Transport{
+			TLSClientConfig: b.TlsConfig,
+		}
+		proxy.Transport = transport
+
+		return newAlertsTenantHandler(handler{target: target, proxy: proxy}, target, transport), true
+	})
 }
 
 // To be able to trigger the download in the browser, the UI must be able to obtain the "Location" header for a redirect.
@@ -159,18 +219,23 @@ func (t *imagebuilderDownloadRewriteTransport) RoundTrip(req *http.Request) (*ht
 	return resp, nil
 }
 
-func NewImageBuilderHandler(tlsConfig *tls.Config) handler {
-	target, proxy := createReverseProxy(config.FctlImageBuilderApiUrl)
+func NewImageBuilderHandler(backends *upstream.Registry) http.Handler {
+	return newBackendHandler(backends, func(b *upstream.Backend) (http.Handler, bool) {
+		if b.ImageBuilderUrl == "" {
+			return nil, false
+		}
+		target, proxy := createReverseProxy(b.ImageBuilderUrl)
 
-	baseTransport := &http.Transport{
-		TLSClientConfig: tlsConfig,
-	}
-	proxy.Transport = &imagebuilderDownloadRewriteTransport{base: baseTransport}
-	// Enable streaming for large file downloads (e.g., image exports)
-	// FlushInterval < 0 means flush immediately after each write
-	proxy.FlushInterval = -1
+		baseTransport := &http.Transport{
+			TLSClientConfig: b.TlsConfig,
+		}
+		proxy.Transport = &imagebuilderDownloadRewriteTransport{base: baseTransport}
+		// Enable streaming for large file downloads (e.g., image exports)
+		// FlushInterval < 0 means flush immediately after each write
+		proxy.FlushInterval = -1
 
-	return handler{target: target, proxy: proxy}
+		return handler{target: target, proxy: proxy}, true
+	})
 }
 
 func UnimplementedHandler(w http.ResponseWriter, r *http.Request) {
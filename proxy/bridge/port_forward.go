@@ -0,0 +1,110 @@
+package bridge
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+
+	"github.com/flightctl/flightctl-ui/common"
+	"github.com/flightctl/flightctl-ui/config"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// parsePortForwardPort validates the device-side TCP port requested by the client.
+func parsePortForwardPort(rawPort string) (int, error) {
+	port, err := strconv.Atoi(rawPort)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %q", rawPort)
+	}
+	return port, nil
+}
+
+// parsePortForwardClientQuery validates client query parameters. Only org_id is accepted
+// and it is forwarded to remote-access when present.
+func parsePortForwardClientQuery(rawQuery string) (string, error) {
+	if rawQuery == "" {
+		return "", nil
+	}
+
+	parsedQuery, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", fmt.Errorf("invalid query string: %w", err)
+	}
+
+	for key := range parsedQuery {
+		if key != "org_id" {
+			return "", fmt.Errorf("unsupported query parameter: %q", key)
+		}
+	}
+
+	orgValues := parsedQuery["org_id"]
+	if len(orgValues) != 1 || orgValues[0] == "" {
+		return "", fmt.Errorf("invalid org_id parameter")
+	}
+	if _, err := uuid.Parse(orgValues[0]); err != nil {
+		return "", fmt.Errorf("invalid org_id parameter")
+	}
+	return orgValues[0], nil
+}
+
+// buildPortForwardURL constructs the remote-access websocket URL that tunnels to a TCP port on the device.
+func buildPortForwardURL(remoteAccessUrl, deviceID string, port int, orgID string) (string, error) {
+	query := url.Values{"port": {strconv.Itoa(port)}}
+	if orgID != "" {
+		query.Set("org_id", orgID)
+	}
+	return buildRemoteAccessURL(remoteAccessUrl, path.Join("/ws/v1/devices", deviceID, "portforward"), query)
+}
+
+// HandlePortForward relays a binary WebSocket stream between the client and a TCP port on the device.
+// It is used by the browser and by local CLI helpers that expose the tunnel as a local listener.
+func (t TerminalBridge) HandlePortForward(w http.ResponseWriter, r *http.Request) {
+	if !isWebsocketUpgrade(r) {
+		errMsg := "not a websocket connection"
+		log.Warn(errMsg)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(errMsg))
+		return
+	}
+
+	vars := mux.Vars(r)
+	deviceID := vars["deviceId"]
+	if !common.IsSafeResourceName(deviceID) {
+		log.Warnf("Invalid port-forward request")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	port, err := parsePortForwardPort(vars["port"])
+	if err != nil {
+		log.Warnf("Invalid port-forward request: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	orgID, err := parsePortForwardClientQuery(r.URL.RawQuery)
+	if err != nil {
+		log.Warnf("Failed to parse port-forward query: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	tunnelURL, err := buildPortForwardURL(t.backendFor(r).RemoteAccessUrl, deviceID, port, orgID)
+	if err != nil {
+		log.Warnf("Failed to build port-forward URL: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	log.Infof("Starting port-forward session for device: %s port: %d", deviceID, port)
+	// A TCP stream cannot be replayed to a new client, so port-forward sessions are never resumable
+	t.bridgeWebSocket(w, r, tunnelURL, bridgeOptions{
+		label:                  fmt.Sprintf("device %s port %d", deviceID, port),
+		downloadBytesPerSecond: config.PortForwardBytesPerSecond,
+		uploadBytesPerSecond:   config.PortForwardBytesPerSecond,
+	})
+}
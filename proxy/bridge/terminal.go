@@ -1,8 +1,6 @@
 package bridge
 
 import (
-	"crypto/tls"
-	"errors"
 	"fmt"
 	"net/http"
 	"net/textproto"
@@ -16,6 +14,8 @@ import (
 	"github.com/flightctl/flightctl-ui/common"
 	"github.com/flightctl/flightctl-ui/config"
 	clientorigin "github.com/flightctl/flightctl-ui/origin"
+	"github.com/flightctl/flightctl-ui/upstream"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	log "github.com/sirupsen/logrus"
 )
@@ -33,7 +33,16 @@ var (
 )
 
 type TerminalBridge struct {
-	TlsConfig *tls.Config
+	Backends *upstream.Registry
+}
+
+// backendFor returns the backend selected for the request. Without a registry, the backend
+// defined by the FLIGHTCTL_* environment variables is used.
+func (t TerminalBridge) backendFor(r *http.Request) *upstream.Backend {
+	if t.Backends == nil {
+		return &upstream.Backend{ApiUrl: config.FctlApiUrl, RemoteAccessUrl: config.FctlRemoteAccessUrl}
+	}
+	return t.Backends.ForRequest(r)
 }
 
 func writeCloseFrame(writeMutex *sync.Mutex, dest *websocket.Conn, code int, text string) {
@@ -50,35 +59,10 @@ func writeCloseFrame(writeMutex *sync.Mutex, dest *websocket.Conn, code int, tex
 	}
 }
 
-func copyMsgs(writeMutex *sync.Mutex, dest, src *websocket.Conn) error {
-	for {
-		messageType, msg, err := src.ReadMessage()
-		if err != nil {
-			var closeErr *websocket.CloseError
-			if errors.As(err, &closeErr) {
-				writeCloseFrame(writeMutex, dest, closeErr.Code, closeErr.Text)
-			}
-			return err
-		}
-
-		if writeMutex == nil {
-			err = dest.WriteMessage(messageType, msg)
-		} else {
-			writeMutex.Lock()
-			err = dest.WriteMessage(messageType, msg)
-			writeMutex.Unlock()
-		}
-
-		if err != nil {
-			return err
-		}
-	}
-}
-
 // buildDeviceConsoleURL constructs a websocket URL for the device console endpoint.
 // It extracts and validates the deviceId from the request path, sanitizes the query string,
 // and safely builds the URL using Go's url package to prevent SSRF attacks.
-func buildDeviceConsoleURL(r *http.Request) (string, error) {
+func buildDeviceConsoleURL(r *http.Request, apiUrl string) (string, error) {
 	deviceId, found := strings.CutPrefix(r.URL.Path, "/api/terminal/")
 	if !found || !common.IsSafeResourceName(deviceId) {
 		return "", fmt.Errorf("invalid deviceId")
@@ -91,7 +75,7 @@ func buildDeviceConsoleURL(r *http.Request) (string, error) {
 	}
 
 	// Parse the base API URL to safely construct the websocket URL
-	baseURL, err := url.Parse(config.FctlApiUrl)
+	baseURL, err := url.Parse(apiUrl)
 	if err != nil {
 		return "", fmt.Errorf("invalid base API URL: %w", err)
 	}
@@ -115,85 +99,31 @@ func buildDeviceConsoleURL(r *http.Request) (string, error) {
 		if err != nil {
 			return "", fmt.Errorf("invalid sanitized query string: %w", err)
 		}
+		// The resume token is only meaningful to the proxy
+		parsedQuery.Del(terminalResumeQueryParam)
 		consoleURL.RawQuery = parsedQuery.Encode()
 	}
 
 	return consoleURL.String(), nil
 }
 
-// checkOrigin validates the Origin header against allowed origins.
-// It allows:
-//   - Requests without an Origin header (same-origin from browsers)
-//   - Requests from the configured BaseUiUrl origin
-//   - Same-origin requests (Origin matches request Host)
-//   - OpenShift console plugin proxy only: Origin is the console's documented placeholder
-//     (http://localhost) and X-Forwarded-Host/Proto match BASE_UI_URL — not a blanket bypass
-//     for arbitrary Origin values when forwarded headers match the destination host
-//
-// Host comparisons are case-insensitive per RFC 3986.
+// checkOrigin validates the Origin header of WebSocket upgrades against the origins allowed by
+// clientorigin.IsAllowed. Requests without an Origin header are allowed (same-origin from browsers).
 func checkOrigin(r *http.Request) bool {
 	origin := r.Header.Get("Origin")
-	xfh := r.Header.Get("X-Forwarded-Host")
-	effectiveOrigin := clientorigin.EffectiveRequestOrigin(r)
-
-	// If no Origin header is present, allow the request (same-origin from browsers).
 	if origin == "" {
 		return true
 	}
-
-	originURL, err := url.Parse(origin)
-	if err != nil {
-		log.Warnf("Rejected WebSocket connection - invalid Origin header: %q", origin)
-		return false
-	}
-
-	baseURL, err := url.Parse(config.BaseUiUrl)
-	if err != nil {
-		log.WithError(err).Debugf("WebSocket origin check: failed to parse BaseUiUrl")
-	} else if clientorigin.FromURL(originURL) == clientorigin.FromURL(baseURL) {
-		return true
-	}
-
-	// Allow same-origin requests (direct access to the proxy, not via console plugin).
-	if clientorigin.FromURL(originURL) == clientorigin.DirectRequestOrigin(r) {
-		return true
-	}
-
-	if isOpenShiftConsolePluginProxyOriginAllowed(r, origin, baseURL, xfh, effectiveOrigin) {
+	if clientorigin.IsAllowed(r, origin) {
 		return true
 	}
-
 	log.Debugf(
 		"Rejected WebSocket connection - Origin=%q requestHost=%q BASE_UI_URL=%q effectiveOrigin=%q xForwardedHost=%q",
-		origin, r.Host, config.BaseUiUrl, effectiveOrigin, xfh,
+		origin, r.Host, config.BaseUiUrl, clientorigin.EffectiveRequestOrigin(r), r.Header.Get("X-Forwarded-Host"),
 	)
 	return false
 }
 
-// isOpenShiftConsolePluginProxyOriginAllowed permits the console WebSocket backend hop only when
-// Origin is openshift/console's fixed placeholder (http://localhost), not when an attacker
-// supplies another Origin but forges X-Forwarded-Host to match BASE_UI_URL.
-func isOpenShiftConsolePluginProxyOriginAllowed(
-	r *http.Request,
-	origin string,
-	baseURL *url.URL,
-	xfh, effectiveOrigin string,
-) bool {
-	if config.OcpPlugin != "true" {
-		return false
-	}
-	if !config.ShouldTrustForwardedHeaders(r) || strings.TrimSpace(xfh) == "" {
-		return false
-	}
-	if baseURL == nil {
-		return false
-	}
-	if !clientorigin.IsOpenShiftConsoleProxyWebSocketOrigin(origin) {
-		return false
-	}
-	return clientorigin.FromURL(baseURL) == effectiveOrigin
-}
-
 func (t TerminalBridge) HandleTerminal(w http.ResponseWriter, r *http.Request) {
 	if !isWebsocketUpgrade(r) {
 		errMsg := "not a websocket connection"
@@ -203,16 +133,39 @@ func (t TerminalBridge) HandleTerminal(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	consoleURL, err := buildDeviceConsoleURL(r)
+	consoleURL, err := buildDeviceConsoleURL(r, t.backendFor(r).ApiUrl)
 	if err != nil {
 		log.Warnf("Failed to build console URL: %v", err)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
+	resumeID, err := parseTerminalResumeID(r.URL.Query())
+	if err != nil {
+		log.Warnf("Failed to parse terminal query: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	force := r.URL.Query().Get("force") == "true"
+
 	deviceId, _ := strings.CutPrefix(r.URL.Path, "/api/terminal/")
 	log.Infof("Starting terminal session for device: %s", deviceId)
-	t.bridgeWebSocket(w, r, consoleURL, fmt.Sprintf("device: %s", deviceId))
+	t.bridgeWebSocket(w, r, consoleURL, terminalBridgeOptions(fmt.Sprintf("device: %s", deviceId), resumeID, force))
+}
+
+// parseTerminalResumeID returns the optional resume token. It must be a UUID generated by the client.
+func parseTerminalResumeID(query url.Values) (string, error) {
+	values, ok := query[terminalResumeQueryParam]
+	if !ok {
+		return "", nil
+	}
+	if len(values) != 1 {
+		return "", fmt.Errorf("invalid %s parameter", terminalResumeQueryParam)
+	}
+	if _, err := uuid.Parse(values[0]); err != nil {
+		return "", fmt.Errorf("invalid %s parameter", terminalResumeQueryParam)
+	}
+	return values[0], nil
 }
 
 func isWebsocketUpgrade(r *http.Request) bool {
@@ -224,9 +177,72 @@ func isWebsocketUpgrade(r *http.Request) bool {
 	return false
 }
 
-func (t TerminalBridge) bridgeWebSocket(w http.ResponseWriter, r *http.Request, consoleURL, sessionLabel string) {
+// bridgeOptions describes how a frontend WebSocket is bridged to a backend WebSocket.
+type bridgeOptions struct {
+	// label identifies the session in logs
+	label string
+	// resumeID makes the session resumable after a frontend disconnect; empty disables resume
+	resumeID string
+	// force takes over a resumable session that is attached to another frontend
+	force bool
+	// downloadBytesPerSecond and uploadBytesPerSecond cap throughput; zero means unlimited
+	downloadBytesPerSecond int
+	uploadBytesPerSecond   int
+	// multiplexed lets the client negotiate the terminal.flightctl.io/v1 protocol (see terminal_protocol.go)
+	multiplexed bool
+}
+
+// terminalBridgeOptions returns the options for an interactive console session.
+func terminalBridgeOptions(label, resumeID string, force bool) bridgeOptions {
+	return bridgeOptions{
+		label:                  label,
+		resumeID:               resumeID,
+		force:                  force,
+		downloadBytesPerSecond: config.TerminalDownloadBytesPerSecond,
+		uploadBytesPerSecond:   config.TerminalUploadBytesPerSecond,
+		multiplexed:            true,
+	}
+}
+
+// bridgeWebSocket connects the frontend to the backend WebSocket at consoleURL.
+// When opts.resumeID is set, the backend connection outlives frontend disconnects for the configured
+// grace period and a later request with the same resumeID from the same user, for the same console,
+// reattaches to it. Sessions of requests whose user can't be identified are not resumable.
+func (t TerminalBridge) bridgeWebSocket(w http.ResponseWriter, r *http.Request, consoleURL string, opts bridgeOptions) {
+	if config.TerminalResumeGracePeriod == 0 {
+		opts.resumeID = ""
+	}
+	key := terminalSessionKey{consoleURL: consoleURL, resumeID: opts.resumeID}
+	if key.resumeID != "" {
+		owner, err := terminalSessionOwner(r, t.backendFor(r))
+		if err != nil {
+			log.Warnf("Terminal session for %s is not resumable: %v", opts.label, err)
+			key.resumeID = ""
+		}
+		key.owner = owner
+	}
+	resumeID := key.resumeID
+	force := opts.force
+
+	if resumeID != "" {
+		if session := terminalSessions.get(key); session != nil {
+			// The backend protocol is fixed by the original connection
+			multiplexed := opts.multiplexed && session.backend.Subprotocol() == backendConsoleSubprotocol
+			protocol, frontendSubprotocols, _ := negotiateTerminalProtocol(websocket.Subprotocols(r), multiplexed)
+			frontend, err := upgradeFrontend(w, r, frontendSubprotocols)
+			if err != nil {
+				log.Warnf("Failed to upgrade websocket to client: '%v'", err)
+				return
+			}
+			attachToTerminalSession(session, frontend, protocol, force)
+			return
+		}
+	}
+
+	protocol, frontendSubprotocols, backendSubprotocol := negotiateTerminalProtocol(websocket.Subprotocols(r), opts.multiplexed)
+
 	dialer := &websocket.Dialer{
-		TLSClientConfig: t.TlsConfig,
+		TLSClientConfig: t.backendFor(r).TlsConfig,
 	}
 
 	headers := http.Header{}
@@ -235,6 +251,9 @@ func (t TerminalBridge) bridgeWebSocket(w http.ResponseWriter, r *http.Request,
 			headers.Add(key, r.Header.Get(key))
 		}
 	}
+	if backendSubprotocol != "" {
+		headers.Set("Sec-Websocket-Protocol", backendSubprotocol)
+	}
 
 	backend, resp, err := dialer.Dial(consoleURL, headers)
 	if err != nil {
@@ -255,61 +274,83 @@ func (t TerminalBridge) bridgeWebSocket(w http.ResponseWriter, r *http.Request,
 		// On any backend error, upgrade the client to WebSocket to send a close frame
 		// The UI will receive a CloseEvent with a websocket code error and reason.
 		closeReason := fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode))
-		closeCode := websocket.CloseInternalServerErr
-		upgrader := &websocket.Upgrader{
-			Subprotocols: websocket.Subprotocols(r),
-			CheckOrigin:  checkOrigin,
-		}
-		frontend, upgErr := upgrader.Upgrade(w, r, nil)
+		frontend, upgErr := upgradeFrontend(w, r, frontendSubprotocols)
 		if upgErr != nil {
 			log.Warnf("Failed to upgrade websocket for error response: %v", upgErr)
 			return
 		}
-		_ = frontend.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(closeCode, closeReason), time.Now().Add(5*time.Second))
-		frontend.Close()
+		rejectFrontend(frontend, websocket.CloseInternalServerErr, closeReason)
 		return
 	}
-	defer backend.Close()
 
-	upgrader := &websocket.Upgrader{
-		Subprotocols: websocket.Subprotocols(r),
-		CheckOrigin:  checkOrigin,
+	// The multiplexed protocol is translated to the backend's; backends that don't speak it are refused
+	if backendSubprotocol != "" && backend.Subprotocol() != backendSubprotocol {
+		backend.Close()
+		log.Warnf("Backend console for %s negotiated subprotocol %q instead of %q", opts.label, backend.Subprotocol(), backendSubprotocol)
+		frontend, upgErr := upgradeFrontend(w, r, frontendSubprotocols)
+		if upgErr != nil {
+			log.Warnf("Failed to upgrade websocket for error response: %v", upgErr)
+			return
+		}
+		rejectFrontend(frontend, websocket.CloseProtocolError, "Backend does not support the "+terminalMuxSubprotocol+" protocol")
+		return
 	}
 
-	frontend, err := upgrader.Upgrade(w, r, nil)
+	frontend, err := upgradeFrontend(w, r, frontendSubprotocols)
 	if err != nil {
 		log.Warnf("Failed to upgrade websocket to client: '%v'", err)
+		backend.Close()
 		return
 	}
 
-	ticker := time.NewTicker(websocketPingInterval)
-	var writeMutex sync.Mutex // Needed because ticker & copy are writing to frontend in separate goroutines
+	session := newTerminalSession(opts, key, backend)
+	if resumeID != "" {
+		if existing := terminalSessions.add(session); existing != nil {
+			// A concurrent request registered the same resume token first
+			session.close()
+			attachToTerminalSession(existing, frontend, protocol, force)
+			return
+		}
+	}
 
-	defer func() {
-		log.Infof("Closing terminal session for %s", sessionLabel)
-		ticker.Stop()
-		frontend.Close()
-	}()
+	att, err := session.attach(frontend, protocol, false)
+	if err != nil {
+		log.Warnf("Failed to attach terminal session for %s: %v", opts.label, err)
+		rejectFrontend(frontend, websocket.CloseInternalServerErr, "Failed to start terminal session")
+		session.close()
+		return
+	}
+	go session.pumpBackend()
+	session.serve(att)
+}
 
-	errc := make(chan error, 2)
+// attachToTerminalSession reattaches a frontend to a running session of the same user and console.
+func attachToTerminalSession(session *terminalSession, frontend *websocket.Conn, protocol terminalProtocol, force bool) {
+	att, err := session.attach(frontend, protocol, force)
+	if att == nil {
+		log.Infof("Rejected terminal resume for %s: %v", session.label, err)
+		rejectFrontend(frontend, websocket.ClosePolicyViolation, err.Error())
+		return
+	}
+	if err != nil {
+		session.handleFrontendError(att, err)
+		return
+	}
 
-	// Can't just use io.Copy here since browsers care about frame headers.
-	go func() { errc <- copyMsgs(nil, frontend, backend) }()
-	go func() { errc <- copyMsgs(&writeMutex, backend, frontend) }()
+	log.Infof("Resumed terminal session for %s", session.label)
+	session.serve(att)
+}
 
-	for {
-		select {
-		case <-errc:
-			// Only wait for a single error and let the defers close both connections.
-			return
-		case <-ticker.C:
-			writeMutex.Lock()
-			// Send pings to client to prevent load balancers and other middlemen from closing the connection early
-			err := frontend.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(websocketTimeout))
-			writeMutex.Unlock()
-			if err != nil {
-				return
-			}
-		}
+func upgradeFrontend(w http.ResponseWriter, r *http.Request, subprotocols []string) (*websocket.Conn, error) {
+	upgrader := &websocket.Upgrader{
+		Subprotocols: subprotocols,
+		CheckOrigin:  checkOrigin,
 	}
+	return upgrader.Upgrade(w, r, nil)
+}
+
+// rejectFrontend sends a close frame with the given code and reason and closes the connection.
+func rejectFrontend(frontend *websocket.Conn, code int, reason string) {
+	_ = frontend.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(5*time.Second))
+	frontend.Close()
 }
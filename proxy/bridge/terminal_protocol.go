@@ -0,0 +1,189 @@
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/gorilla/websocket"
+)
+
+// Terminal frontend protocols.
+//
+// By default the proxy relays frames between the browser and the backend console unchanged, so the
+// client speaks the backend protocol (v5.channel.k8s.io) itself.
+//
+// A client may instead request the terminal.flightctl.io/v1 subprotocol. Every message on that
+// socket starts with a one-byte channel, followed by the channel payload:
+//
+//	0 data    client->proxy: keyboard input; proxy->client: terminal output (stdout and stderr)
+//	1 resize  client->proxy: JSON {"cols": 120, "rows": 40}, each between 1 and 1000
+//	2 signal  client->proxy: JSON {"signal": "SIGINT"}; one of SIGINT, SIGQUIT, SIGTSTP or EOF
+//	3 status  proxy->client: JSON {"state": "connected"|"resumed"|"pong"|"error", "message": "..."}
+//	          client->proxy: JSON {"state": "ping"}, answered with a "pong" status as a keepalive
+//
+// Messages may be sent as text or binary frames. The proxy translates them to the backend protocol:
+// data goes to stdin, resize to the resize channel, and signals are delivered as the control character
+// the remote TTY turns into that signal. Backend error channel messages become "error" status messages.
+// Invalid client messages are answered with an "error" status and do not end the session.
+const (
+	terminalMuxSubprotocol    = "terminal.flightctl.io/v1"
+	backendConsoleSubprotocol = "v5.channel.k8s.io"
+
+	muxChannelData   byte = 0
+	muxChannelResize byte = 1
+	muxChannelSignal byte = 2
+	muxChannelStatus byte = 3
+
+	k8sChannelStdin  byte = 0
+	k8sChannelStdout byte = 1
+	k8sChannelStderr byte = 2
+	k8sChannelError  byte = 3
+	k8sChannelResize byte = 4
+
+	terminalStateConnected = "connected"
+	terminalStateResumed   = "resumed"
+	terminalStatePing      = "ping"
+	terminalStatePong      = "pong"
+	terminalStateError     = "error"
+
+	maxTerminalDimension = 1000
+)
+
+// terminalSignalInput maps supported signals to the control character a TTY in canonical mode translates into them.
+var terminalSignalInput = map[string]byte{
+	"SIGINT":  0x03, // Ctrl-C
+	"SIGQUIT": 0x1c, // Ctrl-\
+	"SIGTSTP": 0x1a, // Ctrl-Z
+	"EOF":     0x04, // Ctrl-D
+}
+
+type terminalStatus struct {
+	State   string `json:"state"`
+	Message string `json:"message,omitempty"`
+}
+
+type terminalResize struct {
+	Cols int `json:"cols"`
+	Rows int `json:"rows"`
+}
+
+type terminalSignal struct {
+	Signal string `json:"signal"`
+}
+
+// k8sTerminalSize is the resize message expected on the backend resize channel.
+type k8sTerminalSize struct {
+	Width  uint16 `json:"Width"`
+	Height uint16 `json:"Height"`
+}
+
+// terminalProtocol translates between the frontend socket and the backend console protocol.
+type terminalProtocol interface {
+	// fromFrontend returns the frames to send to the backend and any replies for the frontend.
+	fromFrontend(messageType int, msg []byte) (toBackend []wsFrame, replies []wsFrame)
+	// fromBackend returns the frames to send to the frontend.
+	fromBackend(messageType int, msg []byte) []wsFrame
+	// status returns a status frame for the frontend, or nil when the protocol has no status channel.
+	status(state, message string) []wsFrame
+}
+
+// passthroughProtocol relays frames unchanged.
+type passthroughProtocol struct{}
+
+func (passthroughProtocol) fromFrontend(messageType int, msg []byte) ([]wsFrame, []wsFrame) {
+	return []wsFrame{{messageType: messageType, data: msg}}, nil
+}
+
+func (passthroughProtocol) fromBackend(messageType int, msg []byte) []wsFrame {
+	return []wsFrame{{messageType: messageType, data: msg}}
+}
+
+func (passthroughProtocol) status(string, string) []wsFrame {
+	return nil
+}
+
+// muxProtocol implements terminal.flightctl.io/v1 on top of a v5.channel.k8s.io backend.
+type muxProtocol struct{}
+
+func (p muxProtocol) fromFrontend(_ int, msg []byte) ([]wsFrame, []wsFrame) {
+	if len(msg) == 0 {
+		return nil, p.status(terminalStateError, "empty message")
+	}
+	payload := msg[1:]
+	switch msg[0] {
+	case muxChannelData:
+		return []wsFrame{k8sFrame(k8sChannelStdin, payload)}, nil
+	case muxChannelResize:
+		var resize terminalResize
+		if err := json.Unmarshal(payload, &resize); err != nil {
+			return nil, p.status(terminalStateError, "invalid resize message")
+		}
+		if resize.Cols < 1 || resize.Cols > maxTerminalDimension || resize.Rows < 1 || resize.Rows > maxTerminalDimension {
+			return nil, p.status(terminalStateError, "invalid terminal size")
+		}
+		size, err := json.Marshal(k8sTerminalSize{Width: uint16(resize.Cols), Height: uint16(resize.Rows)})
+		if err != nil {
+			return nil, p.status(terminalStateError, "invalid terminal size")
+		}
+		return []wsFrame{k8sFrame(k8sChannelResize, size)}, nil
+	case muxChannelSignal:
+		var signal terminalSignal
+		if err := json.Unmarshal(payload, &signal); err != nil {
+			return nil, p.status(terminalStateError, "invalid signal message")
+		}
+		input, ok := terminalSignalInput[signal.Signal]
+		if !ok {
+			return nil, p.status(terminalStateError, fmt.Sprintf("unsupported signal %q", signal.Signal))
+		}
+		return []wsFrame{k8sFrame(k8sChannelStdin, []byte{input})}, nil
+	case muxChannelStatus:
+		var status terminalStatus
+		if err := json.Unmarshal(payload, &status); err != nil || status.State != terminalStatePing {
+			return nil, p.status(terminalStateError, "invalid status message")
+		}
+		return nil, p.status(terminalStatePong, "")
+	default:
+		return nil, p.status(terminalStateError, fmt.Sprintf("unknown channel %d", msg[0]))
+	}
+}
+
+func (p muxProtocol) fromBackend(_ int, msg []byte) []wsFrame {
+	if len(msg) == 0 {
+		return nil
+	}
+	switch msg[0] {
+	case k8sChannelStdout, k8sChannelStderr:
+		return []wsFrame{muxFrame(muxChannelData, msg[1:])}
+	case k8sChannelError:
+		return p.status(terminalStateError, string(msg[1:]))
+	default:
+		return nil
+	}
+}
+
+func (muxProtocol) status(state, message string) []wsFrame {
+	payload, err := json.Marshal(terminalStatus{State: state, Message: message})
+	if err != nil {
+		return nil
+	}
+	return []wsFrame{muxFrame(muxChannelStatus, payload)}
+}
+
+func k8sFrame(channel byte, payload []byte) wsFrame {
+	return wsFrame{messageType: websocket.BinaryMessage, data: append([]byte{channel}, payload...)}
+}
+
+func muxFrame(channel byte, payload []byte) wsFrame {
+	return wsFrame{messageType: websocket.BinaryMessage, data: append([]byte{channel}, payload...)}
+}
+
+// negotiateTerminalProtocol picks the frontend protocol. When the client offers terminal.flightctl.io/v1,
+// the proxy answers with it and talks v5.channel.k8s.io to the backend; otherwise subprotocols are relayed as-is.
+// It returns the subprotocols to offer to the frontend and the one to request from the backend (empty to relay).
+func negotiateTerminalProtocol(clientSubprotocols []string, multiplexed bool) (terminalProtocol, []string, string) {
+	if multiplexed && slices.Contains(clientSubprotocols, terminalMuxSubprotocol) {
+		return muxProtocol{}, []string{terminalMuxSubprotocol}, backendConsoleSubprotocol
+	}
+	return passthroughProtocol{}, clientSubprotocols, ""
+}
@@ -0,0 +1,220 @@
+package bridge
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newK8sConsoleBackend starts a fake v5.channel.k8s.io console. Every frame it receives is reported
+// on the returned channel; stdin is echoed on stdout, and stdin "fail" produces an error channel message.
+func newK8sConsoleBackend(t *testing.T) (*httptest.Server, <-chan []byte) {
+	received := make(chan []byte, 16)
+	upgrader := websocket.Upgrader{Subprotocols: []string{backendConsoleSubprotocol}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if conn.Subprotocol() != backendConsoleSubprotocol {
+			_ = conn.WriteMessage(websocket.BinaryMessage, []byte{k8sChannelError, 'x'})
+			return
+		}
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- msg
+			if len(msg) == 0 || msg[0] != k8sChannelStdin {
+				continue
+			}
+			reply := append([]byte{k8sChannelStdout}, msg[1:]...)
+			if string(msg[1:]) == "fail" {
+				reply = append([]byte{k8sChannelError}, []byte(`{"status":"Failure"}`)...)
+			}
+			if err := conn.WriteMessage(websocket.BinaryMessage, reply); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, received
+}
+
+func newTerminalProxy(t *testing.T, backendURL string) *httptest.Server {
+	bridge := TerminalBridge{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bridge.bridgeWebSocket(w, r, backendURL, terminalBridgeOptions("test", "", false))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func dialTerminal(t *testing.T, proxyURL, subprotocol string) *websocket.Conn {
+	t.Helper()
+	dialer := websocket.Dialer{Subprotocols: []string{subprotocol}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(proxyURL, "http"), nil)
+	if err != nil {
+		t.Fatalf("failed to dial proxy: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if conn.Subprotocol() != subprotocol {
+		t.Fatalf("expected subprotocol %q, got %q", subprotocol, conn.Subprotocol())
+	}
+	return conn
+}
+
+func readFrame(t *testing.T, conn *websocket.Conn) []byte {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, msg, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("failed to read frame: %v", err)
+	}
+	return msg
+}
+
+func readStatus(t *testing.T, conn *websocket.Conn) terminalStatus {
+	t.Helper()
+	msg := readFrame(t, conn)
+	if len(msg) == 0 || msg[0] != muxChannelStatus {
+		t.Fatalf("expected status frame, got %q", msg)
+	}
+	var status terminalStatus
+	if err := json.Unmarshal(msg[1:], &status); err != nil {
+		t.Fatalf("invalid status payload %q: %v", msg[1:], err)
+	}
+	return status
+}
+
+func expectBackendFrame(t *testing.T, received <-chan []byte, want []byte) {
+	t.Helper()
+	select {
+	case got := <-received:
+		if !bytes.Equal(got, want) {
+			t.Fatalf("expected backend frame %q, got %q", want, got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("backend did not receive %q", want)
+	}
+}
+
+func sendMux(t *testing.T, conn *websocket.Conn, channel byte, payload string) {
+	t.Helper()
+	if err := conn.WriteMessage(websocket.BinaryMessage, append([]byte{channel}, payload...)); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+}
+
+func TestMuxProtocolTranslatesChannels(t *testing.T) {
+	t.Parallel()
+
+	backend, received := newK8sConsoleBackend(t)
+	proxy := newTerminalProxy(t, "ws"+strings.TrimPrefix(backend.URL, "http"))
+	conn := dialTerminal(t, proxy.URL, terminalMuxSubprotocol)
+
+	if status := readStatus(t, conn); status.State != terminalStateConnected {
+		t.Fatalf("expected connected status, got %+v", status)
+	}
+
+	sendMux(t, conn, muxChannelData, "ls\r")
+	expectBackendFrame(t, received, []byte("\x00ls\r"))
+	if got := readFrame(t, conn); !bytes.Equal(got, []byte("\x00ls\r")) {
+		t.Fatalf("expected output on data channel, got %q", got)
+	}
+
+	sendMux(t, conn, muxChannelResize, `{"cols":120,"rows":40}`)
+	expectBackendFrame(t, received, []byte("\x04{\"Width\":120,\"Height\":40}"))
+
+	sendMux(t, conn, muxChannelSignal, `{"signal":"SIGINT"}`)
+	expectBackendFrame(t, received, []byte{k8sChannelStdin, 0x03})
+	readFrame(t, conn) // echoed Ctrl-C
+
+	sendMux(t, conn, muxChannelStatus, `{"state":"ping"}`)
+	if status := readStatus(t, conn); status.State != terminalStatePong {
+		t.Fatalf("expected pong status, got %+v", status)
+	}
+
+	sendMux(t, conn, muxChannelData, "fail")
+	expectBackendFrame(t, received, []byte("\x00fail"))
+	if status := readStatus(t, conn); status.State != terminalStateError || status.Message != `{"status":"Failure"}` {
+		t.Fatalf("expected backend error as status, got %+v", status)
+	}
+}
+
+func TestMuxProtocolRejectsInvalidMessagesWithoutClosing(t *testing.T) {
+	t.Parallel()
+
+	backend, received := newK8sConsoleBackend(t)
+	proxy := newTerminalProxy(t, "ws"+strings.TrimPrefix(backend.URL, "http"))
+	conn := dialTerminal(t, proxy.URL, terminalMuxSubprotocol)
+	readStatus(t, conn)
+
+	invalid := []struct {
+		channel byte
+		payload string
+	}{
+		{muxChannelResize, `{"cols":0,"rows":40}`},
+		{muxChannelResize, `not json`},
+		{muxChannelSignal, `{"signal":"SIGKILL"}`},
+		{muxChannelStatus, `{"state":"connected"}`},
+		{9, "x"},
+	}
+	for _, msg := range invalid {
+		sendMux(t, conn, msg.channel, msg.payload)
+		if status := readStatus(t, conn); status.State != terminalStateError {
+			t.Fatalf("expected error status for %q, got %+v", msg.payload, status)
+		}
+	}
+
+	sendMux(t, conn, muxChannelData, "ok")
+	expectBackendFrame(t, received, []byte("\x00ok"))
+}
+
+func TestPassthroughProtocolRelaysFramesUnchanged(t *testing.T) {
+	t.Parallel()
+
+	backend, received := newK8sConsoleBackend(t)
+	proxy := newTerminalProxy(t, "ws"+strings.TrimPrefix(backend.URL, "http"))
+	conn := dialTerminal(t, proxy.URL, backendConsoleSubprotocol)
+
+	if err := conn.WriteMessage(websocket.BinaryMessage, []byte("\x00pwd")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	expectBackendFrame(t, received, []byte("\x00pwd"))
+	if got := readFrame(t, conn); !bytes.Equal(got, []byte("\x01pwd")) {
+		t.Fatalf("expected raw backend frame, got %q", got)
+	}
+}
+
+func TestMuxProtocolRejectsBackendsWithoutConsoleSubprotocol(t *testing.T) {
+	t.Parallel()
+
+	// An older backend that ignores the requested subprotocol
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrader := websocket.Upgrader{}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _, _ = conn.ReadMessage()
+	}))
+	t.Cleanup(backend.Close)
+	proxy := newTerminalProxy(t, "ws"+strings.TrimPrefix(backend.URL, "http"))
+	conn := dialTerminal(t, proxy.URL, terminalMuxSubprotocol)
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseProtocolError) {
+		t.Fatalf("expected a protocol error close, got %v", err)
+	}
+}
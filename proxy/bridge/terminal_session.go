@@ -0,0 +1,464 @@
+package bridge
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/flightctl/flightctl-ui/common"
+	"github.com/flightctl/flightctl-ui/config"
+	"github.com/flightctl/flightctl-ui/upstream"
+	"github.com/flightctl/flightctl/api/v1beta1"
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+// terminalResumeQueryParam is the client-generated UUID identifying a resumable terminal session.
+// Reconnecting with the same value within the grace period reattaches to the running backend session.
+const terminalResumeQueryParam = "resume"
+
+// maxUserInfoSize bounds the user info read to identify the owner of a session
+const maxUserInfoSize = 1 << 20
+
+var errTerminalSessionInUse = errors.New("terminal session is attached to another client")
+
+// wsFrame is a single WebSocket message.
+type wsFrame struct {
+	messageType int
+	data        []byte
+}
+
+// frameRingBuffer keeps the most recent backend frames that could not be delivered to the frontend up to maxBytes of payload, dropping the oldest first.
+type frameRingBuffer struct {
+	frames   []wsFrame
+	size     int
+	maxBytes int
+}
+
+func newFrameRingBuffer(maxBytes int) *frameRingBuffer {
+	return &frameRingBuffer{maxBytes: maxBytes}
+}
+
+func (b *frameRingBuffer) add(messageType int, data []byte) {
+	if len(data) > b.maxBytes {
+		// Keep only the tail of a frame that would not fit on its own
+		data = data[len(data)-b.maxBytes:]
+	}
+	b.frames = append(b.frames, wsFrame{messageType: messageType, data: data})
+	b.size += len(data)
+	for b.size > b.maxBytes && len(b.frames) > 0 {
+		b.size -= len(b.frames[0].data)
+		b.frames = b.frames[1:]
+	}
+}
+
+func (b *frameRingBuffer) drain() []wsFrame {
+	frames := b.frames
+	b.frames = nil
+	b.size = 0
+	return frames
+}
+
+// terminalAttachment is a single browser connection attached to a terminal session.
+type terminalAttachment struct {
+	conn     *websocket.Conn
+	protocol terminalProtocol
+	writeMu  sync.Mutex // Needed because the ping ticker & backend pump write to the frontend in separate goroutines
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+func newTerminalAttachment(conn *websocket.Conn, protocol terminalProtocol) *terminalAttachment {
+	return &terminalAttachment{conn: conn, protocol: protocol, done: make(chan struct{})}
+}
+
+// write sends frames to the frontend. The caller must hold writeMu.
+func (a *terminalAttachment) write(frames []wsFrame) error {
+	for _, frame := range frames {
+		if err := a.conn.WriteMessage(frame.messageType, frame.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *terminalAttachment) detach() {
+	a.doneOnce.Do(func() { close(a.done) })
+}
+
+// terminalSession owns the backend console connection. Frontend connections attach to it and,
+// for resumable sessions, may detach and reattach within the grace period without losing the shell.
+type terminalSession struct {
+	key     terminalSessionKey
+	label   string
+	grace   time.Duration
+	backend *websocket.Conn
+	// backendMu serializes writes to the backend while a takeover briefly overlaps two frontends
+	backendMu sync.Mutex
+
+	// downLimiter and upLimiter cap device-to-browser and browser-to-device throughput
+	downLimiter *throughputLimiter
+	upLimiter   *throughputLimiter
+	throttled   atomic.Bool
+	// done is closed when the session ends, releasing throttled pumps
+	done chan struct{}
+
+	mu         sync.Mutex
+	attached   *terminalAttachment
+	output     *frameRingBuffer
+	graceTimer *time.Timer
+	closed     bool
+	// resumed is set once the first frontend has attached
+	resumed bool
+}
+
+// newTerminalSession wraps an established backend connection. A key without resumeID creates a
+// non-resumable session that ends as soon as its frontend disconnects.
+func newTerminalSession(opts bridgeOptions, key terminalSessionKey, backend *websocket.Conn) *terminalSession {
+	s := &terminalSession{
+		key:         key,
+		label:       opts.label,
+		backend:     backend,
+		downLimiter: newThroughputLimiter(opts.downloadBytesPerSecond),
+		upLimiter:   newThroughputLimiter(opts.uploadBytesPerSecond),
+		done:        make(chan struct{}),
+		output:      newFrameRingBuffer(config.TerminalResumeBufferSize),
+	}
+	if s.key.resumeID != "" {
+		s.grace = config.TerminalResumeGracePeriod
+	}
+	backend.SetReadLimit(int64(config.TerminalMaxMessageSize))
+	terminalMetrics.Add(metricActiveSessions, 1)
+	return s
+}
+
+// attach makes conn the active frontend, replaying any output buffered while detached.
+// If another frontend is attached, it is only replaced when force is set.
+func (s *terminalSession) attach(conn *websocket.Conn, protocol terminalProtocol, force bool) (*terminalAttachment, error) {
+	conn.SetReadLimit(int64(config.TerminalMaxMessageSize))
+	att := newTerminalAttachment(conn, protocol)
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, errors.New("terminal session has ended")
+	}
+	previous := s.attached
+	if previous != nil && !force {
+		s.mu.Unlock()
+		return nil, errTerminalSessionInUse
+	}
+	if s.graceTimer != nil {
+		s.graceTimer.Stop()
+		s.graceTimer = nil
+	}
+	s.attached = att
+	state := terminalStateConnected
+	if s.resumed {
+		state = terminalStateResumed
+	}
+	s.resumed = true
+	frames := s.output.drain()
+	// Hold the frontend write lock before releasing the session lock so that the backend pump
+	// cannot interleave new output with the replayed frames.
+	att.writeMu.Lock()
+	s.mu.Unlock()
+
+	if previous != nil {
+		log.Infof("Terminal session for %s taken over by a new client", s.label)
+		previous.detach()
+		writeCloseFrame(&previous.writeMu, previous.conn, websocket.ClosePolicyViolation, "Terminal session was opened in another window")
+		previous.conn.Close()
+	}
+
+	err := att.write(protocol.status(state, ""))
+	for _, frame := range frames {
+		if err != nil {
+			break
+		}
+		err = att.write(protocol.fromBackend(frame.messageType, frame.data))
+	}
+	att.writeMu.Unlock()
+	return att, err
+}
+
+// serve runs the frontend side of an attachment until the client disconnects or is replaced.
+func (s *terminalSession) serve(att *terminalAttachment) {
+	ticker := time.NewTicker(websocketPingInterval)
+	defer ticker.Stop()
+
+	errc := make(chan error, 1)
+	go func() { errc <- s.pumpFrontend(att) }()
+
+	for {
+		select {
+		case err := <-errc:
+			s.handleFrontendError(att, err)
+			return
+		case <-att.done:
+			return
+		case <-ticker.C:
+			att.writeMu.Lock()
+			// Send pings to client to prevent load balancers and other middlemen from closing the connection early
+			err := att.conn.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(websocketTimeout))
+			att.writeMu.Unlock()
+			if err != nil {
+				s.handleFrontendError(att, err)
+				return
+			}
+		}
+	}
+}
+
+func (s *terminalSession) pumpFrontend(att *terminalAttachment) error {
+	for {
+		messageType, msg, err := att.conn.ReadMessage()
+		if err != nil {
+			if errors.Is(err, websocket.ErrReadLimit) {
+				log.Warnf("Terminal input for %s exceeded %d bytes", s.label, config.TerminalMaxMessageSize)
+				terminalMetrics.Add(metricOversizedMessages, 1)
+			}
+			return err
+		}
+		toBackend, replies := att.protocol.fromFrontend(messageType, msg)
+		if len(replies) > 0 {
+			att.writeMu.Lock()
+			err = att.write(replies)
+			att.writeMu.Unlock()
+			if err != nil {
+				return err
+			}
+		}
+
+		s.throttle(s.upLimiter, len(msg))
+		terminalMetrics.Add(metricUploadedBytes, int64(len(msg)))
+		s.backendMu.Lock()
+		for _, frame := range toBackend {
+			if err = s.backend.WriteMessage(frame.messageType, frame.data); err != nil {
+				break
+			}
+		}
+		s.backendMu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// pumpBackend forwards backend output for the lifetime of the session. Output produced while
+// no frontend is attached is kept in the ring buffer for replay on resume.
+func (s *terminalSession) pumpBackend() {
+	for {
+		messageType, msg, err := s.backend.ReadMessage()
+		if err != nil {
+			var closeErr *websocket.CloseError
+			s.mu.Lock()
+			att := s.attached
+			s.mu.Unlock()
+			if errors.Is(err, websocket.ErrReadLimit) {
+				log.Warnf("Terminal output for %s exceeded %d bytes", s.label, config.TerminalMaxMessageSize)
+				terminalMetrics.Add(metricOversizedMessages, 1)
+				if att != nil {
+					writeCloseFrame(&att.writeMu, att.conn, websocket.CloseMessageTooBig, "Terminal output message too large")
+				}
+			} else if att != nil && errors.As(err, &closeErr) {
+				writeCloseFrame(&att.writeMu, att.conn, closeErr.Code, closeErr.Text)
+			}
+			s.close()
+			return
+		}
+		s.throttle(s.downLimiter, len(msg))
+		terminalMetrics.Add(metricDownloadedBytes, int64(len(msg)))
+
+		s.mu.Lock()
+		att := s.attached
+		if att == nil {
+			s.output.add(messageType, msg)
+		}
+		s.mu.Unlock()
+		if att == nil {
+			continue
+		}
+
+		att.writeMu.Lock()
+		err = att.write(att.protocol.fromBackend(messageType, msg))
+		att.writeMu.Unlock()
+		if err != nil {
+			s.mu.Lock()
+			s.output.add(messageType, msg)
+			s.mu.Unlock()
+		}
+	}
+}
+
+// throttle waits for the limiter and records the first time a session is held back.
+func (s *terminalSession) throttle(limiter *throughputLimiter, n int) {
+	delay := limiter.wait(n, s.done)
+	if delay == 0 {
+		return
+	}
+	terminalMetrics.Add(metricThrottledMillis, delay.Milliseconds())
+	if s.throttled.CompareAndSwap(false, true) {
+		log.Infof("Throttling terminal session for %s", s.label)
+		terminalMetrics.Add(metricThrottledSessions, 1)
+	}
+}
+
+// handleFrontendError detaches the frontend. A resumable session stays alive for the grace period
+// unless the client closed the terminal deliberately (normal closure).
+func (s *terminalSession) handleFrontendError(att *terminalAttachment, err error) {
+	var closeErr *websocket.CloseError
+	isCloseErr := errors.As(err, &closeErr)
+
+	s.mu.Lock()
+	if s.attached != att {
+		// Already replaced by a forced takeover
+		s.mu.Unlock()
+		return
+	}
+	s.attached = nil
+	att.detach()
+	keepAlive := s.grace > 0 && !s.closed && !(isCloseErr && closeErr.Code == websocket.CloseNormalClosure)
+	if keepAlive {
+		s.graceTimer = time.AfterFunc(s.grace, s.expire)
+	}
+	s.mu.Unlock()
+
+	att.conn.Close()
+	if keepAlive {
+		log.Infof("Terminal session for %s detached, keeping it for %s", s.label, s.grace)
+		return
+	}
+	if isCloseErr {
+		writeCloseFrame(&s.backendMu, s.backend, closeErr.Code, closeErr.Text)
+	}
+	s.close()
+}
+
+func (s *terminalSession) expire() {
+	s.mu.Lock()
+	expired := s.attached == nil && !s.closed
+	s.mu.Unlock()
+	if expired {
+		log.Infof("Terminal session for %s was not resumed within %s", s.label, s.grace)
+		writeCloseFrame(&s.backendMu, s.backend, websocket.CloseGoingAway, "Client did not reconnect")
+		s.close()
+	}
+}
+
+func (s *terminalSession) close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	close(s.done)
+	att := s.attached
+	s.attached = nil
+	if s.graceTimer != nil {
+		s.graceTimer.Stop()
+		s.graceTimer = nil
+	}
+	s.mu.Unlock()
+
+	if s.key.resumeID != "" {
+		terminalSessions.remove(s)
+	}
+	log.Infof("Closing terminal session for %s", s.label)
+	terminalMetrics.Add(metricActiveSessions, -1)
+	s.backend.Close()
+	if att != nil {
+		att.detach()
+		att.conn.Close()
+	}
+}
+
+// terminalSessionKey identifies a resumable session: a resume token only reattaches to the session
+// its owner started on the same console.
+type terminalSessionKey struct {
+	owner      string
+	consoleURL string
+	resumeID   string
+}
+
+// terminalSessionRegistry tracks resumable sessions by their key.
+type terminalSessionRegistry struct {
+	mu       sync.Mutex
+	sessions map[terminalSessionKey]*terminalSession
+}
+
+var terminalSessions = &terminalSessionRegistry{sessions: map[terminalSessionKey]*terminalSession{}}
+
+func (r *terminalSessionRegistry) get(key terminalSessionKey) *terminalSession {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sessions[key]
+}
+
+// add registers s unless a session with the same key already exists, in which case the existing one is returned.
+func (r *terminalSessionRegistry) add(s *terminalSession) *terminalSession {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.sessions[s.key]; ok {
+		return existing
+	}
+	r.sessions[s.key] = s
+	return nil
+}
+
+func (r *terminalSessionRegistry) remove(s *terminalSession) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.sessions[s.key] == s {
+		delete(r.sessions, s.key)
+	}
+}
+
+// terminalSessionOwner identifies the user that may resume a session, without retaining their token:
+// the backend and the username the backend authenticates the request's credentials as, so sessions
+// can still be resumed after the token is refreshed. Requests without credentials have no owner.
+func terminalSessionOwner(r *http.Request, api *upstream.Backend) (string, error) {
+	authHeader := r.Header.Get(common.AuthHeaderKey)
+	if authHeader == "" {
+		return "", errors.New("request has no credentials")
+	}
+	userInfoURL, err := api.ApiURL("api/v1/auth/userinfo")
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, userInfoURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", authHeader)
+	req.Header.Set("Accept", "application/json")
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: api.TlsConfig,
+		},
+		Timeout: websocketTimeout,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get user info: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("getting user info returned status %d", resp.StatusCode)
+	}
+	var userInfo v1beta1.UserInfoResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxUserInfoSize)).Decode(&userInfo); err != nil {
+		return "", fmt.Errorf("failed to parse user info: %w", err)
+	}
+	if userInfo.PreferredUsername == nil || *userInfo.PreferredUsername == "" {
+		return "", errors.New("user info has no username")
+	}
+	return api.Name + "/" + *userInfo.PreferredUsername, nil
+}
@@ -0,0 +1,238 @@
+package bridge
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flightctl/flightctl-ui/upstream"
+	"github.com/flightctl/flightctl/api/v1beta1"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+func TestFrameRingBufferDropsOldestFrames(t *testing.T) {
+	t.Parallel()
+
+	buf := newFrameRingBuffer(8)
+	buf.add(websocket.BinaryMessage, []byte("abcd"))
+	buf.add(websocket.BinaryMessage, []byte("efgh"))
+	buf.add(websocket.BinaryMessage, []byte("ij"))
+
+	frames := buf.drain()
+	if len(frames) != 2 || string(frames[0].data) != "efgh" || string(frames[1].data) != "ij" {
+		t.Fatalf("unexpected frames after overflow: %+v", frames)
+	}
+	if len(buf.drain()) != 0 {
+		t.Fatal("expected buffer to be empty after drain")
+	}
+
+	buf.add(websocket.BinaryMessage, []byte("0123456789"))
+	frames = buf.drain()
+	if len(frames) != 1 || string(frames[0].data) != "23456789" {
+		t.Fatalf("expected oversized frame to be truncated to its tail, got %+v", frames)
+	}
+}
+
+// newEchoBackend starts a fake console that echoes every frame. A "slow" frame is answered
+// with "done" after a delay, so tests can produce output while the frontend is detached.
+func newEchoBackend(t *testing.T) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			mt, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if string(msg) == "slow" {
+				time.Sleep(100 * time.Millisecond)
+				msg = []byte("done")
+			}
+			if err := conn.WriteMessage(mt, msg); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// terminalUsers maps the tokens accepted by the fake user info API to their user
+var terminalUsers = map[string]string{
+	"Bearer token-a":           "alice",
+	"Bearer token-a-refreshed": "alice",
+	"Bearer token-b":           "bob",
+}
+
+// newResumableProxy bridges to the console at backendURL, with the device of the "device" query
+// parameter. Users are identified by a fake user info API.
+func newResumableProxy(t *testing.T, backendURL string) *httptest.Server {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := terminalUsers[r.Header.Get("Authorization")]
+		if r.URL.Path != "/api/v1/auth/userinfo" || !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(v1beta1.UserInfoResponse{PreferredUsername: &user})
+	}))
+	t.Cleanup(api.Close)
+	backends, err := upstream.NewRegistry([]*upstream.Backend{{Name: "default", ApiUrl: api.URL}}, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bridge := TerminalBridge{Backends: backends}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resumeID, err := parseTerminalResumeID(r.URL.Query())
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		consoleURL := backendURL + "?device=" + r.URL.Query().Get("device")
+		bridge.bridgeWebSocket(w, r, consoleURL, terminalBridgeOptions("test", resumeID, r.URL.Query().Get("force") == "true"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func dialProxy(t *testing.T, proxyURL, query, token string) *websocket.Conn {
+	t.Helper()
+	headers := http.Header{}
+	if token != "" {
+		headers.Set("Authorization", "Bearer "+token)
+	}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(proxyURL, "http")+"?"+query, headers)
+	if err != nil {
+		t.Fatalf("failed to dial proxy: %v", err)
+	}
+	return conn
+}
+
+func readText(t *testing.T, conn *websocket.Conn) string {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, msg, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("failed to read message: %v", err)
+	}
+	return string(msg)
+}
+
+func TestTerminalSessionResumeReplaysMissedOutput(t *testing.T) {
+	t.Parallel()
+
+	backend := newEchoBackend(t)
+	proxy := newResumableProxy(t, "ws"+strings.TrimPrefix(backend.URL, "http"))
+	query := terminalResumeQueryParam + "=" + uuid.NewString()
+
+	first := dialProxy(t, proxy.URL, query, "token-a")
+	if err := first.WriteMessage(websocket.TextMessage, []byte("hello")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if got := readText(t, first); got != "hello" {
+		t.Fatalf("expected echo, got %q", got)
+	}
+	if err := first.WriteMessage(websocket.TextMessage, []byte("slow")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	// Drop the connection without a close frame, as a network blip would
+	first.Close()
+	time.Sleep(300 * time.Millisecond)
+
+	// Resuming survives a token refresh
+	second := dialProxy(t, proxy.URL, query, "token-a-refreshed")
+	defer second.Close()
+	if got := readText(t, second); got != "done" {
+		t.Fatalf("expected buffered output to be replayed, got %q", got)
+	}
+	if err := second.WriteMessage(websocket.TextMessage, []byte("again")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if got := readText(t, second); got != "again" {
+		t.Fatalf("expected echo after resume, got %q", got)
+	}
+}
+
+func TestTerminalSessionResumeRequiresSameUserAndForce(t *testing.T) {
+	t.Parallel()
+
+	backend := newEchoBackend(t)
+	proxy := newResumableProxy(t, "ws"+strings.TrimPrefix(backend.URL, "http"))
+	query := terminalResumeQueryParam + "=" + uuid.NewString()
+
+	first := dialProxy(t, proxy.URL, query, "token-a")
+	defer first.Close()
+	if err := first.WriteMessage(websocket.TextMessage, []byte("hello")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	readText(t, first)
+
+	expectClose := func(conn *websocket.Conn, code int) {
+		t.Helper()
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, _, err := conn.ReadMessage()
+		var closeErr *websocket.CloseError
+		if !errors.As(err, &closeErr) || closeErr.Code != code {
+			t.Fatalf("expected close code %d, got %v", code, err)
+		}
+	}
+
+	// Another user's resume token, or one for another device, starts a separate session
+	for _, conn := range []*websocket.Conn{
+		dialProxy(t, proxy.URL, query, "token-b"),
+		dialProxy(t, proxy.URL, query+"&device=other", "token-a"),
+	} {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte("separate")); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		if got := readText(t, conn); got != "separate" {
+			t.Fatalf("expected a separate session, got %q", got)
+		}
+		conn.Close()
+	}
+
+	inUse := dialProxy(t, proxy.URL, query, "token-a")
+	expectClose(inUse, websocket.ClosePolicyViolation)
+
+	takeover := dialProxy(t, proxy.URL, query+"&force=true", "token-a")
+	defer takeover.Close()
+	expectClose(first, websocket.ClosePolicyViolation)
+	if err := takeover.WriteMessage(websocket.TextMessage, []byte("mine")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if got := readText(t, takeover); got != "mine" {
+		t.Fatalf("expected echo after takeover, got %q", got)
+	}
+}
+
+func TestTerminalSessionWithoutCredentialsIsNotResumable(t *testing.T) {
+	t.Parallel()
+
+	backend := newEchoBackend(t)
+	proxy := newResumableProxy(t, "ws"+strings.TrimPrefix(backend.URL, "http"))
+	query := terminalResumeQueryParam + "=" + uuid.NewString()
+
+	first := dialProxy(t, proxy.URL, query, "")
+	if err := first.WriteMessage(websocket.TextMessage, []byte("slow")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	first.Close()
+	time.Sleep(300 * time.Millisecond)
+
+	second := dialProxy(t, proxy.URL, query, "")
+	defer second.Close()
+	if err := second.WriteMessage(websocket.TextMessage, []byte("fresh")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if got := readText(t, second); got != "fresh" {
+		t.Fatalf("expected a new session without replayed output, got %q", got)
+	}
+}
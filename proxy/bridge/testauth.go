@@ -11,6 +11,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/flightctl/flightctl-ui/common"
 	"github.com/flightctl/flightctl-ui/log"
 )
 
@@ -64,8 +65,7 @@ func (h *TestAuthHandler) TestConnection(w http.ResponseWriter, r *http.Request)
 	}
 
 	var req TestConnectionRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+	if !common.DecodeJSONBody(w, r, &req) {
 		return
 	}
 
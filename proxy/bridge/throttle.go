@@ -0,0 +1,75 @@
+package bridge
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+// terminalMetrics exposes terminal session counters through expvar (see config.MetricsPort).
+var terminalMetrics = expvar.NewMap("terminal")
+
+const (
+	metricActiveSessions    = "activeSessions"
+	metricThrottledSessions = "throttledSessions"
+	metricThrottledMillis   = "throttledMilliseconds"
+	metricOversizedMessages = "oversizedMessages"
+	metricDownloadedBytes   = "downloadedBytes"
+	metricUploadedBytes     = "uploadedBytes"
+)
+
+// throughputBurstSeconds is how many seconds worth of traffic may be sent at once.
+const throughputBurstSeconds = 1
+
+// throughputLimiter is a token bucket limiting a stream to a number of bytes per second,
+// allowing bursts of up to one second worth of traffic.
+// Messages larger than the available tokens put the bucket into debt, so the caller waits
+// proportionally to the message size instead of being rejected.
+type throughputLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// newThroughputLimiter returns nil when bytesPerSecond is zero, meaning unlimited.
+func newThroughputLimiter(bytesPerSecond int) *throughputLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &throughputLimiter{
+		rate:   float64(bytesPerSecond),
+		tokens: float64(bytesPerSecond) * throughputBurstSeconds,
+		last:   time.Now(),
+	}
+}
+
+// wait blocks until n bytes may be sent or done is closed, and returns how long the caller was held back.
+// Holding the caller stops it from reading its source, which applies backpressure to the sender.
+func (l *throughputLimiter) wait(n int, done <-chan struct{}) time.Duration {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if burst := l.rate * throughputBurstSeconds; l.tokens > burst {
+		l.tokens = burst
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-done:
+	}
+	return delay
+}
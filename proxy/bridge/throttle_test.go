@@ -0,0 +1,45 @@
+package bridge
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThroughputLimiterUnlimited(t *testing.T) {
+	t.Parallel()
+
+	limiter := newThroughputLimiter(0)
+	if limiter != nil {
+		t.Fatal("expected nil limiter for zero rate")
+	}
+	if delay := limiter.wait(1<<20, nil); delay != 0 {
+		t.Fatalf("expected unlimited limiter not to wait, got %s", delay)
+	}
+}
+
+func TestThroughputLimiterWaitsForDebt(t *testing.T) {
+	t.Parallel()
+
+	limiter := newThroughputLimiter(1000)
+	if delay := limiter.wait(1000, nil); delay != 0 {
+		t.Fatalf("expected burst to pass without waiting, got %s", delay)
+	}
+	start := time.Now()
+	delay := limiter.wait(100, nil)
+	if delay < 50*time.Millisecond || time.Since(start) < 50*time.Millisecond {
+		t.Fatalf("expected about 100ms of throttling, got %s", delay)
+	}
+}
+
+func TestThroughputLimiterReleasedWhenDone(t *testing.T) {
+	t.Parallel()
+
+	limiter := newThroughputLimiter(10)
+	done := make(chan struct{})
+	close(done)
+	start := time.Now()
+	limiter.wait(1000, done)
+	if time.Since(start) > time.Second {
+		t.Fatal("expected wait to return once done is closed")
+	}
+}
@@ -0,0 +1,16 @@
+package common
+
+import "context"
+
+type organizationIDKey struct{}
+
+// WithOrganizationID returns a context carrying the organization validated for the request.
+func WithOrganizationID(ctx context.Context, orgID string) context.Context {
+	return context.WithValue(ctx, organizationIDKey{}, orgID)
+}
+
+// OrganizationIDFromContext returns the organization validated for the request by OrganizationMiddleware, if any.
+func OrganizationIDFromContext(ctx context.Context) (string, bool) {
+	orgID, ok := ctx.Value(organizationIDKey{}).(string)
+	return orgID, ok && orgID != ""
+}
@@ -0,0 +1,36 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// IsBodyTooLarge reports whether err comes from reading a request body over its size limit
+// (see middleware.RequestLimitsMiddleware).
+func IsBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+// RespondWithBodyTooLarge writes the 413 error returned for request bodies over their size limit.
+func RespondWithBodyTooLarge(w http.ResponseWriter) {
+	RespondWithJSONError(w, http.StatusRequestEntityTooLarge, "Request body is too large", "REQUEST_TOO_LARGE")
+}
+
+// DecodeJSONBody decodes the JSON request body into dst, rejecting fields dst does not declare.
+// When the body can't be decoded it responds with 413 (body over its size limit) or 400, and returns false.
+func DecodeJSONBody(w http.ResponseWriter, r *http.Request, dst any) bool {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(dst)
+	switch {
+	case err == nil:
+		return true
+	case IsBodyTooLarge(err):
+		RespondWithBodyTooLarge(w)
+	default:
+		RespondWithJSONError(w, http.StatusBadRequest, "Invalid request body: "+err.Error(), "INVALID_REQUEST_BODY")
+	}
+	return false
+}
@@ -0,0 +1,19 @@
+package common
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// RespondWithJSONError writes the {"error": ..., "code": ...} payload the UI expects
+// when the proxy itself rejects a request.
+func RespondWithJSONError(w http.ResponseWriter, status int, message, code string) {
+	payload, err := json.Marshal(map[string]string{"error": message, "code": code})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(payload)
+}
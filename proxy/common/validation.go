@@ -30,7 +30,12 @@ func IsSafeResourceName(resourceName string) bool {
 // BuildFctlApiUrl constructs a URL for the Flight Control API by safely joining path segments.
 // This prevents SSRF attacks by using proper URL parsing and path joining instead of string concatenation.
 func BuildFctlApiUrl(pathSegments ...string) (string, error) {
-	baseURL, err := url.Parse(config.FctlApiUrl)
+	return BuildApiUrl(config.FctlApiUrl, pathSegments...)
+}
+
+// BuildApiUrl constructs a URL on the given API base URL by safely joining path segments.
+func BuildApiUrl(apiUrl string, pathSegments ...string) (string, error) {
+	baseURL, err := url.Parse(apiUrl)
 	if err != nil {
 		return "", fmt.Errorf("invalid base API URL: %w", err)
 	}
@@ -5,7 +5,9 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var (
@@ -22,15 +24,96 @@ var (
 	BaseUiUrl              = getEnvUrlVar("BASE_UI_URL", "http://localhost:9000")
 	AuthInsecure           = getEnvVar("AUTH_INSECURE_SKIP_VERIFY", "")
 	OcpPlugin              = getEnvVar("IS_OCP_PLUGIN", "false")
+	// TrustedOrigins is a comma-separated list of additional browser origins (e.g. the OpenShift console URL)
+	// allowed to send state-changing API requests and open terminal WebSockets, besides BASE_UI_URL.
+	TrustedOrigins = getEnvVar("TRUSTED_ORIGINS", "")
+	// BackendsFile is an optional JSON file listing multiple Flight Control backends. When unset,
+	// the single backend defined by the FLIGHTCTL_* variables above is used.
+	BackendsFile = getEnvVar("FLIGHTCTL_BACKENDS_FILE", "")
+	// ServiceLoginsFile is an optional JSON file defining logins for non-browser clients (e.g. CI pipelines),
+	// using an OAuth2 client-credentials grant or static API tokens.
+	ServiceLoginsFile = getEnvVar("SERVICE_LOGINS_FILE", "")
+	// AuthClientSecretsDir optionally holds a directory per authentication provider with the client secret
+	// or private key the proxy uses to authenticate as a confidential client of that provider.
+	AuthClientSecretsDir = getEnvVar("AUTH_CLIENT_SECRETS_DIR", "")
 )
 
 var (
-	// TrustXForwardedHeaders enables use of X-Forwarded-Proto and X-Forwarded-Host for request
-	// origin (e.g. TLS termination at an ingress). When false, only r.TLS and r.Host are used.
+	// TrustXForwardedHeaders enables use of X-Forwarded-Proto, X-Forwarded-Host and X-Forwarded-For for request
+	// origin and client address (e.g. TLS termination at an ingress). When false, only r.TLS, r.Host and
+	// r.RemoteAddr are used.
 	// Set to true when a trusted reverse proxy sets these headers; see also TrustedProxyNets.
 	TrustXForwardedHeaders = parseBoolEnv("TRUST_X_FORWARDED_HEADERS", false)
 	// IsRHEM enables the RHEM mode for the UI.
 	IsRHEM = parseBoolEnv("IS_RHEM", false)
+	// OidcVerifyIdTokens makes the proxy verify the ID tokens of OIDC sessions against the provider's JWKS
+	// when they are issued or refreshed, instead of relying only on the Flight Control API to validate them.
+	OidcVerifyIdTokens = parseBoolEnv("OIDC_VERIFY_ID_TOKENS", false)
+)
+
+var (
+	// TerminalResumeGracePeriod is how long a terminal session's backend connection is kept open
+	// after the browser disconnects, so the same user can reattach with its resume token.
+	// Zero disables resumable terminal sessions.
+	TerminalResumeGracePeriod = parseDurationEnv("TERMINAL_RESUME_GRACE_PERIOD", 60*time.Second)
+	// TerminalResumeBufferSize is the maximum number of bytes of terminal output buffered
+	// for a detached session and replayed when the client reattaches.
+	TerminalResumeBufferSize = parseIntEnv("TERMINAL_RESUME_BUFFER_SIZE", 256*1024)
+	// TerminalMaxMessageSize is the largest WebSocket message accepted from either side of a terminal session.
+	TerminalMaxMessageSize = parseIntEnv("TERMINAL_MAX_MESSAGE_SIZE", 1024*1024)
+	// TerminalDownloadBytesPerSecond caps device-to-browser throughput per terminal session. Zero means unlimited.
+	TerminalDownloadBytesPerSecond = parseIntEnv("TERMINAL_DOWNLOAD_BYTES_PER_SECOND", 1024*1024)
+	// TerminalUploadBytesPerSecond caps browser-to-device throughput per terminal session. Zero means unlimited.
+	TerminalUploadBytesPerSecond = parseIntEnv("TERMINAL_UPLOAD_BYTES_PER_SECOND", 256*1024)
+	// PortForwardBytesPerSecond caps port-forward throughput per session in each direction. Zero means unlimited.
+	PortForwardBytesPerSecond = parseIntEnv("PORT_FORWARD_BYTES_PER_SECOND", 0)
+	// MetricsPort enables a separate listener serving proxy metrics (expvar JSON) when set, e.g. ":9090".
+	MetricsPort = getEnvVar("METRICS_PORT", "")
+)
+
+var (
+	// OrganizationCacheTTL is how long the organizations a user belongs to are cached when
+	// validating the selected organization. Zero fetches them on every request.
+	OrganizationCacheTTL = parseDurationEnv("ORGANIZATION_CACHE_TTL", 60*time.Second)
+	// PermissionsCacheTTL is how long the permissions returned by /api/permissions are cached per
+	// session and organization. Zero fetches them on every request.
+	PermissionsCacheTTL = parseDurationEnv("PERMISSIONS_CACHE_TTL", 30*time.Second)
+	// EventsPollInterval is how often the lists watched through /api/events are polled. Each list is
+	// polled once per organization, however many browser tabs are subscribed to it.
+	EventsPollInterval = parseDurationEnv("EVENTS_POLL_INTERVAL", 10*time.Second)
+	// EventsHeartbeatInterval is how often an SSE comment is sent to keep idle event streams open.
+	EventsHeartbeatInterval = parseDurationEnv("EVENTS_HEARTBEAT_INTERVAL", 15*time.Second)
+	// EventsBufferSize is the number of recent events kept per organization so reconnecting
+	// clients can resume with Last-Event-ID.
+	EventsBufferSize = parseIntEnv("EVENTS_BUFFER_SIZE", 1000)
+	// EventsReauthInterval is how often the credentials of event stream subscribers are checked again;
+	// streams whose credentials are rejected are closed.
+	EventsReauthInterval = parseDurationEnv("EVENTS_REAUTH_INTERVAL", time.Minute)
+	// EventsMaxStreamDuration bounds how long an event stream stays open; clients then reconnect and
+	// are authorized again. Streams also end when the session's token expires.
+	EventsMaxStreamDuration = parseDurationEnv("EVENTS_MAX_STREAM_DURATION", time.Hour)
+	// ApiCoalesceRequests shares one upstream request between identical concurrent GET requests of
+	// the Flight Control API.
+	ApiCoalesceRequests = parseBoolEnv("API_COALESCE_REQUESTS", true)
+	// ApiCacheTTL enables caching GET responses of the Flight Control API for this long, per user,
+	// organization and query. Zero disables the cache.
+	ApiCacheTTL = parseDurationEnv("API_CACHE_TTL", 0)
+	// ApiCacheMaxBytes bounds the size of the response bodies cached per backend.
+	ApiCacheMaxBytes = parseIntEnv("API_CACHE_MAX_BYTES", 64*1024*1024)
+	// RateLimitLoginPerMinute is how many login and session refresh requests a client IP may send per minute.
+	// Zero disables the limit, as for the limits below.
+	RateLimitLoginPerMinute = parseIntEnv("RATE_LIMIT_LOGIN_PER_MINUTE", 20)
+	// RateLimitTestConnectionPerMinute is how many authentication provider connection tests a client IP may run per minute.
+	RateLimitTestConnectionPerMinute = parseIntEnv("RATE_LIMIT_TEST_CONNECTION_PER_MINUTE", 10)
+	// RateLimitAPIPerMinute is how many other API requests a user (or a client IP, without a session) may send per minute.
+	RateLimitAPIPerMinute = parseIntEnv("RATE_LIMIT_API_PER_MINUTE", 1200)
+	// RateLimitAPIPerIPPerMinute is how many other API requests a client IP may send per minute, whatever
+	// the credentials they carry. It is applied in addition to RateLimitAPIPerMinute.
+	RateLimitAPIPerIPPerMinute = parseIntEnv("RATE_LIMIT_API_PER_IP_PER_MINUTE", 6000)
+	// ApiMaxRequestBodySize is the largest request body forwarded to the Flight Control and AlertManager APIs.
+	ApiMaxRequestBodySize = parseIntEnv("API_MAX_REQUEST_BODY_SIZE", 10*1024*1024)
+	// ServiceSessionTTL is the longest a service login session lasts; sessions end earlier when their upstream token expires.
+	ServiceSessionTTL = parseDurationEnv("SERVICE_SESSION_TTL", time.Hour)
 )
 
 // trustedProxyNets is parsed from TRUSTED_PROXY_CIDRS (comma-separated). When non-empty and
@@ -72,6 +155,32 @@ func parseBoolEnv(key string, defaultVal bool) bool {
 	}
 }
 
+func parseDurationEnv(key string, defaultVal time.Duration) time.Duration {
+	s, ok := os.LookupEnv(key)
+	if !ok || strings.TrimSpace(s) == "" {
+		return defaultVal
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(s))
+	if err != nil || d < 0 {
+		log.Printf("config: invalid duration %q for %s; using default %s", s, key, defaultVal)
+		return defaultVal
+	}
+	return d
+}
+
+func parseIntEnv(key string, defaultVal int) int {
+	s, ok := os.LookupEnv(key)
+	if !ok || strings.TrimSpace(s) == "" {
+		return defaultVal
+	}
+	v, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || v < 0 {
+		log.Printf("config: invalid integer %q for %s; using default %d", s, key, defaultVal)
+		return defaultVal
+	}
+	return v
+}
+
 func parseTrustedProxyCIDRs(s string) []*net.IPNet {
 	var out []*net.IPNet
 	for _, part := range strings.Split(s, ",") {
@@ -0,0 +1,217 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/flightctl/flightctl-ui/common"
+	"github.com/flightctl/flightctl-ui/config"
+	"github.com/flightctl/flightctl-ui/log"
+	"github.com/flightctl/flightctl-ui/upstream"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+// retryInterval is how long browsers wait before reconnecting to the event stream, in milliseconds.
+const retryInterval = 3000
+
+// closeWriteTimeout is how long the close message of a stream that ends may take to be written
+const closeWriteTimeout = 10 * time.Second
+
+// Handler streams resource changes of the selected organization as Server-Sent Events.
+type Handler struct {
+	backends       *upstream.Registry
+	hub            *Hub
+	heartbeat      time.Duration
+	reauthInterval time.Duration
+	maxDuration    time.Duration
+}
+
+func NewHandler(backends *upstream.Registry) *Handler {
+	return &Handler{
+		backends:       backends,
+		hub:            NewHub(config.EventsPollInterval, config.EventsBufferSize),
+		heartbeat:      max(config.EventsHeartbeatInterval, time.Second),
+		reauthInterval: max(config.EventsReauthInterval, time.Second),
+		maxDuration:    max(config.EventsMaxStreamDuration, time.Minute),
+	}
+}
+
+// Stream sends the changes of the resource types listed in the "types" query parameter
+// (e.g. types=devices,fleets). Each message is named after its resource type and carries an Event.
+// Reconnecting browsers resume from their Last-Event-ID header, or from the "lastEventId" query parameter.
+func (h *Handler) Stream(w http.ResponseWriter, r *http.Request) {
+	api := h.backends.ForRequest(r)
+	orgID, ok := common.OrganizationIDFromContext(r.Context())
+	if !ok {
+		common.RespondWithJSONError(w, http.StatusPreconditionRequired, "Organization selection required", "ORGANIZATION_REQUIRED")
+		return
+	}
+	kinds, err := parseKinds(r.URL.Query()["types"])
+	if err != nil {
+		common.RespondWithJSONError(w, http.StatusBadRequest, err.Error(), "INVALID_EVENT_TYPE")
+		return
+	}
+
+	authHeader := r.Header.Get(common.AuthHeaderKey)
+	client := h.hub.apiClient(api)
+	kind, err := authorize(r.Context(), client, api, orgID, kinds, authHeader)
+	switch {
+	case errors.Is(err, errUnauthorized):
+		common.RespondWithJSONError(w, http.StatusUnauthorized, "Not authenticated", "UNAUTHORIZED")
+		return
+	case errors.Is(err, errForbidden):
+		common.RespondWithJSONError(w, http.StatusForbidden, "Not allowed to watch "+kind, "EVENTS_FORBIDDEN")
+		return
+	case err != nil:
+		log.GetLogger().WithError(err).Warn("Failed to authorize event stream")
+		common.RespondWithJSONError(w, http.StatusBadGateway, "Failed to reach the Flight Control API", "EVENTS_UNAVAILABLE")
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+	sub, backlog := h.hub.Subscribe(api, orgID, kinds, authHeader, lastEventID)
+	defer h.hub.Unsubscribe(sub)
+
+	// The stream ends when the session's token expires, and after maxDuration at the latest: the client
+	// then reconnects and is authorized again. Until then, it outlives the server's write timeout.
+	end, endReason := time.Now().Add(h.maxDuration), closeReasonReconnect
+	if expiration, ok := tokenExpiration(authHeader); ok && expiration.Before(end) {
+		end, endReason = expiration, closeReasonExpired
+	}
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(end.Add(closeWriteTimeout))
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", retryInterval)
+	for _, event := range backlog {
+		if err := writeEvent(w, event); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		log.GetLogger().WithError(err).Warn("Event stream cannot be flushed")
+		return
+	}
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+	reauth := time.NewTicker(h.reauthInterval)
+	defer reauth.Stop()
+	endTimer := time.NewTimer(time.Until(end))
+	defer endTimer.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-sub.Closed:
+			writeClose(w, sub.Reason)
+			_ = rc.Flush()
+			return
+		case <-endTimer.C:
+			writeClose(w, endReason)
+			_ = rc.Flush()
+			return
+		case <-reauth.C:
+			// The events are polled with other subscribers' credentials: the subscriber must still be
+			// allowed to list them
+			_, err := authorize(r.Context(), client, api, orgID, kinds, authHeader)
+			if errors.Is(err, errUnauthorized) || errors.Is(err, errForbidden) {
+				writeClose(w, closeReasonUnauthorized)
+				_ = rc.Flush()
+				return
+			}
+			if err != nil && r.Context().Err() == nil {
+				log.GetLogger().WithError(err).Warn("Failed to authorize event stream again")
+			}
+			continue
+		case event := <-sub.Events:
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// authorize checks the user may list the resource types, since they are polled with another
+// subscriber's credentials. It returns the resource type that could not be listed.
+func authorize(ctx context.Context, client *http.Client, api *upstream.Backend, orgID string, kinds []string, authHeader string) (string, error) {
+	for _, kind := range kinds {
+		if _, err := listResources(ctx, client, api, orgID, kind, authHeader, 1); err != nil {
+			return kind, err
+		}
+	}
+	return "", nil
+}
+
+// tokenExpiration returns when the bearer token expires, for tokens that are JWTs
+func tokenExpiration(authHeader string) (time.Time, bool) {
+	token, ok := strings.CutPrefix(authHeader, "Bearer ")
+	if !ok {
+		return time.Time{}, false
+	}
+	// The token is validated by the API; its expiration only bounds the stream here
+	parsed, err := jwt.ParseInsecure([]byte(token))
+	if err != nil || parsed.Expiration().IsZero() {
+		return time.Time{}, false
+	}
+	return parsed.Expiration(), true
+}
+
+func parseKinds(values []string) ([]string, error) {
+	var kinds []string
+	for _, value := range values {
+		for _, kind := range strings.Split(value, ",") {
+			kind = strings.TrimSpace(kind)
+			if kind == "" || slices.Contains(kinds, kind) {
+				continue
+			}
+			if _, ok := resourcePaths[kind]; !ok {
+				return nil, fmt.Errorf("Unsupported event type %q", kind)
+			}
+			kinds = append(kinds, kind)
+		}
+	}
+	if len(kinds) == 0 {
+		return nil, errors.New("At least one event type is required")
+	}
+	return kinds, nil
+}
+
+func writeClose(w io.Writer, reason string) {
+	fmt.Fprintf(w, "event: close\ndata: {\"reason\":%q}\n\n", reason)
+}
+
+func writeEvent(w io.Writer, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if event.ID != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", event.ID); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Kind, data)
+	return err
+}
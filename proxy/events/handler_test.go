@@ -0,0 +1,64 @@
+package events
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flightctl/flightctl-ui/common"
+	"github.com/flightctl/flightctl-ui/log"
+	"github.com/flightctl/flightctl-ui/upstream"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+func TestStreamEndsWithTheSubscribersCredentials(t *testing.T) {
+	log.InitLogs()
+	hub, backend, api := newTestHub(t)
+	backends, err := upstream.NewRegistry([]*upstream.Backend{backend}, backend.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := &Handler{backends: backends, hub: hub, heartbeat: time.Hour, reauthInterval: 20 * time.Millisecond, maxDuration: time.Hour}
+
+	// stream runs the stream until it ends, and returns what was sent
+	stream := func(authHeader string, whileOpen func()) string {
+		req := httptest.NewRequest(http.MethodGet, "/api/events?types=devices", nil)
+		req.Header.Set(common.AuthHeaderKey, authHeader)
+		ctx, cancel := context.WithTimeout(common.WithOrganizationID(req.Context(), testOrgID), 5*time.Second)
+		defer cancel()
+		rec := httptest.NewRecorder()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			handler.Stream(rec, req.WithContext(ctx))
+		}()
+		whileOpen()
+		<-done
+		return rec.Body.String()
+	}
+
+	body := stream("Bearer revoked", func() {
+		time.Sleep(50 * time.Millisecond)
+		api.rejected.Store("Bearer revoked", true)
+	})
+	if !strings.Contains(body, `data: {"reason":"unauthorized"}`) {
+		t.Fatalf("expected the stream to close once the credentials are rejected, got %q", body)
+	}
+
+	token, err := jwt.NewBuilder().Expiration(time.Now().Add(time.Second)).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.HS256, []byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body = stream("Bearer "+string(signed), func() {})
+	if !strings.Contains(body, `data: {"reason":"expired"}`) {
+		t.Fatalf("expected the stream to close when the token expires, got %q", body)
+	}
+}
@@ -0,0 +1,400 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flightctl/flightctl-ui/log"
+	"github.com/flightctl/flightctl-ui/upstream"
+)
+
+// Event types
+const (
+	EventAdded    = "ADDED"
+	EventModified = "MODIFIED"
+	EventDeleted  = "DELETED"
+	// EventReset tells clients to reload the list: the proxy started watching it, or missed changes
+	// since the event the client resumes from.
+	EventReset = "RESET"
+)
+
+const (
+	// minPollInterval protects the backend from a misconfigured poll interval
+	minPollInterval = time.Second
+	// idlePollerTimeout is how long a list keeps being polled after its last subscriber left,
+	// so browsers reconnecting with Last-Event-ID can resume without missing changes
+	idlePollerTimeout = 30 * time.Second
+	// subscriberBufferSize is the number of events queued for a subscriber before it is disconnected
+	subscriberBufferSize = 256
+)
+
+// Reasons a subscription is closed by the hub
+const (
+	closeReasonUnauthorized = "unauthorized"
+	closeReasonOverflow     = "overflow"
+	closeReasonExpired      = "expired"
+	closeReasonReconnect    = "reconnect"
+)
+
+// Event is a change of one resource. Clients receive it as an SSE message named after the resource type.
+type Event struct {
+	ID     string          `json:"-"`
+	Type   string          `json:"type"`
+	Kind   string          `json:"kind"`
+	Name   string          `json:"name,omitempty"`
+	Object json.RawMessage `json:"object,omitempty"`
+	seq    uint64
+}
+
+// Hub polls each watched list once per backend, organization and resource type, and fans out the
+// changes to every subscriber. Recent events are buffered so clients can resume with Last-Event-ID.
+type Hub struct {
+	pollInterval time.Duration
+	idleTimeout  time.Duration
+	bufferSize   int
+
+	mu      sync.Mutex
+	streams map[streamKey]*stream
+	clients map[string]*http.Client
+}
+
+type streamKey struct {
+	backend string
+	orgID   string
+}
+
+// stream holds the events of one organization on one backend. Event IDs are "<epoch>-<sequence>",
+// where the epoch identifies the stream so IDs from an earlier stream are never resumed.
+type stream struct {
+	key         streamKey
+	api         *upstream.Backend
+	epoch       string
+	seq         uint64
+	buffer      []Event
+	subscribers map[*Subscriber]struct{}
+	pollers     map[string]*poller
+}
+
+// poller polls one resource type with the credentials of one of its subscribers.
+type poller struct {
+	kind       string
+	authHeader string
+	cancel     context.CancelFunc
+	idleTimer  *time.Timer
+}
+
+// Subscriber receives the events of the resource types it subscribed to. Closed is closed when the
+// hub ends the subscription; Reason then tells why.
+type Subscriber struct {
+	Events <-chan Event
+	Closed <-chan struct{}
+	Reason string
+
+	events     chan Event
+	closed     chan struct{}
+	stream     *stream
+	kinds      []string
+	authHeader string
+}
+
+func NewHub(pollInterval time.Duration, bufferSize int) *Hub {
+	return &Hub{
+		pollInterval: max(pollInterval, minPollInterval),
+		idleTimeout:  idlePollerTimeout,
+		bufferSize:   max(bufferSize, 1),
+		streams:      map[streamKey]*stream{},
+		clients:      map[string]*http.Client{},
+	}
+}
+
+// Subscribe starts delivering changes of the given resource types to a new subscriber. The returned
+// events must be sent before the subscriber's: they replay what the client missed since lastEventID,
+// or tell it to reload the lists when they cannot be resumed.
+func (h *Hub) Subscribe(api *upstream.Backend, orgID string, kinds []string, authHeader, lastEventID string) (*Subscriber, []Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := streamKey{backend: api.Name, orgID: orgID}
+	st, ok := h.streams[key]
+	if !ok {
+		st = &stream{
+			key:         key,
+			api:         api,
+			epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+			subscribers: map[*Subscriber]struct{}{},
+			pollers:     map[string]*poller{},
+		}
+		h.streams[key] = st
+	}
+
+	var backlog []Event
+	if lastEventID != "" {
+		if missed, ok := st.eventsSince(lastEventID); ok {
+			for _, event := range missed {
+				if slices.Contains(kinds, event.Kind) {
+					backlog = append(backlog, event)
+				}
+			}
+		} else {
+			for _, kind := range kinds {
+				backlog = append(backlog, Event{Type: EventReset, Kind: kind})
+			}
+		}
+	}
+
+	events := make(chan Event, subscriberBufferSize)
+	closed := make(chan struct{})
+	sub := &Subscriber{
+		Events:     events,
+		Closed:     closed,
+		events:     events,
+		closed:     closed,
+		stream:     st,
+		kinds:      kinds,
+		authHeader: authHeader,
+	}
+	st.subscribers[sub] = struct{}{}
+
+	for _, kind := range kinds {
+		p, ok := st.pollers[kind]
+		if !ok {
+			h.startPollerLocked(st, kind, authHeader)
+			continue
+		}
+		// The most recent subscriber's credentials are the most likely to still be valid
+		p.authHeader = authHeader
+		if p.idleTimer != nil {
+			p.idleTimer.Stop()
+			p.idleTimer = nil
+		}
+	}
+	return sub, backlog
+}
+
+// Unsubscribe ends a subscription. Lists nobody subscribes to anymore are polled for a while longer.
+func (h *Hub) Unsubscribe(sub *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeSubscriberLocked(sub.stream, sub)
+}
+
+// eventsSince returns the buffered events after lastEventID, or false when events may have been missed.
+func (st *stream) eventsSince(lastEventID string) ([]Event, bool) {
+	epoch, seqStr, ok := strings.Cut(lastEventID, "-")
+	if !ok || epoch != st.epoch {
+		return nil, false
+	}
+	seq, err := strconv.ParseUint(seqStr, 10, 64)
+	if err != nil || seq > st.seq {
+		return nil, false
+	}
+	if seq == st.seq {
+		return nil, true
+	}
+	if len(st.buffer) == 0 || st.buffer[0].seq > seq+1 {
+		return nil, false
+	}
+	// Buffered events have consecutive sequence numbers
+	return slices.Clone(st.buffer[seq+1-st.buffer[0].seq:]), true
+}
+
+// apiClient returns the client used to reach the backend's API, shared by all its pollers.
+func (h *Hub) apiClient(api *upstream.Backend) *http.Client {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.apiClientLocked(api)
+}
+
+func (h *Hub) apiClientLocked(api *upstream.Backend) *http.Client {
+	client, ok := h.clients[api.Name]
+	if !ok {
+		client = newAPIClient(api)
+		h.clients[api.Name] = client
+	}
+	return client
+}
+
+func (h *Hub) startPollerLocked(st *stream, kind, authHeader string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &poller{kind: kind, authHeader: authHeader, cancel: cancel}
+	st.pollers[kind] = p
+	go h.poll(ctx, st, p, h.apiClientLocked(st.api))
+}
+
+func (h *Hub) stopPollerLocked(st *stream, p *poller) {
+	if st.pollers[p.kind] != p {
+		return
+	}
+	p.cancel()
+	if p.idleTimer != nil {
+		p.idleTimer.Stop()
+	}
+	delete(st.pollers, p.kind)
+	if len(st.pollers) == 0 && len(st.subscribers) == 0 {
+		delete(h.streams, st.key)
+	}
+}
+
+func (h *Hub) removeSubscriberLocked(st *stream, sub *Subscriber) bool {
+	if _, ok := st.subscribers[sub]; !ok {
+		return false
+	}
+	delete(st.subscribers, sub)
+	for _, kind := range sub.kinds {
+		p, ok := st.pollers[kind]
+		if !ok || p.idleTimer != nil || st.hasSubscriber(kind) {
+			continue
+		}
+		p.idleTimer = time.AfterFunc(h.idleTimeout, func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			if !st.hasSubscriber(kind) {
+				h.stopPollerLocked(st, p)
+			}
+		})
+	}
+	if len(st.pollers) == 0 && len(st.subscribers) == 0 {
+		delete(h.streams, st.key)
+	}
+	return true
+}
+
+func (h *Hub) closeSubscriberLocked(st *stream, sub *Subscriber, reason string) {
+	if h.removeSubscriberLocked(st, sub) {
+		sub.Reason = reason
+		close(sub.closed)
+	}
+}
+
+func (st *stream) hasSubscriber(kind string) bool {
+	for sub := range st.subscribers {
+		if slices.Contains(sub.kinds, kind) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Hub) publishLocked(st *stream, event Event) {
+	st.seq++
+	event.seq = st.seq
+	event.ID = st.epoch + "-" + strconv.FormatUint(st.seq, 10)
+	st.buffer = append(st.buffer, event)
+	if len(st.buffer) > h.bufferSize {
+		st.buffer = slices.Delete(st.buffer, 0, len(st.buffer)-h.bufferSize)
+	}
+	for sub := range st.subscribers {
+		if !slices.Contains(sub.kinds, event.Kind) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			// The client is too slow; it reconnects and resumes from the buffer
+			h.closeSubscriberLocked(st, sub, closeReasonOverflow)
+		}
+	}
+}
+
+// poll lists the resource type until the poller is stopped. The first successful list is the baseline
+// announced with a reset event; every later list is compared to the previous one.
+func (h *Hub) poll(ctx context.Context, st *stream, p *poller, client *http.Client) {
+	var known map[string]string
+	for {
+		h.mu.Lock()
+		authHeader := p.authHeader
+		h.mu.Unlock()
+
+		resources, err := listResources(ctx, client, st.api, st.key.orgID, p.kind, authHeader, 0)
+		if ctx.Err() != nil {
+			return
+		}
+		switch {
+		case errors.Is(err, errUnauthorized), errors.Is(err, errForbidden):
+			if !h.rejectCredentials(st, p, authHeader) {
+				return
+			}
+			// Retry right away with another subscriber's credentials
+			continue
+		case err != nil:
+			log.GetLogger().WithError(err).Warnf("Failed to poll %s for events", p.kind)
+		default:
+			known = h.publishChanges(st, p, known, resources)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(h.pollInterval):
+		}
+	}
+}
+
+// rejectCredentials closes the subscriptions using credentials the backend rejected, and switches the
+// poller to another subscriber's. It returns false, and stops the poller, when no subscriber is left.
+func (h *Hub) rejectCredentials(st *stream, p *poller, authHeader string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if st.pollers[p.kind] != p {
+		return false
+	}
+	for sub := range st.subscribers {
+		if sub.authHeader == authHeader && slices.Contains(sub.kinds, p.kind) {
+			h.closeSubscriberLocked(st, sub, closeReasonUnauthorized)
+		}
+	}
+	for sub := range st.subscribers {
+		if slices.Contains(sub.kinds, p.kind) {
+			p.authHeader = sub.authHeader
+			return true
+		}
+	}
+	h.stopPollerLocked(st, p)
+	return false
+}
+
+// publishChanges publishes the differences between the known resource versions and the listed
+// resources, and returns the versions of the listed resources.
+func (h *Hub) publishChanges(st *stream, p *poller, known map[string]string, resources []resource) map[string]string {
+	current := make(map[string]string, len(resources))
+	for _, res := range resources {
+		current[res.name] = res.version
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if st.pollers[p.kind] != p {
+		return current
+	}
+	if known == nil {
+		h.publishLocked(st, Event{Type: EventReset, Kind: p.kind})
+		return current
+	}
+	for _, res := range resources {
+		version, ok := known[res.name]
+		switch {
+		case !ok:
+			h.publishLocked(st, Event{Type: EventAdded, Kind: p.kind, Name: res.name, Object: res.object})
+		case version != res.version:
+			h.publishLocked(st, Event{Type: EventModified, Kind: p.kind, Name: res.name, Object: res.object})
+		}
+	}
+	var deleted []string
+	for name := range known {
+		if _, ok := current[name]; !ok {
+			deleted = append(deleted, name)
+		}
+	}
+	slices.Sort(deleted)
+	for _, name := range deleted {
+		h.publishLocked(st, Event{Type: EventDeleted, Kind: p.kind, Name: name})
+	}
+	return current
+}
@@ -0,0 +1,157 @@
+package events
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/flightctl/flightctl-ui/upstream"
+)
+
+const testOrgID = "2f2d1b1e-8a7e-4d52-9d0a-6c1f0f3b8e11"
+
+// fakeDevicesAPI serves a device list that tests can change. Requests with the token "expired", or
+// an Authorization header stored in rejected, are rejected.
+type fakeDevicesAPI struct {
+	mu       sync.Mutex
+	versions map[string]string
+	lists    atomic.Int32
+	rejected sync.Map
+}
+
+func (f *fakeDevicesAPI) set(name, version string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if version == "" {
+		delete(f.versions, name)
+	} else {
+		f.versions[name] = version
+	}
+}
+
+func (f *fakeDevicesAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if _, rejected := f.rejected.Load(r.Header.Get("Authorization")); rejected || r.Header.Get("Authorization") == "Bearer expired" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.URL.Query().Get("org_id") != testOrgID {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.lists.Add(1)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	items := []map[string]any{}
+	for name, version := range f.versions {
+		items = append(items, map[string]any{"metadata": map[string]string{"name": name, "resourceVersion": version}})
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"items": items})
+}
+
+func newTestHub(t *testing.T) (*Hub, *upstream.Backend, *fakeDevicesAPI) {
+	api := &fakeDevicesAPI{versions: map[string]string{"device-a": "1"}}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+
+	hub := NewHub(time.Second, 100)
+	hub.pollInterval = 20 * time.Millisecond
+	hub.idleTimeout = time.Hour
+	// Stop polling before the fake API is closed
+	t.Cleanup(func() {
+		hub.mu.Lock()
+		defer hub.mu.Unlock()
+		for _, st := range hub.streams {
+			for _, p := range st.pollers {
+				hub.stopPollerLocked(st, p)
+			}
+		}
+	})
+	return hub, &upstream.Backend{Name: "default", ApiUrl: srv.URL}, api
+}
+
+func nextEvent(t *testing.T, sub *Subscriber) Event {
+	t.Helper()
+	select {
+	case event := <-sub.Events:
+		return event
+	case <-sub.Closed:
+		t.Fatalf("subscription closed: %s", sub.Reason)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event received")
+	}
+	return Event{}
+}
+
+func expectEvent(t *testing.T, sub *Subscriber, eventType, name string) Event {
+	t.Helper()
+	event := nextEvent(t, sub)
+	if event.Type != eventType || event.Name != name || event.Kind != "devices" {
+		t.Fatalf("expected %s of %q, got %+v", eventType, name, event)
+	}
+	return event
+}
+
+func TestHubFansOutChangesFromOnePoller(t *testing.T) {
+	hub, backend, api := newTestHub(t)
+
+	first, _ := hub.Subscribe(backend, testOrgID, []string{"devices"}, "Bearer one", "")
+	defer hub.Unsubscribe(first)
+	expectEvent(t, first, EventReset, "")
+
+	second, _ := hub.Subscribe(backend, testOrgID, []string{"devices"}, "Bearer two", "")
+	defer hub.Unsubscribe(second)
+
+	api.set("device-b", "1")
+	added := expectEvent(t, first, EventAdded, "device-b")
+	expectEvent(t, second, EventAdded, "device-b")
+	api.set("device-a", "2")
+	expectEvent(t, first, EventModified, "device-a")
+	expectEvent(t, second, EventModified, "device-a")
+	api.set("device-b", "")
+	expectEvent(t, first, EventDeleted, "device-b")
+	deleted := expectEvent(t, second, EventDeleted, "device-b")
+
+	// Both subscribers share a single poller
+	polls := api.lists.Load()
+	time.Sleep(10 * hub.pollInterval)
+	if got := api.lists.Load() - polls; got > 12 {
+		t.Fatalf("expected one list per poll interval, got %d lists", got)
+	}
+
+	resumed, backlog := hub.Subscribe(backend, testOrgID, []string{"devices"}, "Bearer one", added.ID)
+	defer hub.Unsubscribe(resumed)
+	if len(backlog) != 2 || backlog[0].Type != EventModified || backlog[1].ID != deleted.ID {
+		t.Fatalf("expected the events after %s to be replayed, got %+v", added.ID, backlog)
+	}
+
+	_, backlog = hub.Subscribe(backend, testOrgID, []string{"devices"}, "Bearer one", "unknown-1")
+	if len(backlog) != 1 || backlog[0].Type != EventReset || backlog[0].ID != "" {
+		t.Fatalf("expected a reset for an unknown event ID, got %+v", backlog)
+	}
+}
+
+func TestHubClosesSubscriptionsWithRejectedCredentials(t *testing.T) {
+	hub, backend, api := newTestHub(t)
+
+	valid, _ := hub.Subscribe(backend, testOrgID, []string{"devices"}, "Bearer valid", "")
+	defer hub.Unsubscribe(valid)
+	expectEvent(t, valid, EventReset, "")
+
+	// The poller switches to the latest subscriber's credentials, and back when they are rejected
+	expired, _ := hub.Subscribe(backend, testOrgID, []string{"devices"}, "Bearer expired", "")
+	select {
+	case <-expired.Closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("subscription with rejected credentials was not closed")
+	}
+	if expired.Reason != closeReasonUnauthorized {
+		t.Fatalf("expected %q, got %q", closeReasonUnauthorized, expired.Reason)
+	}
+
+	api.set("device-b", "1")
+	expectEvent(t, valid, EventAdded, "device-b")
+}
@@ -0,0 +1,163 @@
+package events
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/flightctl/flightctl-ui/upstream"
+)
+
+// listPageSize is the number of resources requested per page when polling a list.
+const listPageSize = 1000
+
+// resourcePaths lists the resource types that can be watched, with their Flight Control API path.
+var resourcePaths = map[string]string{
+	"devices":            "api/v1/devices",
+	"fleets":             "api/v1/fleets",
+	"enrollmentrequests": "api/v1/enrollmentrequests",
+	"repositories":       "api/v1/repositories",
+	"resourcesyncs":      "api/v1/resourcesyncs",
+}
+
+var (
+	// errUnauthorized is returned when the backend rejects the credentials used to list a resource type.
+	errUnauthorized = errors.New("not authenticated")
+	// errForbidden is returned when the user is not allowed to list a resource type.
+	errForbidden = errors.New("not allowed to list resources")
+)
+
+// resource is one item of a list response, identified by name. The version changes whenever the item does.
+type resource struct {
+	name    string
+	version string
+	object  json.RawMessage
+}
+
+type listResponse struct {
+	Metadata struct {
+		Continue *string `json:"continue,omitempty"`
+	} `json:"metadata"`
+	Items []json.RawMessage `json:"items"`
+}
+
+type itemMetadata struct {
+	Metadata struct {
+		Name            *string `json:"name,omitempty"`
+		ResourceVersion *string `json:"resourceVersion,omitempty"`
+	} `json:"metadata"`
+}
+
+func newAPIClient(api *upstream.Backend) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: api.TlsConfig,
+		},
+		Timeout: 30 * time.Second,
+	}
+}
+
+// listResources returns every resource of the given type in the organization. When limit is
+// positive, only the first page of at most limit resources is fetched.
+func listResources(ctx context.Context, client *http.Client, api *upstream.Backend, orgID, kind, authHeader string, limit int) ([]resource, error) {
+	listURL, err := api.ApiURL(resourcePaths[kind])
+	if err != nil {
+		return nil, err
+	}
+
+	pageSize := listPageSize
+	if limit > 0 {
+		pageSize = limit
+	}
+	var resources []resource
+	continueToken := ""
+	for {
+		query := url.Values{}
+		query.Set("org_id", orgID)
+		query.Set("limit", strconv.Itoa(pageSize))
+		if continueToken != "" {
+			query.Set("continue", continueToken)
+		}
+		page, err := listPage(ctx, client, listURL+"?"+query.Encode(), authHeader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", kind, err)
+		}
+		for _, raw := range page.Items {
+			item, err := parseResource(raw)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", kind, err)
+			}
+			resources = append(resources, item)
+		}
+		if limit > 0 || page.Metadata.Continue == nil || *page.Metadata.Continue == "" {
+			return resources, nil
+		}
+		continueToken = *page.Metadata.Continue
+	}
+}
+
+func listPage(ctx context.Context, client *http.Client, pageURL, authHeader string) (*listResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if authHeader != "" {
+		req.Header.Set("Authorization", authHeader)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		return nil, errUnauthorized
+	case http.StatusForbidden:
+		return nil, errForbidden
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var page listResponse
+	if err := json.Unmarshal(body, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// parseResource identifies a list item by its name. Items without a resourceVersion are versioned
+// by a hash of their content.
+func parseResource(raw json.RawMessage) (resource, error) {
+	var meta itemMetadata
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return resource{}, err
+	}
+	if meta.Metadata.Name == nil || *meta.Metadata.Name == "" {
+		return resource{}, errors.New("item has no name")
+	}
+	version := ""
+	if meta.Metadata.ResourceVersion != nil {
+		version = *meta.Metadata.ResourceVersion
+	}
+	if version == "" {
+		sum := sha256.Sum256(raw)
+		version = hex.EncodeToString(sum[:])
+	}
+	return resource{name: *meta.Metadata.Name, version: version, object: raw}, nil
+}
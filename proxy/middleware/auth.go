@@ -1,25 +1,71 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/flightctl/flightctl-ui/auth"
 	"github.com/flightctl/flightctl-ui/common"
 	"github.com/flightctl/flightctl-ui/log"
+	"github.com/flightctl/flightctl-ui/upstream"
 )
 
-// This function does not verify the auth token. It just makes sure that the token is injected into Auth header
-func AuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		tokenData, err := auth.ParseSessionCookie(r)
-		if err != nil {
-			log.GetLogger().Warn(err.Error())
-		} else {
+// AuthMiddleware does not verify the auth token. It just makes sure that the token is injected into Auth header.
+// Service login sessions are resolved to their upstream token, and rejected outside their scope.
+// Sessions logged out at their OIDC provider are rejected, and so are sessions sent to another backend
+// than the one that issued them.
+func AuthMiddleware(backends *upstream.Registry, serviceLogins *auth.ServiceLogins, logouts *auth.LogoutRegistry) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokenData, err := auth.ParseSessionCookie(r)
+			if err != nil {
+				log.GetLogger().Warn(err.Error())
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if errors.Is(auth.AuthorizeSessionBackend(backends, r, tokenData), auth.ErrForeignBackend) {
+				// Users log in to the selected backend without their session's token
+				if isLoginPath(r.URL.Path) {
+					next.ServeHTTP(w, r)
+					return
+				}
+				common.RespondWithJSONError(w, http.StatusUnauthorized, "Session was issued by another backend, please log in again", "SESSION_BACKEND_MISMATCH")
+				return
+			}
+
+			if errors.Is(logouts.AuthorizeSession(r, tokenData), auth.ErrSessionLoggedOut) {
+				common.RespondWithJSONError(w, http.StatusUnauthorized, "Session was logged out at the identity provider, please log in again", "SESSION_EXPIRED")
+				return
+			}
+
 			token := tokenData.Token
+			if tokenData.ServiceSession != "" {
+				token, err = serviceLogins.AuthorizeRequest(backends, r, tokenData.ServiceSession)
+				switch {
+				case errors.Is(err, auth.ErrServiceSessionExpired):
+					common.RespondWithJSONError(w, http.StatusUnauthorized, "Service session expired, please log in again", "SESSION_EXPIRED")
+					return
+				case errors.Is(err, auth.ErrForeignBackend):
+					common.RespondWithJSONError(w, http.StatusUnauthorized, "Session was issued by another backend, please log in again", "SESSION_BACKEND_MISMATCH")
+					return
+				case errors.Is(err, auth.ErrOutsideServiceScope):
+					common.RespondWithJSONError(w, http.StatusForbidden, "Request is not allowed for this service login", "OUTSIDE_SERVICE_SCOPE")
+					return
+				}
+			}
 			if token != "" {
 				r.Header.Add(common.AuthHeaderKey, "Bearer "+token)
 			}
-		}
-		next.ServeHTTP(w, r)
-	})
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isLoginPath reports whether the path is a login or logout endpoint; these read the session themselves
+func isLoginPath(path string) bool {
+	path = strings.TrimSuffix(path, "/")
+	return path == "/api/login" || strings.HasPrefix(path, "/api/login/") ||
+		path == "/api/logout" || strings.HasPrefix(path, "/api/logout/")
 }
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	b64 "encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flightctl/flightctl-ui/auth"
+	"github.com/flightctl/flightctl-ui/common"
+	"github.com/flightctl/flightctl-ui/upstream"
+)
+
+func TestAuthMiddlewareBindsSessionsToTheirBackend(t *testing.T) {
+	registry, err := upstream.NewRegistry([]*upstream.Backend{
+		{Name: "prod", ApiUrl: "https://prod.example.com"},
+		{Name: "staging", ApiUrl: "https://staging.example.com"},
+	}, "prod")
+	if err != nil {
+		t.Fatalf("failed to create registry: %v", err)
+	}
+	var forwardedAuth string
+	handler := BackendMiddleware(registry)(AuthMiddleware(registry, nil, auth.NewLogoutRegistry())(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			forwardedAuth = r.Header.Get(common.AuthHeaderKey)
+			w.WriteHeader(http.StatusOK)
+		}),
+	))
+
+	cookieValue, err := json.Marshal(auth.TokenData{Token: "prod-token", Provider: "sso", Backend: "prod"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serve := func(target string) *httptest.ResponseRecorder {
+		forwardedAuth = ""
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.AddCookie(&http.Cookie{Name: common.CookieSessionName, Value: b64.StdEncoding.EncodeToString(cookieValue)})
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := serve("/api/flightctl/api/v1/devices"); rec.Code != http.StatusOK || forwardedAuth != "Bearer prod-token" {
+		t.Fatalf("expected the token to be sent to its backend, got %d with %q", rec.Code, forwardedAuth)
+	}
+	if rec := serve("/api/flightctl/api/v1/devices?fctl_backend=staging"); rec.Code != http.StatusUnauthorized || forwardedAuth != "" {
+		t.Fatalf("expected the token not to be sent to another backend, got %d with %q", rec.Code, forwardedAuth)
+	}
+	// Logging in to another backend is allowed, without the session's token
+	if rec := serve("/api/login?fctl_backend=staging"); rec.Code != http.StatusOK || forwardedAuth != "" {
+		t.Fatalf("expected login to another backend without the token, got %d with %q", rec.Code, forwardedAuth)
+	}
+}
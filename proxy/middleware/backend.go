@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/flightctl/flightctl-ui/common"
+	"github.com/flightctl/flightctl-ui/upstream"
+)
+
+const (
+	headerBackend = "X-FlightCtl-Backend"
+	// queryBackend is specific to the proxy so it doesn't collide with the upstreams' query parameters
+	queryBackend = "fctl_backend"
+)
+
+// BackendMiddleware selects the Flight Control backend a request is routed to.
+// The backend is taken from the X-FlightCtl-Backend header, or from the "fctl_backend" query parameter
+// for requests that can't send custom headers (websockets, download links); the default backend is used otherwise.
+func BackendMiddleware(backends *upstream.Registry) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name := r.Header.Get(headerBackend)
+			query := r.URL.Query()
+			if name == "" {
+				name = query.Get(queryBackend)
+			}
+			// The selection is only meaningful to the proxy
+			r.Header.Del(headerBackend)
+			if query.Has(queryBackend) {
+				query.Del(queryBackend)
+				r.URL.RawQuery = query.Encode()
+			}
+
+			if name == "" {
+				next.ServeHTTP(w, r.WithContext(upstream.WithBackend(r.Context(), backends.Default())))
+				return
+			}
+
+			b, ok := backends.Get(name)
+			if !ok {
+				common.RespondWithJSONError(w, http.StatusBadRequest, "Unknown backend", "BACKEND_NOT_FOUND")
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(upstream.WithBackend(r.Context(), b)))
+		})
+	}
+}
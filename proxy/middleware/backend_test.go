@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flightctl/flightctl-ui/upstream"
+)
+
+func TestBackendMiddlewareKeepsUpstreamQuery(t *testing.T) {
+	registry, err := upstream.NewRegistry([]*upstream.Backend{
+		{Name: "prod", ApiUrl: "https://prod.example.com"},
+		{Name: "staging", ApiUrl: "https://staging.example.com"},
+	}, "prod")
+	if err != nil {
+		t.Fatalf("failed to create registry: %v", err)
+	}
+	var selected, forwardedQuery string
+	handler := BackendMiddleware(registry)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		selected = registry.ForRequest(r).Name
+		forwardedQuery = r.URL.RawQuery
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/flightctl/api/v1/devices?backend=edge&fctl_backend=staging", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if selected != "staging" || forwardedQuery != "backend=edge" {
+		t.Fatalf("expected staging to be selected and the upstream query kept, got %q with %q", selected, forwardedQuery)
+	}
+}
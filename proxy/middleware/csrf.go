@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/flightctl/flightctl-ui/common"
+	"github.com/flightctl/flightctl-ui/log"
+	"github.com/flightctl/flightctl-ui/origin"
+)
+
+// CSRFMiddleware rejects state-changing requests (POST, PUT, PATCH, DELETE) sent by pages of other
+// origins. The origin of the page is taken from the Origin header, or the Referer header when the
+// browser did not send one, and must be allowed by origin.IsAllowed. Requests without either header
+// don't come from a browser page (e.g. the CLI or a back-channel call) and are allowed, unless the
+// browser marked them as cross-site.
+func CSRFMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		requestOrigin := r.Header.Get("Origin")
+		if requestOrigin == "" {
+			if referer, err := url.Parse(r.Header.Get("Referer")); err == nil && referer.Host != "" {
+				requestOrigin = origin.FromURL(referer)
+			}
+		}
+
+		var allowed bool
+		if requestOrigin == "" {
+			allowed = r.Header.Get("Sec-Fetch-Site") != "cross-site"
+		} else {
+			allowed = origin.IsAllowed(r, requestOrigin)
+		}
+		if !allowed {
+			log.GetLogger().Warnf("Rejected %s %s from origin %q", r.Method, r.URL.Path, requestOrigin)
+			common.RespondWithJSONError(w, http.StatusForbidden, "Cross-site request rejected", "CSRF_ORIGIN_REJECTED")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
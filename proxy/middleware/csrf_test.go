@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/flightctl/flightctl-ui/log"
+)
+
+func TestCSRFMiddleware(t *testing.T) {
+	log.InitLogs()
+	handler := CSRFMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name   string
+		method string
+		header map[string]string
+		want   int
+	}{
+		{name: "same origin", method: http.MethodPost, header: map[string]string{"Origin": "http://proxy.example.com"}, want: http.StatusOK},
+		{name: "UI origin", method: http.MethodDelete, header: map[string]string{"Origin": "http://localhost:9000"}, want: http.StatusOK},
+		{name: "cross origin", method: http.MethodPut, header: map[string]string{"Origin": "https://evil.example.com"}, want: http.StatusForbidden},
+		{name: "cross origin referer", method: http.MethodPatch, header: map[string]string{"Referer": "https://evil.example.com/page"}, want: http.StatusForbidden},
+		{name: "same origin referer", method: http.MethodPost, header: map[string]string{"Referer": "http://proxy.example.com/devices"}, want: http.StatusOK},
+		{name: "non-browser client", method: http.MethodPost, want: http.StatusOK},
+		{name: "cross-site without origin", method: http.MethodPost, header: map[string]string{"Sec-Fetch-Site": "cross-site"}, want: http.StatusForbidden},
+		{name: "safe method", method: http.MethodGet, header: map[string]string{"Origin": "https://evil.example.com"}, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "http://proxy.example.com/api/flightctl/api/v1/devices", nil)
+			for key, value := range tt.header {
+				req.Header.Set(key, value)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
@@ -1,8 +1,15 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
-	"strings"
+
+	"github.com/flightctl/flightctl-ui/alertmanager"
+	"github.com/flightctl/flightctl-ui/common"
+	"github.com/flightctl/flightctl-ui/log"
+	"github.com/flightctl/flightctl-ui/organization"
+	"github.com/flightctl/flightctl-ui/upstream"
+	"github.com/google/uuid"
 )
 
 const (
@@ -11,72 +18,80 @@ const (
 )
 
 // OrganizationMiddleware adds org_id query parameter to FlightCtl API requests
-// and blocks API calls when no organization is selected
-func OrganizationMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Don't add org_id to requests that don't need it, and for CORS preflight requests
-		if r.Method == http.MethodOptions || !shouldAddOrgIDFromHeader(r.URL.Path) {
-			next.ServeHTTP(w, r)
-			return
-		}
-
-		orgID := r.Header.Get(headerOrganizationID)
+// and blocks API calls when no organization is selected, when the organization ID is malformed,
+// or when the user is not a member of the selected organization.
+// Requests without an organization use the one remembered with PUT /api/organization,
+// or the user's only organization.
+func OrganizationMiddleware(backends *upstream.Registry, memberships *organization.MembershipCache) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Don't add org_id to requests that don't need it, and for CORS preflight requests
+			scoping := orgScopingForPath(r.URL.Path)
+			if r.Method == http.MethodOptions || scoping == orgScopingNone {
+				next.ServeHTTP(w, r)
+				return
+			}
 
-		// For direct browser requests (e.g., download links), also check query parameter
-		// since <a href> links can't send custom headers
-		if orgID == "" {
-			orgID = r.URL.Query().Get(queryOrganizationID)
-		}
+			api := backends.ForRequest(r)
+			authHeader := r.Header.Get(common.AuthHeaderKey)
+			orgID := r.Header.Get(headerOrganizationID)
 
-		if orgID == "" {
-			// No organization selected - block this API call with 428 Precondition required
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusPreconditionRequired)
-			w.Write([]byte(`{"error": "Organization selection required", "code": "ORGANIZATION_REQUIRED"}`))
-			return
-		}
+			// For direct browser requests (e.g., download links), also check query parameter
+			// since <a href> links can't send custom headers
+			if orgID == "" {
+				orgID = r.URL.Query().Get(queryOrganizationID)
+			}
 
-		query := r.URL.Query()
+			// Fall back to the organization remembered for the user, or their only organization
+			if orgID == "" {
+				selected, err := memberships.Selected(w, r, api, authHeader)
+				if errors.Is(err, organization.ErrUnauthorized) {
+					// Let the backend reject the request, so the session is cleared as for any other 401
+					next.ServeHTTP(w, r)
+					return
+				}
+				if err != nil {
+					log.GetLogger().WithError(err).Warn("Failed to look up the user's organizations")
+					common.RespondWithJSONError(w, http.StatusBadGateway, "Failed to verify organization membership", "ORGANIZATION_LOOKUP_FAILED")
+					return
+				}
+				orgID = selected
+			}
 
-		if isAlertsAPICall(r.URL.Path) {
-			// AlertManager expects org_id as a filter parameter
-			query.Set("filter", "org_id="+orgID)
-		} else {
-			query.Set(queryOrganizationID, orgID)
-		}
+			if orgID == "" {
+				// No organization selected - block this API call with 428 Precondition required
+				common.RespondWithJSONError(w, http.StatusPreconditionRequired, "Organization selection required", "ORGANIZATION_REQUIRED")
+				return
+			}
 
-		r.URL.RawQuery = query.Encode()
+			if _, err := uuid.Parse(orgID); err != nil {
+				common.RespondWithJSONError(w, http.StatusBadRequest, "Invalid organization ID", "INVALID_ORGANIZATION_ID")
+				return
+			}
 
-		// Remove the organization header since we've converted it to query param
-		r.Header.Del(headerOrganizationID)
+			isMember, err := memberships.IsMember(api, authHeader, orgID)
+			switch {
+			case errors.Is(err, organization.ErrUnauthorized):
+				// Let the backend reject the request, so the session is cleared as for any other 401
+			case err != nil:
+				log.GetLogger().WithError(err).Warn("Failed to verify organization membership")
+				common.RespondWithJSONError(w, http.StatusBadGateway, "Failed to verify organization membership", "ORGANIZATION_LOOKUP_FAILED")
+				return
+			case !isMember:
+				common.RespondWithJSONError(w, http.StatusForbidden, "You are not a member of the selected organization", "ORGANIZATION_FORBIDDEN")
+				return
+			}
 
-		next.ServeHTTP(w, r)
-	})
-}
-
-func isFlightCtlAPICall(path string) bool {
-	return strings.HasPrefix(path, "/api/flightctl/")
-}
-
-func isAlertsAPICall(path string) bool {
-	return strings.HasPrefix(path, "/api/alerts/")
-}
-
-func isImageBuilderAPICall(path string) bool {
-	return strings.HasPrefix(path, "/api/imagebuilder/")
-}
+			if err := applyOrgScoping(r, scoping, orgID); err != nil {
+				if errors.Is(err, alertmanager.ErrForeignOrganization) {
+					common.RespondWithJSONError(w, http.StatusForbidden, "Alert filters cannot target other organizations", "ORGANIZATION_FORBIDDEN")
+				} else {
+					common.RespondWithJSONError(w, http.StatusBadRequest, err.Error(), "INVALID_ALERT_FILTER")
+				}
+				return
+			}
 
-func shouldAddOrgIDFromHeader(path string) bool {
-	if isFlightCtlAPICall(path) {
-		// This request is used to fetch all existing organizations
-		if strings.HasPrefix(path, "/api/flightctl/api/v1/organizations") {
-			return false
-		}
-		// This request is used to fetch authentication providers from all organizations
-		if strings.HasPrefix(path, "/api/flightctl/api/v1/auth/config") {
-			return false
-		}
-		return true
+			next.ServeHTTP(w, r.WithContext(common.WithOrganizationID(r.Context(), orgID)))
+		})
 	}
-	return isAlertsAPICall(path) || isImageBuilderAPICall(path)
 }
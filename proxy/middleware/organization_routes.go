@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/flightctl/flightctl-ui/alertmanager"
+)
+
+// orgScoping describes how the selected organization is passed to an upstream.
+type orgScoping int
+
+const (
+	// orgScopingNone forwards the request without an organization
+	orgScopingNone orgScoping = iota
+	// orgScopingQueryParam sets the org_id query parameter
+	orgScopingQueryParam
+	// orgScopingHeader sets the X-FlightCtl-Organization-ID header
+	orgScopingHeader
+	// orgScopingAlertMatcher adds an org_id matcher to the AlertManager filters sent by the client,
+	// which must not select other organizations
+	orgScopingAlertMatcher
+)
+
+// orgRoute declares how requests under a path prefix are scoped to the selected organization.
+type orgRoute struct {
+	prefix  string
+	scoping orgScoping
+	// exempt lists path prefixes under prefix that are not scoped to an organization
+	exempt []string
+}
+
+// orgRoutes is matched in order; paths that match no route are not scoped to an organization.
+var orgRoutes = []orgRoute{
+	{
+		prefix:  "/api/flightctl/",
+		scoping: orgScopingQueryParam,
+		exempt: []string{
+			// This request is used to fetch all existing organizations
+			"/api/flightctl/api/v1/organizations",
+			// This request is used to fetch authentication providers from all organizations
+			"/api/flightctl/api/v1/auth/config",
+		},
+	},
+	{prefix: "/api/alerts/", scoping: orgScopingAlertMatcher},
+	{prefix: "/api/alerting/", scoping: orgScopingAlertMatcher},
+	{prefix: "/api/imagebuilder/", scoping: orgScopingQueryParam},
+	// The event stream polls the Flight Control API for the selected organization
+	{prefix: "/api/events", scoping: orgScopingQueryParam},
+	// Permissions are checked in the selected organization
+	{prefix: "/api/permissions", scoping: orgScopingQueryParam},
+}
+
+// orgScopingForPath returns how a request for the given path is scoped to an organization.
+func orgScopingForPath(path string) orgScoping {
+	for _, route := range orgRoutes {
+		if !strings.HasPrefix(path, route.prefix) {
+			continue
+		}
+		for _, exempt := range route.exempt {
+			if strings.HasPrefix(path, exempt) {
+				return orgScopingNone
+			}
+		}
+		return route.scoping
+	}
+	return orgScopingNone
+}
+
+// applyOrgScoping passes orgID to the upstream as described by scoping. The organization
+// sent by the client (header or query parameter) is removed so only the validated one is forwarded.
+func applyOrgScoping(r *http.Request, scoping orgScoping, orgID string) error {
+	query := r.URL.Query()
+	query.Del(queryOrganizationID)
+	r.Header.Del(headerOrganizationID)
+
+	switch scoping {
+	case orgScopingQueryParam:
+		query.Set(queryOrganizationID, orgID)
+	case orgScopingHeader:
+		r.Header.Set(headerOrganizationID, orgID)
+	case orgScopingAlertMatcher:
+		filters, err := alertmanager.ScopeFilters(query["filter"], orgID)
+		if err != nil {
+			return err
+		}
+		query["filter"] = filters
+	}
+	r.URL.RawQuery = query.Encode()
+	return nil
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestOrgScopingForPath(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		path string
+		want orgScoping
+	}{
+		{path: "/api/flightctl/api/v1/devices", want: orgScopingQueryParam},
+		{path: "/api/flightctl/api/v1/fleets/my-fleet", want: orgScopingQueryParam},
+		{path: "/api/flightctl/api/v1/organizations", want: orgScopingNone},
+		{path: "/api/flightctl/api/v1/auth/config", want: orgScopingNone},
+		{path: "/api/alerts/api/v2/alerts", want: orgScopingAlertMatcher},
+		{path: "/api/alerting/silences", want: orgScopingAlertMatcher},
+		{path: "/api/events", want: orgScopingQueryParam},
+		{path: "/api/imagebuilder/api/v1/imagebuilds", want: orgScopingQueryParam},
+		{path: "/api/terminal/my-device", want: orgScopingNone},
+		{path: "/api/login", want: orgScopingNone},
+		{path: "/api/flightctl", want: orgScopingNone},
+	}
+	for _, tc := range tests {
+		if got := orgScopingForPath(tc.path); got != tc.want {
+			t.Errorf("orgScopingForPath(%q) = %v, want %v", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestApplyOrgScoping(t *testing.T) {
+	t.Parallel()
+
+	const orgID = "2f6b1a4e-8c1d-4f0a-9b7e-3c5d6e7f8a90"
+	tests := []struct {
+		name        string
+		target      string
+		scoping     orgScoping
+		wantQuery   map[string][]string
+		wantHeader  string
+		unwantedKey string
+	}{
+		{
+			name:      "query parameter replaces the client's",
+			target:    "/api/flightctl/api/v1/devices?limit=10&org_id=other",
+			scoping:   orgScopingQueryParam,
+			wantQuery: map[string][]string{"limit": {"10"}, "org_id": {orgID}},
+		},
+		{
+			name:        "header",
+			target:      "/api/upstream?org_id=" + orgID,
+			scoping:     orgScopingHeader,
+			wantQuery:   map[string][]string{},
+			wantHeader:  orgID,
+			unwantedKey: "org_id",
+		},
+		{
+			name:    "alert matcher is added to existing filters",
+			target:  "/api/alerts/api/v2/alerts?filter=severity%3D%22critical%22&active=true",
+			scoping: orgScopingAlertMatcher,
+			wantQuery: map[string][]string{
+				"active": {"true"},
+				"filter": {"org_id=" + orgID, `severity="critical"`},
+			},
+			unwantedKey: "org_id",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tc.target, nil)
+			r.Header.Set(headerOrganizationID, orgID)
+			if err := applyOrgScoping(r, tc.scoping, orgID); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			query := r.URL.Query()
+			for key, want := range tc.wantQuery {
+				if !slices.Equal(query[key], want) {
+					t.Errorf("query %q = %q, want %q", key, query[key], want)
+				}
+			}
+			if tc.unwantedKey != "" && query.Has(tc.unwantedKey) {
+				t.Errorf("query parameter %q should have been removed: %q", tc.unwantedKey, r.URL.RawQuery)
+			}
+			if got := r.Header.Get(headerOrganizationID); got != tc.wantHeader {
+				t.Errorf("header = %q, want %q", got, tc.wantHeader)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/flightctl/flightctl-ui/organization"
+	"github.com/flightctl/flightctl-ui/upstream"
+)
+
+const (
+	memberOrgID    = "2f6b1a4e-8c1d-4f0a-9b7e-3c5d6e7f8a90"
+	nonMemberOrgID = "7d1e2f3a-4b5c-4d6e-8f9a-0b1c2d3e4f50"
+	otherOrgID     = "c3d4e5f6-a7b8-4c9d-8e0f-1a2b3c4d5e6f"
+)
+
+// newOrganizationsBackend serves a fake organizations list containing memberOrgID (and otherOrgID
+// for the "multi" token) and counts the requests. The "expired" token gets a 401, "forbidden" a 403.
+func newOrganizationsBackend(t *testing.T) (*upstream.Registry, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path != "/api/v1/organizations" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("Authorization") == "Bearer expired" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("Authorization") == "Bearer forbidden" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		items := `{"metadata": {"name": "` + memberOrgID + `"}}`
+		if r.Header.Get("Authorization") == "Bearer multi" {
+			items += `, {"metadata": {"name": "` + otherOrgID + `"}}`
+		}
+		_, _ = w.Write([]byte(`{"items": [` + items + `]}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	registry, err := upstream.NewRegistry([]*upstream.Backend{{Name: "test", ApiUrl: srv.URL}}, "test")
+	if err != nil {
+		t.Fatalf("failed to create registry: %v", err)
+	}
+	return registry, &requests
+}
+
+func TestOrganizationMiddlewareValidatesMembership(t *testing.T) {
+	registry, requests := newOrganizationsBackend(t)
+	var forwardedQuery string
+	handler := OrganizationMiddleware(registry, organization.NewMembershipCache(time.Minute))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			forwardedQuery = r.URL.RawQuery
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+
+	tests := []struct {
+		name       string
+		orgID      string
+		token      string
+		wantStatus int
+		wantCode   string
+		wantCookie bool
+	}{
+		{name: "missing organization", token: "multi", wantStatus: http.StatusPreconditionRequired, wantCode: "ORGANIZATION_REQUIRED"},
+		{name: "only organization is selected", token: "valid", wantStatus: http.StatusOK, wantCookie: true},
+		{name: "malformed organization", orgID: "not-a-uuid", wantStatus: http.StatusBadRequest, wantCode: "INVALID_ORGANIZATION_ID"},
+		{name: "non-member", orgID: nonMemberOrgID, token: "valid", wantStatus: http.StatusForbidden, wantCode: "ORGANIZATION_FORBIDDEN"},
+		{name: "member", orgID: memberOrgID, token: "valid", wantStatus: http.StatusOK},
+		{name: "rejected credentials are left to the backend", orgID: memberOrgID, token: "expired", wantStatus: http.StatusOK},
+		{name: "users who may not list organizations are not members", orgID: memberOrgID, token: "forbidden", wantStatus: http.StatusForbidden, wantCode: "ORGANIZATION_FORBIDDEN"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/flightctl/api/v1/devices", nil)
+			if tc.orgID != "" {
+				req.Header.Set(headerOrganizationID, tc.orgID)
+			}
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tc.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tc.wantCode != "" {
+				var body map[string]string
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body["code"] != tc.wantCode {
+					t.Fatalf("expected code %q, got %q", tc.wantCode, rec.Body.String())
+				}
+			}
+			if gotCookie := rec.Header().Get("Set-Cookie") != ""; gotCookie != tc.wantCookie {
+				t.Fatalf("expected selection cookie %v, got %q", tc.wantCookie, rec.Header().Get("Set-Cookie"))
+			}
+		})
+	}
+
+	if forwardedQuery != "org_id="+memberOrgID {
+		t.Fatalf("expected org_id to be forwarded, got %q", forwardedQuery)
+	}
+	// The "valid" lookups share one cached list; the rejected token is not cached
+	if got := requests.Load(); got != 4 {
+		t.Fatalf("expected 4 organization lookups, got %d", got)
+	}
+}
@@ -0,0 +1,179 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"expvar"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flightctl/flightctl-ui/auth"
+	"github.com/flightctl/flightctl-ui/common"
+	"github.com/flightctl/flightctl-ui/config"
+	"github.com/flightctl/flightctl-ui/origin"
+)
+
+// rateLimitMetrics exposes the number of rejected requests per limit through expvar (see config.MetricsPort).
+var rateLimitMetrics = expvar.NewMap("rateLimit")
+
+// rateLimiterMaxBuckets bounds the number of clients tracked per limit; full buckets are pruned once it
+// is reached, then the least recently seen clients are forgotten.
+const rateLimiterMaxBuckets = 10000
+
+// Limits applied to API requests. Login and connection test requests are not counted against the API limits.
+const (
+	rateLimitLogin          = "login"
+	rateLimitTestConnection = "testConnection"
+	rateLimitAPI            = "api"
+	rateLimitAPIPerIP       = "apiPerIP"
+)
+
+// rateLimiter is a token bucket per client: each client may send up to perMinute requests at once,
+// and regains one request every minute/perMinute.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns nil when perMinute is zero, meaning unlimited.
+func newRateLimiter(perMinute int) *rateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(perMinute),
+		buckets: map[string]*tokenBucket{},
+	}
+}
+
+// allow takes a token from the client's bucket. When none is left, it returns how long until one is.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= rateLimiterMaxBuckets {
+			l.pruneLocked(now)
+		}
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// pruneLocked forgets clients whose bucket is full again, which is the same as never having seen them.
+// When every client is still limited, the least recently seen one is forgotten instead.
+func (l *rateLimiter) pruneLocked(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	if len(l.buckets) < rateLimiterMaxBuckets {
+		return
+	}
+	var oldestKey string
+	var oldest time.Time
+	for key, b := range l.buckets {
+		if oldestKey == "" || b.last.Before(oldest) {
+			oldestKey, oldest = key, b.last
+		}
+	}
+	delete(l.buckets, oldestKey)
+}
+
+// RateLimitMiddleware limits how often each client may log in or refresh its session, test an
+// authentication provider connection, and call the API. Login attempts and connection tests are
+// counted per client IP; other requests per client IP and, when a session or token is present, per
+// user as well. Requests over a limit are answered with 429 and a Retry-After header.
+func RateLimitMiddleware() func(http.Handler) http.Handler {
+	limiters := map[string]*rateLimiter{
+		rateLimitLogin:          newRateLimiter(config.RateLimitLoginPerMinute),
+		rateLimitTestConnection: newRateLimiter(config.RateLimitTestConnectionPerMinute),
+		rateLimitAPI:            newRateLimiter(config.RateLimitAPIPerMinute),
+		rateLimitAPIPerIP:       newRateLimiter(config.RateLimitAPIPerIPPerMinute),
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+			now := time.Now()
+			limit := rateLimitForPath(r.URL.Path)
+			key := "ip:" + origin.ClientIP(r)
+			if limit == rateLimitAPI {
+				// Credentials are not verified here, so sending new ones must not escape the client IP's limit
+				if allowed, retryAfter := limiters[rateLimitAPIPerIP].allow(key, now); !allowed {
+					respondRateLimited(w, rateLimitAPIPerIP, retryAfter)
+					return
+				}
+				if user := userIdentity(r); user != "" {
+					key = "user:" + user
+				}
+			}
+
+			if allowed, retryAfter := limiters[limit].allow(key, now); !allowed {
+				respondRateLimited(w, limit, retryAfter)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func respondRateLimited(w http.ResponseWriter, limit string, retryAfter time.Duration) {
+	rateLimitMetrics.Add(limit, 1)
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	common.RespondWithJSONError(w, http.StatusTooManyRequests, "Too many requests, please retry later", "RATE_LIMITED")
+}
+
+func rateLimitForPath(path string) string {
+	switch strings.TrimSuffix(path, "/") {
+	case "/api/login", "/api/login/refresh", "/api/login/device":
+		return rateLimitLogin
+	case "/api/test-auth-provider-connection":
+		return rateLimitTestConnection
+	default:
+		return rateLimitAPI
+	}
+}
+
+// userIdentity is a hash of the credentials sent with the request: the Authorization header set by
+// the OpenShift console, or the session cookie's token (or service session).
+func userIdentity(r *http.Request) string {
+	credentials := r.Header.Get(common.AuthHeaderKey)
+	if credentials == "" {
+		if tokenData, err := auth.ParseSessionCookie(r); err == nil {
+			credentials = tokenData.Token + tokenData.ServiceSession
+		}
+	}
+	if credentials == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(credentials))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/flightctl/flightctl-ui/config"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(60)
+	now := time.Now()
+
+	for i := 0; i < 60; i++ {
+		if ok, _ := limiter.allow("alice", now); !ok {
+			t.Fatalf("request %d of the burst was rejected", i+1)
+		}
+	}
+	ok, retryAfter := limiter.allow("alice", now)
+	if ok || retryAfter != time.Second {
+		t.Fatalf("expected a rejection with a 1s retry, got %v %v", ok, retryAfter)
+	}
+	if ok, _ := limiter.allow("bob", now); !ok {
+		t.Fatal("clients must be limited separately")
+	}
+	if ok, _ := limiter.allow("alice", now.Add(time.Second)); !ok {
+		t.Fatal("expected a token to be regained after a second")
+	}
+
+	if ok, _ := newRateLimiter(0).allow("alice", now); !ok {
+		t.Fatal("a zero limit must not reject requests")
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	handler := RateLimitMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	send := func(path, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Login attempts exhaust their own limit, not the API's
+	var rec *httptest.ResponseRecorder
+	for i := 0; i <= 20; i++ {
+		rec = send("/api/login", "192.0.2.1:1234")
+	}
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "3" {
+		t.Fatalf("expected 429 with Retry-After 3, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := send("/api/login", "192.0.2.2:1234"); rec.Code != http.StatusOK {
+		t.Fatalf("expected other clients to log in, got %d", rec.Code)
+	}
+	if rec := send("/api/flightctl/api/v1/devices", "192.0.2.1:1234"); rec.Code != http.StatusOK {
+		t.Fatalf("expected API requests to be allowed, got %d", rec.Code)
+	}
+}
+
+func TestRateLimiterForgetsLeastRecentlySeenClients(t *testing.T) {
+	limiter := newRateLimiter(1)
+	now := time.Now()
+	for i := range rateLimiterMaxBuckets {
+		limiter.allow(strconv.Itoa(i), now.Add(time.Duration(i)*time.Millisecond))
+	}
+	// "0" is the least recently seen client; every other one is still limited
+	if ok, _ := limiter.allow("new", now.Add(time.Second)); !ok {
+		t.Fatal("expected a new client to be allowed")
+	}
+	if len(limiter.buckets) != rateLimiterMaxBuckets {
+		t.Fatalf("expected %d buckets, got %d", rateLimiterMaxBuckets, len(limiter.buckets))
+	}
+	if _, ok := limiter.buckets["0"]; ok {
+		t.Fatal("expected the least recently seen client to be forgotten")
+	}
+	if ok, _ := limiter.allow("1", now.Add(time.Second)); ok {
+		t.Fatal("expected the other clients to stay limited")
+	}
+}
+
+func TestRateLimitMiddlewareLimitsClientIPsWhateverTheirCredentials(t *testing.T) {
+	perIP := config.RateLimitAPIPerIPPerMinute
+	config.RateLimitAPIPerIPPerMinute = 5
+	t.Cleanup(func() { config.RateLimitAPIPerIPPerMinute = perIP })
+	handler := RateLimitMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	var rec *httptest.ResponseRecorder
+	for i := 0; i <= 5; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/flightctl/api/v1/devices", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("Authorization", "Bearer forged-"+strconv.Itoa(i))
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+	}
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected new credentials not to escape the client IP's limit, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/flightctl/flightctl-ui/common"
+	"github.com/flightctl/flightctl-ui/config"
+)
+
+const (
+	// defaultMaxBodySize applies to requests that match no route
+	defaultMaxBodySize = 1 << 20
+	// authMaxBodySize bounds login, logout and connection test payloads
+	authMaxBodySize = 64 << 10
+	// unlimitedBodySize lets a route stream request bodies of any size
+	unlimitedBodySize = -1
+)
+
+// requestLimitRoute declares the request bodies accepted under a path prefix.
+type requestLimitRoute struct {
+	prefix      string
+	maxBodySize int64
+	// json requires request bodies to be sent as application/json
+	json bool
+}
+
+// requestLimitRoutes is matched in order. The proxy's own endpoints only accept JSON; the
+// media types of proxied requests are left for the backends to check.
+var requestLimitRoutes = []requestLimitRoute{
+	{prefix: "/api/login", maxBodySize: authMaxBodySize, json: true},
+	{prefix: "/api/logout", maxBodySize: authMaxBodySize},
+	{prefix: "/api/test-auth-provider-connection", maxBodySize: authMaxBodySize, json: true},
+	{prefix: "/api/organization", maxBodySize: authMaxBodySize, json: true},
+	{prefix: "/api/alerting/", maxBodySize: defaultMaxBodySize, json: true},
+	// Image uploads are streamed to the ImageBuilder API
+	{prefix: "/api/imagebuilder/", maxBodySize: unlimitedBodySize},
+	{prefix: "/api/flightctl/", maxBodySize: int64(config.ApiMaxRequestBodySize)},
+	{prefix: "/api/alerts/", maxBodySize: int64(config.ApiMaxRequestBodySize)},
+}
+
+func requestLimitsForPath(path string) requestLimitRoute {
+	for _, route := range requestLimitRoutes {
+		if strings.HasPrefix(path, route.prefix) {
+			return route
+		}
+	}
+	return requestLimitRoute{maxBodySize: defaultMaxBodySize}
+}
+
+// RequestLimitsMiddleware rejects request bodies over the size limit of their route with 413,
+// and bodies of JSON endpoints sent with another media type with 415. Bodies without a
+// Content-Length are cut at the limit; handlers report it with common.IsBodyTooLarge.
+func RequestLimitsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := requestLimitsForPath(r.URL.Path)
+		if r.ContentLength == 0 || r.Body == nil || r.Body == http.NoBody {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if route.maxBodySize != unlimitedBodySize {
+			if r.ContentLength > route.maxBodySize {
+				common.RespondWithBodyTooLarge(w)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, route.maxBodySize)
+		}
+		if route.json {
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil || mediaType != "application/json" {
+				common.RespondWithJSONError(w, http.StatusUnsupportedMediaType, "Request body must be sent as application/json", "UNSUPPORTED_MEDIA_TYPE")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/flightctl/flightctl-ui/common"
+)
+
+func TestRequestLimitsMiddleware(t *testing.T) {
+	handler := RequestLimitsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Code string `json:"code"`
+		}
+		if common.DecodeJSONBody(w, r, &body) {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+
+	large := `{"code":"` + strings.Repeat("x", authMaxBodySize) + `"}`
+	tests := []struct {
+		name          string
+		path          string
+		contentType   string
+		body          string
+		unknownLength bool
+		want          int
+	}{
+		{name: "valid", path: "/api/login", contentType: "application/json; charset=utf-8", body: `{"code":"c"}`, want: http.StatusNoContent},
+		{name: "wrong media type", path: "/api/login", contentType: "text/plain", body: `{"code":"c"}`, want: http.StatusUnsupportedMediaType},
+		{name: "unknown field", path: "/api/login", contentType: "application/json", body: `{"code":"c","extra":1}`, want: http.StatusBadRequest},
+		{name: "too large", path: "/api/login", contentType: "application/json", body: large, want: http.StatusRequestEntityTooLarge},
+		{name: "too large without length", path: "/api/login", contentType: "application/json", body: large, unknownLength: true, want: http.StatusRequestEntityTooLarge},
+		{name: "proxied API", path: "/api/flightctl/api/v1/devices", contentType: "application/json", body: large, want: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			if tt.unknownLength {
+				req.ContentLength = -1
+				req.Body = io.NopCloser(req.Body)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("expected %d, got %d: %s", tt.want, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package organization
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/flightctl/flightctl-ui/upstream"
+	"github.com/flightctl/flightctl/api/v1beta1"
+)
+
+// membershipCacheMaxEntries bounds the cache; expired entries are pruned once it is reached, then the oldest.
+const membershipCacheMaxEntries = 10000
+
+// ErrUnauthorized is returned when the backend rejects the user's credentials while listing organizations.
+var ErrUnauthorized = errors.New("not authorized to list organizations")
+
+type membershipEntry struct {
+	organizations []v1beta1.Organization
+	expires       time.Time
+}
+
+// MembershipCache caches the organizations each user belongs to, per backend.
+// Users are identified by a hash of their Authorization header, so tokens are never stored.
+type MembershipCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]membershipEntry
+}
+
+func NewMembershipCache(ttl time.Duration) *MembershipCache {
+	return &MembershipCache{
+		ttl:     ttl,
+		entries: map[string]membershipEntry{},
+	}
+}
+
+// Organizations returns the organizations the user identified by authHeader belongs to on the backend.
+func (c *MembershipCache) Organizations(api *upstream.Backend, authHeader string) ([]v1beta1.Organization, error) {
+	key := membershipKey(api, authHeader)
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.organizations, nil
+	}
+
+	organizations, err := listOrganizations(api, authHeader)
+	if err != nil {
+		return nil, err
+	}
+	if c.ttl > 0 {
+		c.mu.Lock()
+		if len(c.entries) >= membershipCacheMaxEntries {
+			c.pruneLocked(now)
+		}
+		c.entries[key] = membershipEntry{organizations: organizations, expires: now.Add(c.ttl)}
+		c.mu.Unlock()
+	}
+	return organizations, nil
+}
+
+// IsMember reports whether the user belongs to the organization with the given ID.
+func (c *MembershipCache) IsMember(api *upstream.Backend, authHeader, orgID string) (bool, error) {
+	organizations, err := c.Organizations(api, authHeader)
+	if err != nil {
+		return false, err
+	}
+	return slices.ContainsFunc(organizations, func(org v1beta1.Organization) bool {
+		return org.Metadata.Name != nil && *org.Metadata.Name == orgID
+	}), nil
+}
+
+func (c *MembershipCache) pruneLocked(now time.Time) {
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+	if len(c.entries) < membershipCacheMaxEntries {
+		return
+	}
+	var oldestKey string
+	var oldest time.Time
+	for key, entry := range c.entries {
+		if oldestKey == "" || entry.expires.Before(oldest) {
+			oldestKey, oldest = key, entry.expires
+		}
+	}
+	delete(c.entries, oldestKey)
+}
+
+func membershipKey(api *upstream.Backend, authHeader string) string {
+	sum := sha256.Sum256([]byte(authHeader))
+	return api.Name + "/" + hex.EncodeToString(sum[:])
+}
+
+func listOrganizations(api *upstream.Backend, authHeader string) ([]v1beta1.Organization, error) {
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: api.TlsConfig,
+		},
+		Timeout: 30 * time.Second,
+	}
+
+	organizationsURL, err := api.ApiURL("api/v1/organizations")
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, organizationsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if authHeader != "" {
+		req.Header.Set("Authorization", authHeader)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organizations: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, ErrUnauthorized
+	}
+	// The credentials are valid, but the user may not list organizations: they are a member of none
+	if resp.StatusCode == http.StatusForbidden {
+		return []v1beta1.Organization{}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("listing organizations returned status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read organizations response: %w", err)
+	}
+	var list v1beta1.OrganizationList
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse organizations response: %w", err)
+	}
+	return list.Items, nil
+}
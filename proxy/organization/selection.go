@@ -0,0 +1,154 @@
+package organization
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/flightctl/flightctl-ui/auth"
+	"github.com/flightctl/flightctl-ui/common"
+	"github.com/flightctl/flightctl-ui/log"
+	"github.com/flightctl/flightctl-ui/upstream"
+	"github.com/flightctl/flightctl/api/v1beta1"
+	"github.com/google/uuid"
+)
+
+// Selected returns the organization remembered for the user on the backend. When none is remembered
+// and the user belongs to exactly one organization, that organization is selected and remembered.
+// Returns empty string when the user still has to choose an organization.
+func (c *MembershipCache) Selected(w http.ResponseWriter, r *http.Request, api *upstream.Backend, authHeader string) (string, error) {
+	if orgID := auth.GetOrganizationCookie(r, api.Name); orgID != "" {
+		return orgID, nil
+	}
+	organizations, err := c.Organizations(api, authHeader)
+	if err != nil {
+		return "", err
+	}
+	if len(organizations) != 1 || organizations[0].Metadata.Name == nil {
+		return "", nil
+	}
+	orgID := *organizations[0].Metadata.Name
+	auth.SetOrganizationCookie(w, r, api.Name, orgID)
+	return orgID, nil
+}
+
+type SelectedOrganization struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"displayName,omitempty"`
+}
+
+type OrganizationResponse struct {
+	// Organization is null when the user has not selected an organization yet
+	Organization *SelectedOrganization `json:"organization"`
+}
+
+type SetOrganizationRequest struct {
+	// ID of the organization to select; empty clears the selection
+	ID string `json:"id"`
+}
+
+// Handler serves the organization remembered for the user on the selected backend.
+type Handler struct {
+	backends    *upstream.Registry
+	memberships *MembershipCache
+}
+
+func NewHandler(backends *upstream.Registry, memberships *MembershipCache) *Handler {
+	return &Handler{backends: backends, memberships: memberships}
+}
+
+// GetOrganization returns the selected organization. A remembered organization the user
+// no longer belongs to is forgotten.
+func (h *Handler) GetOrganization(w http.ResponseWriter, r *http.Request) {
+	api := h.backends.ForRequest(r)
+	authHeader := r.Header.Get(common.AuthHeaderKey)
+
+	organizations, err := h.memberships.Organizations(api, authHeader)
+	if err != nil {
+		respondWithLookupError(w, err)
+		return
+	}
+
+	orgID := auth.GetOrganizationCookie(r, api.Name)
+	if orgID != "" && findOrganization(organizations, orgID) == nil {
+		auth.ClearOrganizationCookie(w, r, api.Name)
+		orgID = ""
+	}
+	if orgID == "" {
+		if orgID, err = h.memberships.Selected(w, r, api, authHeader); err != nil {
+			respondWithLookupError(w, err)
+			return
+		}
+	}
+	respondWithOrganization(w, findOrganization(organizations, orgID))
+}
+
+// SetOrganization remembers the organization used for requests that don't specify one.
+func (h *Handler) SetOrganization(w http.ResponseWriter, r *http.Request) {
+	api := h.backends.ForRequest(r)
+
+	var req SetOrganizationRequest
+	if !common.DecodeJSONBody(w, r, &req) {
+		return
+	}
+	if req.ID == "" {
+		auth.ClearOrganizationCookie(w, r, api.Name)
+		respondWithOrganization(w, nil)
+		return
+	}
+	if _, err := uuid.Parse(req.ID); err != nil {
+		common.RespondWithJSONError(w, http.StatusBadRequest, "Invalid organization ID", "INVALID_ORGANIZATION_ID")
+		return
+	}
+
+	organizations, err := h.memberships.Organizations(api, r.Header.Get(common.AuthHeaderKey))
+	if err != nil {
+		respondWithLookupError(w, err)
+		return
+	}
+	org := findOrganization(organizations, req.ID)
+	if org == nil {
+		common.RespondWithJSONError(w, http.StatusForbidden, "You are not a member of the selected organization", "ORGANIZATION_FORBIDDEN")
+		return
+	}
+	auth.SetOrganizationCookie(w, r, api.Name, req.ID)
+	respondWithOrganization(w, org)
+}
+
+func findOrganization(organizations []v1beta1.Organization, orgID string) *v1beta1.Organization {
+	if orgID == "" {
+		return nil
+	}
+	for i, org := range organizations {
+		if org.Metadata.Name != nil && *org.Metadata.Name == orgID {
+			return &organizations[i]
+		}
+	}
+	return nil
+}
+
+func respondWithOrganization(w http.ResponseWriter, org *v1beta1.Organization) {
+	resp := OrganizationResponse{}
+	if org != nil {
+		resp.Organization = &SelectedOrganization{ID: *org.Metadata.Name}
+		if org.Spec != nil && org.Spec.DisplayName != nil {
+			resp.Organization.DisplayName = *org.Spec.DisplayName
+		}
+	}
+	payload, err := json.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(payload)
+}
+
+func respondWithLookupError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrUnauthorized) {
+		common.RespondWithJSONError(w, http.StatusUnauthorized, "Not authorized to list organizations", "UNAUTHORIZED")
+		return
+	}
+	log.GetLogger().WithError(err).Warn("Failed to look up the user's organizations")
+	common.RespondWithJSONError(w, http.StatusBadGateway, "Failed to look up organizations", "ORGANIZATION_LOOKUP_FAILED")
+}
@@ -23,6 +23,63 @@ func IsOpenShiftConsoleProxyWebSocketOrigin(origin string) bool {
 	return Normalize(u.Scheme, u.Host) == openshiftConsoleProxyWebSocketOrigin
 }
 
+// IsAllowed reports whether a browser request sent from requestOrigin (an Origin header value) may act
+// on the proxy. It allows:
+//   - The configured BaseUiUrl origin
+//   - Same-origin requests (Origin matches request Host)
+//   - The origins listed in TRUSTED_ORIGINS (e.g. the OpenShift console)
+//   - OpenShift console plugin proxy only: Origin is the console's documented placeholder
+//     (http://localhost) and X-Forwarded-Host/Proto match BASE_UI_URL — not a blanket bypass
+//     for arbitrary Origin values when forwarded headers match the destination host
+//
+// Host comparisons are case-insensitive per RFC 3986.
+func IsAllowed(r *http.Request, requestOrigin string) bool {
+	originURL, err := url.Parse(requestOrigin)
+	if err != nil || originURL.Scheme == "" || originURL.Host == "" {
+		return false
+	}
+	normalized := FromURL(originURL)
+
+	baseURL, err := url.Parse(config.BaseUiUrl)
+	if err != nil {
+		baseURL = nil
+	} else if normalized == FromURL(baseURL) {
+		return true
+	}
+
+	// Allow same-origin requests (direct access to the proxy, not via console plugin).
+	if normalized == DirectRequestOrigin(r) {
+		return true
+	}
+
+	for _, trusted := range strings.Split(config.TrustedOrigins, ",") {
+		if trustedURL, err := url.Parse(strings.TrimSpace(trusted)); err == nil && trustedURL.Host != "" && normalized == FromURL(trustedURL) {
+			return true
+		}
+	}
+
+	return isOpenShiftConsolePluginProxyOriginAllowed(r, requestOrigin, baseURL)
+}
+
+// isOpenShiftConsolePluginProxyOriginAllowed permits the console backend hop only when
+// Origin is openshift/console's fixed placeholder (http://localhost), not when an attacker
+// supplies another Origin but forges X-Forwarded-Host to match BASE_UI_URL.
+func isOpenShiftConsolePluginProxyOriginAllowed(r *http.Request, origin string, baseURL *url.URL) bool {
+	if config.OcpPlugin != "true" {
+		return false
+	}
+	if !config.ShouldTrustForwardedHeaders(r) || strings.TrimSpace(r.Header.Get("X-Forwarded-Host")) == "" {
+		return false
+	}
+	if baseURL == nil {
+		return false
+	}
+	if !IsOpenShiftConsoleProxyWebSocketOrigin(origin) {
+		return false
+	}
+	return FromURL(baseURL) == EffectiveRequestOrigin(r)
+}
+
 // EffectiveRequest returns the client-facing scheme and host for the request.
 // When trusted X-Forwarded-* headers are present, they define the origin; otherwise r.Host is used.
 func EffectiveRequest(r *http.Request) (scheme, host string) {
@@ -43,6 +100,25 @@ func EffectiveRequest(r *http.Request) (scheme, host string) {
 	return scheme, host
 }
 
+// ClientIP returns the address of the client that sent the request. When X-Forwarded-* headers are
+// trusted (see EffectiveRequest), the last X-Forwarded-For entry is used: the address the trusted proxy
+// received the request from. Earlier entries are set by the client and cannot be trusted.
+func ClientIP(r *http.Request) string {
+	if config.ShouldTrustForwardedHeaders(r) {
+		if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+			entries := strings.Split(xff[len(xff)-1], ",")
+			if ip := net.ParseIP(strings.TrimSpace(entries[len(entries)-1])); ip != nil {
+				return ip.String()
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 // EffectiveRequestOrigin returns the normalized client-facing origin (scheme://host[:port]).
 func EffectiveRequestOrigin(r *http.Request) string {
 	rs, rh := EffectiveRequest(r)
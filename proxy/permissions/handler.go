@@ -0,0 +1,224 @@
+package permissions
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/flightctl/flightctl-ui/common"
+	"github.com/flightctl/flightctl-ui/log"
+	"github.com/flightctl/flightctl-ui/upstream"
+	"github.com/flightctl/flightctl/api/v1beta1"
+)
+
+// cacheMaxEntries bounds the cache; expired entries are pruned once it is reached.
+const cacheMaxEntries = 10000
+
+// maxPermissionsSize bounds the permissions response read from the Flight Control API
+const maxPermissionsSize = 1 << 20
+
+// wildcard grants all resources or all operations in a Flight Control permission
+const wildcard = "*"
+
+// errUnauthorized is returned when the backend rejects the user's credentials
+var errUnauthorized = errors.New("not authorized to get permissions")
+
+var resourceVerbs = []string{"get", "list", "create", "update", "patch", "delete"}
+
+// checks is the resource × verb matrix the UI needs to decide which actions to show
+var checks = []struct {
+	resource string
+	verbs    []string
+}{
+	{resource: "devices", verbs: resourceVerbs},
+	{resource: "fleets", verbs: resourceVerbs},
+	{resource: "repositories", verbs: resourceVerbs},
+	{resource: "enrollmentrequests", verbs: resourceVerbs},
+	{resource: "enrollmentrequests/approval", verbs: []string{"update"}},
+	{resource: "imagebuilds", verbs: resourceVerbs},
+	{resource: "devices/console", verbs: []string{"get"}},
+	{resource: "devices/applications/console", verbs: []string{"get"}},
+}
+
+// PermissionsResponse maps each resource to whether the user may perform each verb on it
+type PermissionsResponse struct {
+	Permissions map[string]map[string]bool `json:"permissions"`
+}
+
+type cacheEntry struct {
+	permissions map[string]map[string]bool
+	expires     time.Time
+}
+
+// Handler answers which actions the user may perform in the selected organization, so the UI can
+// hide the ones it can't instead of discovering them through 403s. The permissions of the user are
+// fetched once from the Flight Control API for the whole matrix, and cached per session and
+// organization for ttl.
+type Handler struct {
+	backends *upstream.Registry
+	ttl      time.Duration
+	mu       sync.Mutex
+	entries  map[string]cacheEntry
+}
+
+func NewHandler(backends *upstream.Registry, ttl time.Duration) *Handler {
+	return &Handler{
+		backends: backends,
+		ttl:      ttl,
+		entries:  map[string]cacheEntry{},
+	}
+}
+
+// GetPermissions returns the permissions of the user in the selected organization
+func (h *Handler) GetPermissions(w http.ResponseWriter, r *http.Request) {
+	orgID, ok := common.OrganizationIDFromContext(r.Context())
+	if !ok {
+		common.RespondWithJSONError(w, http.StatusPreconditionRequired, "Organization selection required", "ORGANIZATION_REQUIRED")
+		return
+	}
+
+	permissions, err := h.permissions(h.backends.ForRequest(r), r.Header.Get(common.AuthHeaderKey), orgID)
+	if errors.Is(err, errUnauthorized) {
+		common.RespondWithJSONError(w, http.StatusUnauthorized, "Not authorized to get permissions", "UNAUTHORIZED")
+		return
+	}
+	if err != nil {
+		log.GetLogger().WithError(err).Warn("Failed to get the user's permissions")
+		common.RespondWithJSONError(w, http.StatusBadGateway, "Failed to get permissions", "PERMISSIONS_LOOKUP_FAILED")
+		return
+	}
+
+	payload, err := json.Marshal(PermissionsResponse{Permissions: permissions})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(payload)
+}
+
+func (h *Handler) permissions(api *upstream.Backend, authHeader string, orgID string) (map[string]map[string]bool, error) {
+	key := cacheKey(api, authHeader, orgID)
+	now := time.Now()
+
+	h.mu.Lock()
+	entry, ok := h.entries[key]
+	h.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.permissions, nil
+	}
+
+	granted, err := getPermissions(api, authHeader, orgID)
+	if err != nil {
+		return nil, err
+	}
+	permissions := evaluate(granted)
+	if h.ttl > 0 {
+		h.mu.Lock()
+		if len(h.entries) >= cacheMaxEntries {
+			h.pruneLocked(now)
+		}
+		h.entries[key] = cacheEntry{permissions: permissions, expires: now.Add(h.ttl)}
+		h.mu.Unlock()
+	}
+	return permissions, nil
+}
+
+// pruneLocked removes the expired entries. When every entry is still valid, the one expiring
+// first, which is the oldest, is removed instead.
+func (h *Handler) pruneLocked(now time.Time) {
+	for key, entry := range h.entries {
+		if !now.Before(entry.expires) {
+			delete(h.entries, key)
+		}
+	}
+	if len(h.entries) < cacheMaxEntries {
+		return
+	}
+	var oldestKey string
+	var oldest time.Time
+	for key, entry := range h.entries {
+		if oldestKey == "" || entry.expires.Before(oldest) {
+			oldestKey, oldest = key, entry.expires
+		}
+	}
+	delete(h.entries, oldestKey)
+}
+
+// cacheKey identifies the session by a hash of its Authorization header, so tokens are never stored
+func cacheKey(api *upstream.Backend, authHeader string, orgID string) string {
+	sum := sha256.Sum256([]byte(authHeader))
+	return api.Name + "/" + orgID + "/" + hex.EncodeToString(sum[:])
+}
+
+// evaluate answers the checks with the permissions granted to the user
+func evaluate(granted []v1beta1.Permission) map[string]map[string]bool {
+	permissions := map[string]map[string]bool{}
+	for _, check := range checks {
+		verbs := map[string]bool{}
+		for _, verb := range check.verbs {
+			verbs[verb] = slices.ContainsFunc(granted, func(p v1beta1.Permission) bool {
+				return (p.Resource == check.resource || p.Resource == wildcard) &&
+					(slices.Contains(p.Operations, verb) || slices.Contains(p.Operations, wildcard))
+			})
+		}
+		permissions[check.resource] = verbs
+	}
+	return permissions
+}
+
+// getPermissions returns the permissions granted to the user in the organization by the Flight Control API
+func getPermissions(api *upstream.Backend, authHeader string, orgID string) ([]v1beta1.Permission, error) {
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: api.TlsConfig,
+		},
+		Timeout: 30 * time.Second,
+	}
+
+	permissionsURL, err := api.ApiURL("api/v1/auth/permissions")
+	if err != nil {
+		return nil, err
+	}
+	permissionsURL += "?" + url.Values{"org_id": {orgID}}.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, permissionsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if authHeader != "" {
+		req.Header.Set("Authorization", authHeader)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get permissions: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, errUnauthorized
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("getting permissions returned status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPermissionsSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read permissions response: %w", err)
+	}
+	var list v1beta1.PermissionList
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse permissions response: %w", err)
+	}
+	return list.Permissions, nil
+}
@@ -0,0 +1,85 @@
+package permissions
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/flightctl/flightctl-ui/common"
+	"github.com/flightctl/flightctl-ui/upstream"
+)
+
+func TestGetPermissions(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/auth/permissions" || r.URL.Query().Get("org_id") != "org-1" || r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		requests++
+		w.Write([]byte(`{"permissions":[
+			{"resource":"devices","operations":["get","list"]},
+			{"resource":"fleets","operations":["*"]},
+			{"resource":"devices/console","operations":["get"]}]}`))
+	}))
+	defer srv.Close()
+	backends, err := upstream.NewRegistry([]*upstream.Backend{{Name: "default", ApiUrl: srv.URL}}, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewHandler(backends, time.Minute)
+
+	get := func(authHeader string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/permissions", nil)
+		req.Header.Set(common.AuthHeaderKey, authHeader)
+		req = req.WithContext(common.WithOrganizationID(req.Context(), "org-1"))
+		rec := httptest.NewRecorder()
+		handler.GetPermissions(rec, req)
+		return rec
+	}
+
+	rec := get("Bearer token")
+	var resp PermissionsResponse
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &resp) != nil {
+		t.Fatalf("unexpected response %d: %s", rec.Code, rec.Body.String())
+	}
+	for _, c := range []struct {
+		resource string
+		verb     string
+		allowed  bool
+	}{
+		{"devices", "list", true},
+		{"devices", "delete", false},
+		{"fleets", "delete", true},
+		{"devices/console", "get", true},
+		{"imagebuilds", "get", false},
+	} {
+		if resp.Permissions[c.resource][c.verb] != c.allowed {
+			t.Fatalf("expected %s %s to be allowed=%v, got %v", c.verb, c.resource, c.allowed, resp.Permissions)
+		}
+	}
+
+	// Permissions are cached per session
+	get("Bearer token")
+	if requests != 1 {
+		t.Fatalf("expected the permissions to be cached, got %d requests", requests)
+	}
+	if rec := get("Bearer other"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected other sessions not to share the cache, got %d", rec.Code)
+	}
+}
+
+func TestCacheEvictsOldestEntry(t *testing.T) {
+	handler := NewHandler(nil, time.Minute)
+	now := time.Now()
+	for i := 0; i < cacheMaxEntries; i++ {
+		handler.entries[fmt.Sprint(i)] = cacheEntry{expires: now.Add(time.Minute + time.Duration(i)*time.Millisecond)}
+	}
+	handler.pruneLocked(now)
+	if _, ok := handler.entries["0"]; ok || len(handler.entries) != cacheMaxEntries-1 {
+		t.Fatalf("expected only the oldest entry to be evicted, %d entries left", len(handler.entries))
+	}
+}
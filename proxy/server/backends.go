@@ -0,0 +1,47 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/flightctl/flightctl-ui/upstream"
+)
+
+type backendInfo struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName,omitempty"`
+	Default     bool   `json:"default,omitempty"`
+	// Alerts and CliArtifacts tell the UI which optional services the backend provides.
+	Alerts       bool `json:"alerts"`
+	CliArtifacts bool `json:"cliArtifacts"`
+}
+
+type backendsResponse struct {
+	Backends []backendInfo `json:"backends"`
+}
+
+// BackendsHandler lists the Flight Control backends the UI can select with the X-FlightCtl-Backend header.
+func BackendsHandler(backends *upstream.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		defaultName := backends.Default().Name
+		resp := backendsResponse{Backends: []backendInfo{}}
+		for _, b := range backends.List() {
+			resp.Backends = append(resp.Backends, backendInfo{
+				Name:         b.Name,
+				DisplayName:  b.DisplayName,
+				Default:      b.Name == defaultName,
+				Alerts:       b.AlertManagerUrl != "",
+				CliArtifacts: b.CliArtifactsUrl != "",
+			})
+		}
+		payload, err := json.Marshal(resp)
+		if err != nil {
+			http.Error(w, "Failed to encode backends", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(payload); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package upstream
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/flightctl/flightctl-ui/common"
+	"github.com/flightctl/flightctl-ui/config"
+)
+
+// DefaultBackendName is the name of the backend built from the FLIGHTCTL_* environment variables
+// when no backends file is configured.
+const DefaultBackendName = "default"
+
+// Backend is a Flight Control deployment the proxy can route requests to.
+type Backend struct {
+	Name        string
+	DisplayName string
+	// ApiUrl is the Flight Control API used by the proxy; ApiExternalUrl is the one shown to users (e.g. in CLI login commands).
+	ApiUrl          string
+	ApiExternalUrl  string
+	RemoteAccessUrl string
+	ImageBuilderUrl string
+	// AlertManagerUrl and CliArtifactsUrl are empty when the backend does not provide these services.
+	AlertManagerUrl string
+	CliArtifactsUrl string
+	TlsConfig       *tls.Config
+}
+
+// ApiURL builds a URL on the backend's Flight Control API by safely joining path segments.
+func (b *Backend) ApiURL(pathSegments ...string) (string, error) {
+	return common.BuildApiUrl(b.ApiUrl, pathSegments...)
+}
+
+// backendFileEntry is a backend as described in the backends file.
+type backendFileEntry struct {
+	Name               string `json:"name"`
+	DisplayName        string `json:"displayName,omitempty"`
+	ApiUrl             string `json:"apiUrl"`
+	ApiExternalUrl     string `json:"apiExternalUrl,omitempty"`
+	RemoteAccessUrl    string `json:"remoteAccessUrl,omitempty"`
+	ImageBuilderUrl    string `json:"imageBuilderUrl,omitempty"`
+	AlertManagerUrl    string `json:"alertManagerUrl,omitempty"`
+	CliArtifactsUrl    string `json:"cliArtifactsUrl,omitempty"`
+	CaFile             string `json:"caFile,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+}
+
+type backendsFile struct {
+	Default  string             `json:"default,omitempty"`
+	Backends []backendFileEntry `json:"backends"`
+}
+
+// Registry holds the configured backends.
+type Registry struct {
+	backends    []*Backend
+	byName      map[string]*Backend
+	defaultName string
+}
+
+// Load builds the registry from config.BackendsFile. Without a backends file, a single backend
+// is built from the FLIGHTCTL_* environment variables using defaultTlsConfig.
+func Load(defaultTlsConfig *tls.Config) (*Registry, error) {
+	if config.BackendsFile == "" {
+		return NewRegistry([]*Backend{envBackend(defaultTlsConfig)}, DefaultBackendName)
+	}
+
+	content, err := os.ReadFile(config.BackendsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backends file: %w", err)
+	}
+	var file backendsFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse backends file: %w", err)
+	}
+	if len(file.Backends) == 0 {
+		return nil, fmt.Errorf("backends file does not define any backend")
+	}
+
+	backends := make([]*Backend, 0, len(file.Backends))
+	for _, entry := range file.Backends {
+		b, err := backendFromEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		backends = append(backends, b)
+	}
+	defaultName := file.Default
+	if defaultName == "" {
+		defaultName = backends[0].Name
+	}
+	return NewRegistry(backends, defaultName)
+}
+
+// NewRegistry builds a registry from the given backends; defaultName must be one of them.
+func NewRegistry(backends []*Backend, defaultName string) (*Registry, error) {
+	r := &Registry{byName: map[string]*Backend{}, defaultName: defaultName}
+	for _, b := range backends {
+		if _, exists := r.byName[b.Name]; exists {
+			return nil, fmt.Errorf("duplicate backend name %q", b.Name)
+		}
+		r.byName[b.Name] = b
+		r.backends = append(r.backends, b)
+	}
+	if _, ok := r.byName[defaultName]; !ok {
+		return nil, fmt.Errorf("default backend %q is not defined", defaultName)
+	}
+	return r, nil
+}
+
+func envBackend(tlsConfig *tls.Config) *Backend {
+	b := &Backend{
+		Name:            DefaultBackendName,
+		ApiUrl:          config.FctlApiUrl,
+		ApiExternalUrl:  config.FctlApiExternalUrl,
+		RemoteAccessUrl: config.FctlRemoteAccessUrl,
+		ImageBuilderUrl: config.FctlImageBuilderApiUrl,
+		TlsConfig:       tlsConfig,
+	}
+	if alertManagerUrl, ok := os.LookupEnv("FLIGHTCTL_ALERTMANAGER_PROXY"); ok && alertManagerUrl != "" {
+		b.AlertManagerUrl = config.AlertManagerApiUrl
+	}
+	if cliArtifactsUrl, ok := os.LookupEnv("FLIGHTCTL_CLI_ARTIFACTS_SERVER"); ok && cliArtifactsUrl != "" {
+		b.CliArtifactsUrl = config.FctlCliArtifactsUrl
+	}
+	return b
+}
+
+func backendFromEntry(entry backendFileEntry) (*Backend, error) {
+	if !common.IsSafeResourceName(entry.Name) {
+		return nil, fmt.Errorf("invalid backend name %q", entry.Name)
+	}
+	urls := map[string]*string{
+		"apiUrl":          &entry.ApiUrl,
+		"apiExternalUrl":  &entry.ApiExternalUrl,
+		"remoteAccessUrl": &entry.RemoteAccessUrl,
+		"imageBuilderUrl": &entry.ImageBuilderUrl,
+		"alertManagerUrl": &entry.AlertManagerUrl,
+		"cliArtifactsUrl": &entry.CliArtifactsUrl,
+	}
+	for field, value := range urls {
+		*value = strings.TrimSuffix(strings.TrimSpace(*value), "/")
+		if *value == "" {
+			continue
+		}
+		if u, err := url.Parse(*value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("backend %s has an invalid %s", entry.Name, field)
+		}
+	}
+	if entry.ApiUrl == "" {
+		return nil, fmt.Errorf("backend %s is missing apiUrl", entry.Name)
+	}
+
+	tlsConfig, err := newTlsConfig(entry.CaFile, entry.InsecureSkipVerify)
+	if err != nil {
+		return nil, fmt.Errorf("backend %s: %w", entry.Name, err)
+	}
+
+	b := &Backend{
+		Name:            entry.Name,
+		DisplayName:     entry.DisplayName,
+		ApiUrl:          entry.ApiUrl,
+		ApiExternalUrl:  entry.ApiExternalUrl,
+		RemoteAccessUrl: entry.RemoteAccessUrl,
+		ImageBuilderUrl: entry.ImageBuilderUrl,
+		AlertManagerUrl: entry.AlertManagerUrl,
+		CliArtifactsUrl: entry.CliArtifactsUrl,
+		TlsConfig:       tlsConfig,
+	}
+	if b.ApiExternalUrl == "" {
+		b.ApiExternalUrl = b.ApiUrl
+	}
+	return b, nil
+}
+
+func newTlsConfig(caFile string, insecureSkipVerify bool) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecureSkipVerify} //nolint:gosec // opt-in per backend
+	if caFile == "" {
+		return tlsConfig, nil
+	}
+	caCert, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+	caCertPool, err := x509.SystemCertPool()
+	if err != nil {
+		return nil, err
+	}
+	if !caCertPool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("no certificates found in CA file %s", caFile)
+	}
+	tlsConfig.RootCAs = caCertPool
+	return tlsConfig, nil
+}
+
+// List returns the backends in configuration order.
+func (r *Registry) List() []*Backend {
+	return r.backends
+}
+
+// Get returns the backend with the given name.
+func (r *Registry) Get(name string) (*Backend, bool) {
+	b, ok := r.byName[name]
+	return b, ok
+}
+
+// Default returns the backend used when a request does not select one.
+func (r *Registry) Default() *Backend {
+	return r.byName[r.defaultName]
+}
+
+// ForRequest returns the backend selected for the request by BackendMiddleware, or the default backend.
+func (r *Registry) ForRequest(req *http.Request) *Backend {
+	if b, ok := FromContext(req.Context()); ok {
+		return b
+	}
+	return r.Default()
+}
+
+type contextKey struct{}
+
+// WithBackend returns a context carrying the selected backend.
+func WithBackend(ctx context.Context, b *Backend) context.Context {
+	return context.WithValue(ctx, contextKey{}, b)
+}
+
+// FromContext returns the backend selected for the request, if any.
+func FromContext(ctx context.Context) (*Backend, bool) {
+	b, ok := ctx.Value(contextKey{}).(*Backend)
+	return b, ok && b != nil
+}
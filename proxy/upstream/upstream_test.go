@@ -0,0 +1,70 @@
+package upstream
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/flightctl/flightctl-ui/config"
+)
+
+func loadBackendsFile(t *testing.T, content string) (*Registry, error) {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "backends.json")
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write backends file: %v", err)
+	}
+	previous := config.BackendsFile
+	config.BackendsFile = file
+	t.Cleanup(func() { config.BackendsFile = previous })
+	return Load(nil)
+}
+
+func TestLoadBackendsFile(t *testing.T) {
+	registry, err := loadBackendsFile(t, `{
+		"default": "eu",
+		"backends": [
+			{"name": "us", "apiUrl": "https://api.us.example.com/", "alertManagerUrl": "https://alerts.us.example.com"},
+			{"name": "eu", "displayName": "Europe", "apiUrl": "https://api.eu.example.com"}
+		]
+	}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if registry.Default().Name != "eu" || len(registry.List()) != 2 {
+		t.Fatalf("unexpected registry: default %q, %d backends", registry.Default().Name, len(registry.List()))
+	}
+	us, ok := registry.Get("us")
+	if !ok || us.ApiUrl != "https://api.us.example.com" || us.ApiExternalUrl != us.ApiUrl || us.AlertManagerUrl == "" {
+		t.Fatalf("unexpected backend: %+v", us)
+	}
+	if _, ok := registry.Get("unknown"); ok {
+		t.Fatal("expected unknown backend to be missing")
+	}
+}
+
+func TestLoadBackendsFileRejectsInvalidBackends(t *testing.T) {
+	tests := map[string]struct {
+		content string
+		wantErr string
+	}{
+		"no backends":     {`{"backends": []}`, "does not define any backend"},
+		"missing api url": {`{"backends": [{"name": "us"}]}`, "missing apiUrl"},
+		"invalid name":    {`{"backends": [{"name": "../us", "apiUrl": "https://api"}]}`, "invalid backend name"},
+		"invalid url":     {`{"backends": [{"name": "us", "apiUrl": "ftp://api"}]}`, "invalid apiUrl"},
+		"duplicate name": {
+			`{"backends": [{"name": "us", "apiUrl": "https://a"}, {"name": "us", "apiUrl": "https://b"}]}`,
+			"duplicate backend name",
+		},
+		"unknown default": {`{"default": "eu", "backends": [{"name": "us", "apiUrl": "https://a"}]}`, "is not defined"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := loadBackendsFile(t, tc.content)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}